@@ -0,0 +1,426 @@
+package xtws
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Account one exchange account of an AccountManager
+type Account struct {
+	Label  string
+	Key    string
+	Secret string
+	Tokens TokenProvider // default RestTokenProvider with Key and Secret
+	// Balances seeds the spot balances when the account is added, default RestBalanceProvider with Key and Secret,
+	// without keys or provider only pushed balances are known
+	Balances BalanceSnapshotProvider
+	Conf     *ConfOptions // connection options, URL defaults to PrivateBaseUrl
+}
+
+// AccountEvent private event tagged with the account it came from, one of Balance, Order and Trade is set
+type AccountEvent struct {
+	Account string
+	Topic   string
+	Raw     []byte
+	Balance *SpotBalanceData
+	Order   *SpotOrderData
+	Trade   *SpotUserTradeData
+}
+
+// AccountBalance balance of one currency summed over accounts
+type AccountBalance struct {
+	Currency  string
+	Available Decimal
+	Frozen    Decimal
+	Accounts  map[string]SpotBalanceData // account label -> latest balance
+}
+
+func (b AccountBalance) Total() Decimal { return b.Available.Add(b.Frozen) }
+
+// AccountOrder open order of an account
+type AccountOrder struct {
+	Account string
+	SpotOrderData
+}
+
+type AccountManagerConf struct {
+	Topics        []string      // private topics, default balance, order and trade
+	RefreshBefore time.Duration // refresh the token this long before it expires, default 1h, at most half of its lifetime
+	RetryInterval time.Duration // wait after a failed token refresh, default 10s
+	Logger        *log.Logger
+}
+
+// AccountManager one authenticated private connection per account, keyed by label.
+// Tokens are refreshed per account, events are tagged with the account label and
+// balances and open orders are aggregated across accounts. Only spot accounts are supported.
+type AccountManager struct {
+	ctx  context.Context
+	conf AccountManagerConf
+
+	mu       *sync.Mutex
+	accounts map[string]*account
+	balances map[string]map[string]SpotBalanceData // account -> currency -> latest spot balance
+	orders   map[string]map[string]SpotOrderData   // account -> order id -> open order
+
+	handlerMu  *sync.Mutex
+	handlers   []eventHandler // copy on write
+	handlerSeq uint64
+}
+
+type account struct {
+	Account
+	ws     *WsService
+	cancel context.CancelFunc
+}
+
+type eventHandler struct {
+	id uint64
+	f  func(*AccountEvent)
+}
+
+func NewAccountManager(ctx context.Context, conf AccountManagerConf) *AccountManager {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if len(conf.Topics) == 0 {
+		conf.Topics = []string{ChannelSpotBalance, ChannelSpotOrder, ChannelSpotUserTrade}
+	}
+	if conf.RefreshBefore <= 0 {
+		conf.RefreshBefore = time.Hour
+	}
+	if conf.RetryInterval <= 0 {
+		conf.RetryInterval = 10 * time.Second
+	}
+	if conf.Logger == nil {
+		conf.Logger = log.New(os.Stdout, "", log.LstdFlags|log.Lshortfile)
+	}
+
+	return &AccountManager{
+		ctx:       ctx,
+		conf:      conf,
+		mu:        new(sync.Mutex),
+		accounts:  make(map[string]*account),
+		balances:  make(map[string]map[string]SpotBalanceData),
+		orders:    make(map[string]map[string]SpotOrderData),
+		handlerMu: new(sync.Mutex),
+	}
+}
+
+// Add connect the account and subscribe its private topics
+func (m *AccountManager) Add(acc Account) error {
+	if acc.Label == "" {
+		return fmt.Errorf("account label is empty")
+	}
+	if acc.Tokens == nil {
+		if acc.Key == "" || acc.Secret == "" {
+			return newAuthEmptyErr()
+		}
+		acc.Tokens = &RestTokenProvider{Key: acc.Key, Secret: acc.Secret}
+	}
+	if acc.Balances == nil && acc.Key != "" && acc.Secret != "" {
+		acc.Balances = &RestBalanceProvider{Key: acc.Key, Secret: acc.Secret}
+	}
+
+	m.mu.Lock()
+	_, exists := m.accounts[acc.Label]
+	m.mu.Unlock()
+	if exists {
+		return fmt.Errorf("account %s already added", acc.Label)
+	}
+
+	token, expire, err := acc.Tokens.Token(m.ctx)
+	if err != nil {
+		return fmt.Errorf("account %s token: %w", acc.Label, err)
+	}
+
+	op := ConfOptions{}
+	if acc.Conf != nil {
+		op = *acc.Conf
+	}
+	if op.URL == "" {
+		op.URL = PrivateBaseUrl
+	}
+	op.Key, op.Secret, op.ListenKey = acc.Key, acc.Secret, token
+
+	ctx, cancel := context.WithCancel(m.ctx)
+	ws, err := NewWsService(ctx, m.conf.Logger, NewConnConfFromOption(&op))
+	if err != nil {
+		cancel()
+		return fmt.Errorf("account %s connect: %w", acc.Label, err)
+	}
+
+	a := &account{Account: acc, ws: ws, cancel: cancel}
+	for _, topic := range m.conf.Topics {
+		ws.AddCallBack(topic, func(rawMsg []byte) { m.handle(acc.Label, topic, rawMsg) })
+	}
+
+	m.mu.Lock()
+	if _, exists := m.accounts[acc.Label]; exists {
+		m.mu.Unlock()
+		// the connection owner closes the connection
+		cancel()
+		return fmt.Errorf("account %s already added", acc.Label)
+	}
+	m.accounts[acc.Label] = a
+	m.mu.Unlock()
+
+	if err := ws.SubscribeSpotPrivate(m.conf.Topics); err != nil {
+		m.Remove(acc.Label)
+		return fmt.Errorf("account %s subscribe: %w", acc.Label, err)
+	}
+	// after subscribing, pushes racing the snapshot are kept when newer
+	if err := m.seed(a); err != nil {
+		m.Remove(acc.Label)
+		return fmt.Errorf("account %s balances: %w", acc.Label, err)
+	}
+
+	go m.refresh(ctx, a, expire)
+	return nil
+}
+
+// Remove disconnect the account and forget its balances and orders
+func (m *AccountManager) Remove(label string) {
+	m.mu.Lock()
+	a, ok := m.accounts[label]
+	delete(m.accounts, label)
+	delete(m.balances, label)
+	delete(m.orders, label)
+	m.mu.Unlock()
+
+	if !ok {
+		return
+	}
+	a.cancel()
+}
+
+// Accounts labels of the connected accounts, sorted
+func (m *AccountManager) Accounts() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	labels := make([]string, 0, len(m.accounts))
+	for label := range m.accounts {
+		labels = append(labels, label)
+	}
+	slices.Sort(labels)
+	return labels
+}
+
+// Service connection of the account, e.g. for APIRequest
+func (m *AccountManager) Service(label string) (*WsService, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	a, ok := m.accounts[label]
+	if !ok {
+		return nil, false
+	}
+	return a.ws, true
+}
+
+// OnEvent f receives the private events of every account, it is called from the
+// reader goroutines of the accounts, possibly concurrently. The returned func removes f.
+func (m *AccountManager) OnEvent(f func(ev *AccountEvent)) (remove func()) {
+	if f == nil {
+		return func() {}
+	}
+
+	m.handlerMu.Lock()
+	m.handlerSeq++
+	id := m.handlerSeq
+	m.handlers = append(slices.Clip(m.handlers), eventHandler{id: id, f: f})
+	m.handlerMu.Unlock()
+
+	return func() {
+		m.handlerMu.Lock()
+		defer m.handlerMu.Unlock()
+		m.handlers = slices.DeleteFunc(slices.Clone(m.handlers), func(h eventHandler) bool { return h.id == id })
+	}
+}
+
+// Balance latest spot balance of currency in the account
+func (m *AccountManager) Balance(label, currency string) (SpotBalanceData, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, ok := m.balances[label][currency]
+	return b, ok
+}
+
+// Balances spot balances per currency summed over accounts
+func (m *AccountManager) Balances() map[string]AccountBalance {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	res := make(map[string]AccountBalance)
+	for label, balances := range m.balances {
+		for currency, b := range balances {
+			agg, ok := res[currency]
+			if !ok {
+				agg = AccountBalance{Currency: currency, Accounts: make(map[string]SpotBalanceData)}
+			}
+			// parsed in handle before being stored
+			available, _ := b.Available()
+			frozen, _ := b.Frozen()
+			agg.Available = agg.Available.Add(available)
+			agg.Frozen = agg.Frozen.Add(frozen)
+			agg.Accounts[label] = b
+			res[currency] = agg
+		}
+	}
+	return res
+}
+
+// OpenOrders open orders of every account, oldest first
+func (m *AccountManager) OpenOrders() []AccountOrder {
+	m.mu.Lock()
+	var res []AccountOrder
+	for label, orders := range m.orders {
+		for _, o := range orders {
+			res = append(res, AccountOrder{Account: label, SpotOrderData: o})
+		}
+	}
+	m.mu.Unlock()
+
+	slices.SortFunc(res, func(a, b AccountOrder) int {
+		return cmp.Or(cmp.Compare(a.CreateTime, b.CreateTime), cmp.Compare(a.OrderID, b.OrderID))
+	})
+	return res
+}
+
+func (m *AccountManager) handle(label, topic string, rawMsg []byte) {
+	ev := &AccountEvent{Account: label, Topic: topic, Raw: rawMsg}
+
+	var err error
+	switch topic {
+	case ChannelSpotBalance:
+		var msg UpdateSpotBalanceMsg
+		if err = json.Unmarshal(rawMsg, &msg); err == nil {
+			ev.Balance = &msg.Data
+		}
+	case ChannelSpotOrder:
+		var msg UpdateSpotOrderMsg
+		if err = json.Unmarshal(rawMsg, &msg); err == nil {
+			ev.Order = &msg.Data
+		}
+	case ChannelSpotUserTrade:
+		var msg UpdateSpotUserTradeMsg
+		if err = json.Unmarshal(rawMsg, &msg); err == nil {
+			ev.Trade = &msg.Data
+		}
+	}
+	if err != nil {
+		m.conf.Logger.Printf("account %s decode %s err:%s", label, topic, err.Error())
+		return
+	}
+
+	m.mu.Lock()
+	if _, ok := m.accounts[label]; !ok {
+		// removed
+		m.mu.Unlock()
+		return
+	}
+	switch {
+	case ev.Balance != nil && ev.Balance.BizType != "LEVER":
+		if m.balances[label] == nil {
+			m.balances[label] = make(map[string]SpotBalanceData)
+		}
+		m.balances[label][ev.Balance.Currency] = *ev.Balance
+	case ev.Order != nil:
+		if m.orders[label] == nil {
+			m.orders[label] = make(map[string]SpotOrderData)
+		}
+		if ev.Order.Final() {
+			delete(m.orders[label], ev.Order.OrderID)
+		} else {
+			m.orders[label][ev.Order.OrderID] = *ev.Order
+		}
+	}
+	m.mu.Unlock()
+
+	m.handlerMu.Lock()
+	handlers := m.handlers
+	m.handlerMu.Unlock()
+	for _, h := range handlers {
+		h.f(ev)
+	}
+}
+
+// seed store the balance snapshot of the account, balances pushed after the snapshot was taken are kept
+func (m *AccountManager) seed(a *account) error {
+	if a.Balances == nil {
+		return nil
+	}
+	balances, err := a.Balances.Balances(m.ctx)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.accounts[a.Label] != a {
+		// removed
+		return nil
+	}
+	if m.balances[a.Label] == nil {
+		m.balances[a.Label] = make(map[string]SpotBalanceData)
+	}
+	for _, b := range balances {
+		if cur, ok := m.balances[a.Label][b.Asset]; ok && cur.Time > b.UpdateTime {
+			continue
+		}
+		m.balances[a.Label][b.Asset] = SpotBalanceData{
+			Time:     b.UpdateTime,
+			Currency: b.Asset,
+			Balance:  b.Available.String(),
+			Freeze:   b.Frozen.String(),
+			BizType:  "SPOT",
+		}
+	}
+	return nil
+}
+
+// refresh renew the token of the account before it expires and resubscribe with it
+func (m *AccountManager) refresh(ctx context.Context, a *account, expire time.Time) {
+	wait := m.refreshIn(expire)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		token, expire, err := a.Tokens.Token(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			m.conf.Logger.Printf("account %s refresh token err:%s", a.Label, err.Error())
+			wait = m.conf.RetryInterval
+			continue
+		}
+
+		a.ws.SetListenKey(token)
+		// IsReConnect keeps the subscribe history unchanged
+		if err := a.ws.SubscribeWithOption(m.conf.Topics, &SubscribeOptions{Private: true, IsReConnect: true}); err != nil {
+			m.conf.Logger.Printf("account %s resubscribe err:%s", a.Label, err.Error())
+		}
+		wait = m.refreshIn(expire)
+	}
+}
+
+func (m *AccountManager) refreshIn(expire time.Time) time.Duration {
+	if expire.IsZero() {
+		expire = time.Now().Add(DefaultTokenTTL)
+	}
+	left := time.Until(expire)
+	before := min(m.conf.RefreshBefore, left/2)
+	return max(left-before, 0)
+}
@@ -0,0 +1,114 @@
+package xtws
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// privateServer fake private endpoint, push writes a frame to the latest connection
+type privateServer struct {
+	srv  *httptest.Server
+	mu   sync.Mutex
+	conn *websocket.Conn
+}
+
+func newPrivateServer(t *testing.T) *privateServer {
+	s := &privateServer{}
+	upgrader := websocket.Upgrader{}
+	s.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conn = c
+		s.mu.Unlock()
+		for {
+			if _, _, err := c.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(s.srv.Close)
+	return s
+}
+
+func (s *privateServer) push(t *testing.T, frame string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.conn.WriteMessage(websocket.TextMessage, []byte(frame)); err != nil {
+		t.Error(err)
+	}
+}
+
+func testAccount(s *privateServer, balances BalanceSnapshotFunc) Account {
+	return Account{
+		Label: "a",
+		Tokens: TokenProviderFunc(func(context.Context) (string, time.Time, error) {
+			return "token", time.Now().Add(time.Hour), nil
+		}),
+		Balances: balances,
+		Conf:     &ConfOptions{URL: wsURL(s.srv)},
+	}
+}
+
+func TestAccountManagerSeedBalances(t *testing.T) {
+	s := newPrivateServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewAccountManager(ctx, AccountManagerConf{Logger: log.New(io.Discard, "", 0)})
+
+	err := m.Add(testAccount(s, func(context.Context) ([]LedgerBalance, error) {
+		// a push newer than the snapshot arrives while it is loaded
+		s.push(t, `{"topic":"balance","event":"balance","data":{"a":"1","t":200,"c":"usdt","b":"7","f":"1","z":"SPOT"}}`)
+		deadline := time.Now().Add(time.Second)
+		for {
+			if _, ok := m.Balance("a", "usdt"); ok || time.Now().After(deadline) {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		return []LedgerBalance{
+			{Asset: "usdt", Available: MustParseDecimal("10"), UpdateTime: 150},
+			{Asset: "btc", Available: MustParseDecimal("1.5"), Frozen: MustParseDecimal("0.5"), UpdateTime: 150},
+		}, nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b, ok := m.Balance("a", "usdt"); !ok || b.Balance != "7" {
+		t.Fatalf("usdt %+v %v, want the newer push kept", b, ok)
+	}
+	if b, ok := m.Balance("a", "btc"); !ok || b.Balance != "1.5" || b.Freeze != "0.5" {
+		t.Fatalf("btc %+v %v, want the snapshot", b, ok)
+	}
+	if total := m.Balances()["btc"].Total(); !total.Equal(MustParseDecimal("2")) {
+		t.Fatalf("btc total %s", total)
+	}
+}
+
+func TestAccountManagerSeedError(t *testing.T) {
+	s := newPrivateServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewAccountManager(ctx, AccountManagerConf{Logger: log.New(io.Discard, "", 0)})
+
+	fail := errors.New("balances down")
+	err := m.Add(testAccount(s, func(context.Context) ([]LedgerBalance, error) { return nil, fail }))
+	if !errors.Is(err, fail) {
+		t.Fatalf("got %v, want the snapshot error", err)
+	}
+	if len(m.Accounts()) != 0 {
+		t.Fatalf("accounts %v after a failed seed", m.Accounts())
+	}
+}
@@ -0,0 +1,381 @@
+package xtws
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// BarKind how an aggregated bar is closed
+type BarKind int
+
+const (
+	BarTime     BarKind = iota // every Interval of trade time
+	BarTick                    // every Threshold trades
+	BarVolume                  // every Threshold of base quantity
+	BarNotional                // every Threshold of quote amount (price * quantity)
+)
+
+var barKindString = map[BarKind]string{
+	BarTime:     "time",
+	BarTick:     "tick",
+	BarVolume:   "volume",
+	BarNotional: "notional",
+}
+
+func (k BarKind) String() string {
+	return barKindString[k]
+}
+
+type BarSpec struct {
+	Kind      BarKind
+	Interval  time.Duration // BarTime, e.g. 3s, at least 1ms
+	Threshold Decimal       // BarTick, BarVolume and BarNotional
+	// Lateness how long trades are held back to be sorted by (time, id) before they are applied.
+	// Trades older than the last applied one are dropped and counted in LateTrades.
+	Lateness time.Duration
+}
+
+func (s BarSpec) String() string {
+	if s.Kind == BarTime {
+		return fmt.Sprintf("%s:%s", s.Kind, s.Interval)
+	}
+	return fmt.Sprintf("%s:%s", s.Kind, s.Threshold)
+}
+
+func (s BarSpec) validate() error {
+	switch s.Kind {
+	case BarTime:
+		if s.Interval < time.Millisecond {
+			return fmt.Errorf("time bar interval %s too small", s.Interval)
+		}
+	case BarTick, BarVolume, BarNotional:
+		if s.Threshold.Sign() <= 0 {
+			return fmt.Errorf("%s bar threshold must be positive", s.Kind)
+		}
+	default:
+		return fmt.Errorf("unknown bar kind %d", s.Kind)
+	}
+	if s.Lateness < 0 {
+		return fmt.Errorf("negative lateness %s", s.Lateness)
+	}
+	return nil
+}
+
+// Bar OHLCV built from trades, times are milliseconds
+type Bar struct {
+	Symbol    string
+	Spec      BarSpec
+	StartTime int64 // BarTime: bucket start, others: first trade time
+	EndTime   int64 // BarTime: bucket end (exclusive), others: last trade time
+	Open      Decimal
+	High      Decimal
+	Low       Decimal
+	Close     Decimal
+	Volume    Decimal // base quantity
+	Notional  Decimal // quote amount
+	BuyVolume Decimal // taker buy base quantity
+	Trades    int64
+}
+
+// BarAggregator builds bars of one BarSpec from trade@{symbol}
+type BarAggregator struct {
+	spec        BarSpec
+	historySize int
+	onBar       func(Bar)
+
+	mu         *sync.Mutex
+	symbols    map[string]*barState
+	lateTrades int64
+}
+
+type barState struct {
+	pending     []TradeData // held back for Lateness, sorted by (time, id)
+	watermark   int64
+	closedUntil int64 // time bars ending at or before it were closed by the clock
+	lastTime    int64
+	lastID      int64
+	applied     bool
+	current     *Bar
+	history     []Bar
+}
+
+// NewBarAggregator onBar is called for every closed bar, the last historySize bars per symbol are kept
+func NewBarAggregator(spec BarSpec, historySize int, onBar func(Bar)) (*BarAggregator, error) {
+	if err := spec.validate(); err != nil {
+		return nil, err
+	}
+	return &BarAggregator{
+		spec:        spec,
+		historySize: historySize,
+		onBar:       onBar,
+		mu:          new(sync.Mutex),
+		symbols:     make(map[string]*barState),
+	}, nil
+}
+
+// Attach consume ChannelSpotTrade of ws, subscribe the symbols with ws.SubscribeTrade.
+// The returned func detaches the aggregator.
+func (a *BarAggregator) Attach(ws *WsService) (detach func()) {
+	return ws.AddCallBack(ChannelSpotTrade, ws.NewTradeCallBack(func(msg *UpdateTradeMsg) {
+		if err := a.Add(msg.Data); err != nil {
+			ws.Logger.Printf("bar aggregator %s skip trade err:%s", a.spec, err.Error())
+		}
+	}))
+}
+
+// Add apply a trade, bars closed by it are passed to onBar before Add returns.
+// A trade with a malformed price or quantity is rejected.
+func (a *BarAggregator) Add(trade TradeData) error {
+	if _, err := trade.TradePrice(); err != nil {
+		return err
+	}
+	if _, err := trade.TradeQuantity(); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	closed := a.add(trade)
+	a.mu.Unlock()
+
+	a.emit(closed)
+	return nil
+}
+
+func (a *BarAggregator) add(trade TradeData) []Bar {
+	st, ok := a.symbols[trade.Symbol]
+	if !ok {
+		st = &barState{}
+		a.symbols[trade.Symbol] = st
+	}
+
+	if trade.Time < st.closedUntil || (st.applied && !tradeAfter(trade.Time, trade.ID, st.lastTime, st.lastID)) {
+		a.lateTrades++
+		return nil
+	}
+
+	i, found := slices.BinarySearchFunc(st.pending, trade, compareTrade)
+	if found {
+		// duplicate push
+		return nil
+	}
+	st.pending = slices.Insert(st.pending, i, trade)
+	st.watermark = max(st.watermark, trade.Time)
+
+	// release trades that can no longer be overtaken
+	limit := st.watermark - a.spec.Lateness.Milliseconds()
+	n := 0
+	for n < len(st.pending) && st.pending[n].Time <= limit {
+		n++
+	}
+
+	var closed []Bar
+	for _, t := range st.pending[:n] {
+		closed = append(closed, a.apply(st, t)...)
+	}
+	st.pending = slices.Delete(st.pending, 0, n)
+	return closed
+}
+
+func compareTrade(a, b TradeData) int {
+	if a.Time != b.Time {
+		return cmp.Compare(a.Time, b.Time)
+	}
+	return cmp.Compare(a.ID, b.ID)
+}
+
+func tradeAfter(time, id, lastTime, lastID int64) bool {
+	return time > lastTime || (time == lastTime && id > lastID)
+}
+
+func (a *BarAggregator) apply(st *barState, t TradeData) []Bar {
+	st.lastTime, st.lastID, st.applied = t.Time, t.ID, true
+
+	// checked in Add
+	price, _ := t.TradePrice()
+	qty, _ := t.TradeQuantity()
+
+	var closed []Bar
+	if a.spec.Kind == BarTime {
+		interval := a.spec.Interval.Milliseconds()
+		start := t.Time - ((t.Time%interval)+interval)%interval
+		if st.current != nil && st.current.StartTime != start {
+			closed = append(closed, a.close(st))
+		}
+		if st.current == nil {
+			st.current = a.newBar(t.Symbol, price)
+			st.current.StartTime, st.current.EndTime = start, start+interval
+		}
+	} else if st.current == nil {
+		st.current = a.newBar(t.Symbol, price)
+		st.current.StartTime = t.Time
+	}
+
+	bar := st.current
+	bar.High = MaxDecimal(bar.High, price)
+	bar.Low = MinDecimal(bar.Low, price)
+	bar.Close = price
+	bar.Volume = bar.Volume.Add(qty)
+	bar.Notional = bar.Notional.Add(price.Mul(qty))
+	if !t.IsBuyerMaker {
+		bar.BuyVolume = bar.BuyVolume.Add(qty)
+	}
+	bar.Trades++
+	if a.spec.Kind != BarTime {
+		bar.EndTime = t.Time
+	}
+
+	var full bool
+	switch a.spec.Kind {
+	case BarTick:
+		full = NewDecimalFromInt(bar.Trades).Cmp(a.spec.Threshold) >= 0
+	case BarVolume:
+		full = bar.Volume.Cmp(a.spec.Threshold) >= 0
+	case BarNotional:
+		full = bar.Notional.Cmp(a.spec.Threshold) >= 0
+	}
+	if full {
+		closed = append(closed, a.close(st))
+	}
+
+	return closed
+}
+
+func (a *BarAggregator) newBar(symbol string, price Decimal) *Bar {
+	return &Bar{
+		Symbol: symbol,
+		Spec:   a.spec,
+		Open:   price,
+		High:   price,
+		Low:    price,
+	}
+}
+
+func (a *BarAggregator) close(st *barState) Bar {
+	bar := *st.current
+	st.current = nil
+
+	if a.historySize > 0 {
+		st.history = append(st.history, bar)
+		if len(st.history) > a.historySize {
+			st.history = slices.Delete(st.history, 0, len(st.history)-a.historySize)
+		}
+	}
+	return bar
+}
+
+func (a *BarAggregator) emit(bars []Bar) {
+	if a.onBar == nil {
+		return
+	}
+	for _, bar := range bars {
+		a.onBar(bar)
+	}
+}
+
+// Flush apply held back trades and close the open bar of symbol, e.g. on shutdown or at the end of a time bar
+func (a *BarAggregator) Flush(symbol string) {
+	a.mu.Lock()
+	var closed []Bar
+	if st, ok := a.symbols[symbol]; ok {
+		for _, t := range st.pending {
+			closed = append(closed, a.apply(st, t)...)
+		}
+		st.pending = st.pending[:0]
+		if st.current != nil {
+			closed = append(closed, a.close(st))
+		}
+	}
+	a.mu.Unlock()
+
+	a.emit(closed)
+}
+
+// CloseBars close the time bars of every symbol ending at or before end, applying the held back
+// trades older than end first. Trades older than end arriving afterwards are late.
+// Run calls it at every bar boundary, call it directly to drive the bars from another clock.
+func (a *BarAggregator) CloseBars(end time.Time) {
+	if a.spec.Kind != BarTime {
+		return
+	}
+	limit := end.UnixMilli()
+
+	a.mu.Lock()
+	var closed []Bar
+	for _, st := range a.symbols {
+		n := 0
+		for n < len(st.pending) && st.pending[n].Time < limit {
+			closed = append(closed, a.apply(st, st.pending[n])...)
+			n++
+		}
+		st.pending = slices.Delete(st.pending, 0, n)
+		if st.current != nil && st.current.EndTime <= limit {
+			closed = append(closed, a.close(st))
+		}
+		st.closedUntil = max(st.closedUntil, limit)
+	}
+	a.mu.Unlock()
+
+	slices.SortStableFunc(closed, func(x, y Bar) int {
+		return cmp.Or(cmp.Compare(x.StartTime, y.StartTime), cmp.Compare(x.Symbol, y.Symbol))
+	})
+	a.emit(closed)
+}
+
+// Run close time bars by the local clock Lateness after their end until ctx is done,
+// so a bar is emitted without waiting for the next trade. It returns at once for other bar kinds.
+func (a *BarAggregator) Run(ctx context.Context) {
+	if a.spec.Kind != BarTime {
+		return
+	}
+	interval, lateness := a.spec.Interval.Milliseconds(), a.spec.Lateness.Milliseconds()
+
+	for {
+		// next boundary whose lateness has not passed yet
+		now := time.Now().UnixMilli()
+		end := (now-lateness)/interval*interval + interval
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Duration(end+lateness-now) * time.Millisecond):
+		}
+		a.CloseBars(time.UnixMilli(end))
+	}
+}
+
+// History closed bars of symbol, oldest first
+func (a *BarAggregator) History(symbol string) []Bar {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if st, ok := a.symbols[symbol]; ok {
+		return slices.Clone(st.history)
+	}
+	return nil
+}
+
+// Current the open bar of symbol
+func (a *BarAggregator) Current(symbol string) (Bar, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if st, ok := a.symbols[symbol]; ok && st.current != nil {
+		return *st.current, true
+	}
+	return Bar{}, false
+}
+
+// LateTrades number of trades dropped because they arrived after newer trades were applied
+func (a *BarAggregator) LateTrades() int64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.lateTrades
+}
+
+func (a *BarAggregator) Spec() BarSpec {
+	return a.spec
+}
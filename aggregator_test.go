@@ -0,0 +1,209 @@
+package xtws
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func testTrade(symbol string, id, t int64, price string) TradeData {
+	return TradeData{Symbol: symbol, ID: id, Time: t, Price: price, Quantity: "1"}
+}
+
+func TestBarAggregatorCloseBars(t *testing.T) {
+	var bars []Bar
+	a, err := NewBarAggregator(BarSpec{Kind: BarTime, Interval: time.Second, Lateness: 200 * time.Millisecond}, 10, func(b Bar) {
+		bars = append(bars, b)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, tt := range []TradeData{
+		testTrade("btc_usdt", 1, 1000, "10"),
+		testTrade("btc_usdt", 2, 1500, "12"),
+		testTrade("eth_usdt", 1, 1900, "2"), // held back until 2100
+	} {
+		if err := a.Add(tt); err != nil {
+			t.Fatal(i, err)
+		}
+	}
+	if len(bars) != 0 {
+		t.Fatalf("bars closed before the boundary: %+v", bars)
+	}
+
+	// the boundary at 2000 passed without a trade of the next bar
+	a.CloseBars(time.UnixMilli(2000))
+	if len(bars) != 2 || bars[0].Symbol != "btc_usdt" || bars[1].Symbol != "eth_usdt" {
+		t.Fatalf("got %+v, want the btc and eth bars ending at 2000", bars)
+	}
+	if bars[0].Trades != 2 || bars[0].Close.String() != "12" || bars[0].EndTime != 2000 {
+		t.Fatalf("btc bar %+v", bars[0])
+	}
+
+	// a trade of the closed bar is late, it does not open a second bar for the same interval
+	if err := a.Add(testTrade("btc_usdt", 3, 1999, "11")); err != nil {
+		t.Fatal(err)
+	}
+	if a.LateTrades() != 1 {
+		t.Fatalf("late trades %d, want 1", a.LateTrades())
+	}
+	if _, ok := a.Current("btc_usdt"); ok {
+		t.Fatal("late trade opened a bar")
+	}
+
+	if err := a.Add(testTrade("btc_usdt", 4, 2300, "abc")); err == nil {
+		t.Fatal("malformed price accepted")
+	}
+}
+
+func TestBarAggregatorRun(t *testing.T) {
+	closed := make(chan Bar, 1)
+	a, err := NewBarAggregator(BarSpec{Kind: BarTime, Interval: 50 * time.Millisecond}, 0, func(b Bar) {
+		select {
+		case closed <- b:
+		default:
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go a.Run(ctx)
+
+	now := time.Now().UnixMilli()
+	if err := a.Add(testTrade("btc_usdt", 1, now, "100")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case b := <-closed:
+		if b.Trades != 1 || b.EndTime <= now {
+			t.Fatalf("bar %+v", b)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("bar not closed by the clock")
+	}
+}
+
+func TestBarAggregatorThresholds(t *testing.T) {
+	trade := func(id int64, price, qty string, buyerMaker bool) TradeData {
+		return TradeData{Symbol: "btc_usdt", ID: id, Time: 1000 + id, Price: price, Quantity: qty, IsBuyerMaker: buyerMaker}
+	}
+	trades := []TradeData{
+		trade(1, "10", "1", false),
+		trade(2, "12", "0.5", true),
+		trade(3, "9", "1.5", false),
+		trade(4, "11", "2", false),
+		trade(5, "10", "1", true),
+	}
+
+	tests := []struct {
+		kind      BarKind
+		threshold string
+		want      []Bar
+	}{
+		{
+			kind: BarTick, threshold: "2",
+			want: []Bar{
+				{Open: MustParseDecimal("10"), High: MustParseDecimal("12"), Low: MustParseDecimal("10"), Close: MustParseDecimal("12"),
+					Volume: MustParseDecimal("1.5"), Notional: MustParseDecimal("16"), BuyVolume: MustParseDecimal("1"), Trades: 2, StartTime: 1001, EndTime: 1002},
+				{Open: MustParseDecimal("9"), High: MustParseDecimal("11"), Low: MustParseDecimal("9"), Close: MustParseDecimal("11"),
+					Volume: MustParseDecimal("3.5"), Notional: MustParseDecimal("35.5"), BuyVolume: MustParseDecimal("3.5"), Trades: 2, StartTime: 1003, EndTime: 1004},
+			},
+		},
+		{
+			// closes on the trade reaching the threshold, the excess stays in the bar
+			kind: BarVolume, threshold: "2.5",
+			want: []Bar{
+				{Open: MustParseDecimal("10"), High: MustParseDecimal("12"), Low: MustParseDecimal("9"), Close: MustParseDecimal("9"),
+					Volume: MustParseDecimal("3"), Notional: MustParseDecimal("29.5"), BuyVolume: MustParseDecimal("2.5"), Trades: 3, StartTime: 1001, EndTime: 1003},
+				{Open: MustParseDecimal("11"), High: MustParseDecimal("11"), Low: MustParseDecimal("10"), Close: MustParseDecimal("10"),
+					Volume: MustParseDecimal("3"), Notional: MustParseDecimal("32"), BuyVolume: MustParseDecimal("2"), Trades: 2, StartTime: 1004, EndTime: 1005},
+			},
+		},
+		{
+			kind: BarNotional, threshold: "30",
+			want: []Bar{
+				{Open: MustParseDecimal("10"), High: MustParseDecimal("12"), Low: MustParseDecimal("9"), Close: MustParseDecimal("11"),
+					Volume: MustParseDecimal("5"), Notional: MustParseDecimal("51.5"), BuyVolume: MustParseDecimal("4.5"), Trades: 4, StartTime: 1001, EndTime: 1004},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.kind.String(), func(t *testing.T) {
+			var bars []Bar
+			a, err := NewBarAggregator(BarSpec{Kind: tt.kind, Threshold: MustParseDecimal(tt.threshold)}, 10, func(b Bar) { bars = append(bars, b) })
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, tr := range trades {
+				if err := a.Add(tr); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if len(bars) != len(tt.want) {
+				t.Fatalf("%d bars, want %d: %+v", len(bars), len(tt.want), bars)
+			}
+			for i, want := range tt.want {
+				got := bars[i]
+				if !got.Open.Equal(want.Open) || !got.High.Equal(want.High) || !got.Low.Equal(want.Low) || !got.Close.Equal(want.Close) ||
+					!got.Volume.Equal(want.Volume) || !got.Notional.Equal(want.Notional) || !got.BuyVolume.Equal(want.BuyVolume) ||
+					got.Trades != want.Trades || got.StartTime != want.StartTime || got.EndTime != want.EndTime {
+					t.Fatalf("bar %d %+v, want %+v", i, got, want)
+				}
+			}
+			if h := a.History("btc_usdt"); len(h) != len(tt.want) {
+				t.Fatalf("history of %d bars", len(h))
+			}
+		})
+	}
+
+	if _, err := NewBarAggregator(BarSpec{Kind: BarVolume}, 0, nil); err == nil {
+		t.Fatal("volume bars without threshold")
+	}
+}
+
+func TestBarAggregatorLateness(t *testing.T) {
+	var bars []Bar
+	a, err := NewBarAggregator(BarSpec{Kind: BarTick, Threshold: MustParseDecimal("3"), Lateness: 100 * time.Millisecond}, 0, func(b Bar) {
+		bars = append(bars, b)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// out of order within the lateness, held back
+	for _, tr := range []TradeData{
+		testTrade("btc_usdt", 1, 1000, "10"),
+		testTrade("btc_usdt", 3, 1050, "13"),
+		testTrade("btc_usdt", 2, 1020, "12"),
+		testTrade("btc_usdt", 3, 1050, "13"), // duplicate push
+	} {
+		a.Add(tr)
+	}
+	if _, ok := a.Current("btc_usdt"); ok || len(bars) != 0 {
+		t.Fatal("trades applied before the lateness passed")
+	}
+
+	// the watermark moves past 1150, the held back trades are applied sorted by time and id
+	a.Add(testTrade("btc_usdt", 4, 1200, "9"))
+	if len(bars) != 1 || bars[0].Trades != 3 || bars[0].Open.String() != "10" || bars[0].Close.String() != "13" {
+		t.Fatalf("bars %+v, want one bar of 3 trades closing at 13", bars)
+	}
+
+	// older than the last applied trade
+	a.Add(testTrade("btc_usdt", 0, 1040, "8"))
+	if a.LateTrades() != 1 {
+		t.Fatalf("late trades %d, want 1", a.LateTrades())
+	}
+
+	// Flush applies the held back trade and closes the bar
+	a.Flush("btc_usdt")
+	if len(bars) != 2 || bars[1].Trades != 1 || bars[1].Close.String() != "9" {
+		t.Fatalf("bars %+v after Flush", bars)
+	}
+}
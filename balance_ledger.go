@@ -0,0 +1,372 @@
+package xtws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// LedgerBalance balance of one asset
+type LedgerBalance struct {
+	Asset      string
+	Available  Decimal
+	Frozen     Decimal
+	UpdateTime int64 // milliseconds
+}
+
+func (b LedgerBalance) Total() Decimal { return b.Available.Add(b.Frozen) }
+
+// BalanceChange one change applied to the ledger. Drifted is set when the pushed total differs from
+// the previous total plus the changes announced with Expect, or a new snapshot differs from the ledger;
+// Drift is pushed minus expected.
+type BalanceChange struct {
+	Asset   string
+	Old     LedgerBalance
+	New     LedgerBalance
+	Source  string // "snapshot" or "push"
+	Drifted bool
+	Drift   Decimal
+}
+
+// BalanceSnapshotProvider loads all balances, used to seed and re-check the ledger
+type BalanceSnapshotProvider interface {
+	Balances(ctx context.Context) ([]LedgerBalance, error)
+}
+
+// BalanceSnapshotFunc adapts a func to BalanceSnapshotProvider
+type BalanceSnapshotFunc func(ctx context.Context) ([]LedgerBalance, error)
+
+func (f BalanceSnapshotFunc) Balances(ctx context.Context) ([]LedgerBalance, error) { return f(ctx) }
+
+// RestBalanceProvider spot balances, https://doc.xt.com/#balancebalancesGet
+type RestBalanceProvider struct {
+	BaseURL    string // default RestBaseUrl
+	Key        string
+	Secret     string
+	RecvWindow time.Duration // default 5s
+	Client     *http.Client
+}
+
+type restBalanceResp struct {
+	Rc     int    `json:"rc"`
+	Mc     string `json:"mc"`
+	Result struct {
+		Assets []struct {
+			Currency        string `json:"currency"`
+			AvailableAmount string `json:"availableAmount"`
+			FrozenAmount    string `json:"frozenAmount"`
+		} `json:"assets"`
+	} `json:"result"`
+}
+
+func (p *RestBalanceProvider) Balances(ctx context.Context) ([]LedgerBalance, error) {
+	if p.Key == "" || p.Secret == "" {
+		return nil, newAuthEmptyErr()
+	}
+	base := p.BaseURL
+	if base == "" {
+		base = RestBaseUrl
+	}
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	recvWindow := p.RecvWindow
+	if recvWindow <= 0 {
+		recvWindow = 5 * time.Second
+	}
+
+	const path = "/v4/balances"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for k, v := range SignRestHeaders(p.Key, p.Secret, http.MethodGet, path, "", "", recvWindow, now) {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch balances: http status %d", resp.StatusCode)
+	}
+
+	var body restBalanceResp
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	if body.Rc != 0 {
+		return nil, fmt.Errorf("fetch balances: %s", body.Mc)
+	}
+
+	res := make([]LedgerBalance, 0, len(body.Result.Assets))
+	for _, a := range body.Result.Assets {
+		available, err := ParseDecimal(a.AvailableAmount)
+		if err != nil {
+			return nil, fmt.Errorf("fetch balances %s: %w", a.Currency, err)
+		}
+		frozen, err := optionalDecimal(a.FrozenAmount)
+		if err != nil {
+			return nil, fmt.Errorf("fetch balances %s: %w", a.Currency, err)
+		}
+		res = append(res, LedgerBalance{Asset: a.Currency, Available: available, Frozen: frozen, UpdateTime: now.UnixMilli()})
+	}
+	return res, nil
+}
+
+// BalanceLedger balances seeded from a snapshot and kept up to date by balance pushes.
+// Pushes older than the applied state of an asset are ignored, so a snapshot taken while pushes
+// arrive does not roll newer balances back.
+type BalanceLedger struct {
+	provider  BalanceSnapshotProvider
+	Tolerance Decimal // drift smaller than this is ignored, default 0
+
+	pubMu    *sync.Mutex // serializes apply and publish
+	mu       *sync.RWMutex
+	balances map[string]LedgerBalance
+	expected map[string]Decimal // total changes announced with Expect, not pushed yet
+	subMu    *sync.Mutex
+	subs     []balanceSub // copy on write
+	subSeq   uint64
+}
+
+type balanceSub struct {
+	id uint64
+	f  func(BalanceChange)
+}
+
+// NewBalanceLedger provider may be nil when the ledger is only fed by pushes
+func NewBalanceLedger(provider BalanceSnapshotProvider) *BalanceLedger {
+	return &BalanceLedger{
+		provider: provider,
+		pubMu:    new(sync.Mutex),
+		mu:       new(sync.RWMutex),
+		balances: make(map[string]LedgerBalance),
+		expected: make(map[string]Decimal),
+		subMu:    new(sync.Mutex),
+	}
+}
+
+// Seed load a snapshot from the provider. On a seeded ledger differences are reported as drift,
+// call it periodically to re-check the ledger.
+func (l *BalanceLedger) Seed(ctx context.Context) error {
+	if l.provider == nil {
+		return fmt.Errorf("balance ledger has no snapshot provider")
+	}
+	start := time.Now().UnixMilli()
+	snapshot, err := l.provider.Balances(ctx)
+	if err != nil {
+		return err
+	}
+
+	l.pubMu.Lock()
+	defer l.pubMu.Unlock()
+
+	var changes []BalanceChange
+	l.mu.Lock()
+	for _, b := range snapshot {
+		if b.UpdateTime == 0 {
+			b.UpdateTime = start
+		}
+		old, ok := l.balances[b.Asset]
+		if ok && old.UpdateTime > b.UpdateTime {
+			// a push newer than the snapshot
+			continue
+		}
+		l.balances[b.Asset] = b
+		delete(l.expected, b.Asset)
+		if ok && old.Available.Equal(b.Available) && old.Frozen.Equal(b.Frozen) {
+			continue
+		}
+
+		change := BalanceChange{Asset: b.Asset, Old: old, New: b, Source: "snapshot"}
+		if ok {
+			change.Drift = b.Total().Sub(old.Total())
+			change.Drifted = change.Drift.Abs().GreaterThan(l.Tolerance)
+		}
+		changes = append(changes, change)
+	}
+	l.mu.Unlock()
+
+	l.publish(changes...)
+	return nil
+}
+
+// Expect announce a change of the total of asset the next push should carry, e.g. a fill or a transfer.
+// XT pushes carry absolute balances, a push whose total moved by more than the announced changes
+// and Tolerance is reported as drift. Orders placed and canceled only move available to frozen and back.
+func (l *BalanceLedger) Expect(asset string, delta Decimal) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.expected[asset] = l.expected[asset].Add(delta)
+}
+
+// Available available balance of asset, 0 when unknown
+func (l *BalanceLedger) Available(asset string) Decimal {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.balances[asset].Available
+}
+
+// Frozen frozen balance of asset, 0 when unknown
+func (l *BalanceLedger) Frozen(asset string) Decimal {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.balances[asset].Frozen
+}
+
+func (l *BalanceLedger) Balance(asset string) (LedgerBalance, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	b, ok := l.balances[asset]
+	return b, ok
+}
+
+// Balances copy of all balances
+func (l *BalanceLedger) Balances() map[string]LedgerBalance {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	res := make(map[string]LedgerBalance, len(l.balances))
+	for asset, b := range l.balances {
+		res[asset] = b
+	}
+	return res
+}
+
+// Subscribe f is called after every change in the order changes were applied, from the goroutine applying it.
+// f must not apply changes to the ledger. The returned func removes f.
+func (l *BalanceLedger) Subscribe(f func(c BalanceChange)) (remove func()) {
+	if f == nil {
+		return func() {}
+	}
+
+	l.subMu.Lock()
+	l.subSeq++
+	id := l.subSeq
+	l.subs = append(slices.Clip(l.subs), balanceSub{id: id, f: f})
+	l.subMu.Unlock()
+
+	return func() {
+		l.subMu.Lock()
+		defer l.subMu.Unlock()
+		l.subs = slices.DeleteFunc(slices.Clone(l.subs), func(s balanceSub) bool { return s.id == id })
+	}
+}
+
+// AttachService apply the ChannelSpotBalance pushes of a private connection
+func (l *BalanceLedger) AttachService(ws *WsService) (remove func()) {
+	return ws.AddCallBack(ChannelSpotBalance, ws.NewSpotBalanceCallBack(func(msg *UpdateSpotBalanceMsg) {
+		if err := l.ApplySpot(&msg.Data); err != nil {
+			ws.Logger.Printf("balance ledger skip push err:%s", err.Error())
+		}
+	}))
+}
+
+// AttachFuturesService apply the ChannelFutureBalance pushes of a futures user stream
+func (l *BalanceLedger) AttachFuturesService(ws *WsService) (remove func()) {
+	return ws.AddCallBack(ChannelFutureBalance, ws.NewFuturesBalanceCallBack(func(msg *UpdateFuturesBalanceMsg) {
+		if err := l.ApplyFutures(&msg.Data); err != nil {
+			ws.Logger.Printf("balance ledger skip futures push err:%s", err.Error())
+		}
+	}))
+}
+
+// AttachAccount apply the balance pushes of one account of m
+func (l *BalanceLedger) AttachAccount(m *AccountManager, label string) (remove func()) {
+	return m.OnEvent(func(ev *AccountEvent) {
+		if ev.Account == label && ev.Balance != nil {
+			if err := l.ApplySpot(ev.Balance); err != nil {
+				m.conf.Logger.Printf("balance ledger account %s skip push err:%s", label, err.Error())
+			}
+		}
+	})
+}
+
+// ApplySpot apply an absolute spot balance push, margin (LEVER) balances are ignored.
+// A push with a malformed amount is rejected.
+func (l *BalanceLedger) ApplySpot(d *SpotBalanceData) error {
+	if d.BizType == "LEVER" {
+		return nil
+	}
+	available, err := d.Available()
+	if err != nil {
+		return err
+	}
+	frozen, err := d.Frozen()
+	if err != nil {
+		return err
+	}
+	l.set(LedgerBalance{Asset: d.Currency, Available: available, Frozen: frozen, UpdateTime: d.Time})
+	return nil
+}
+
+// ApplyFutures apply a futures balance push, the wallet balance is the total and what is not available
+// (order and position margin) is frozen. A push with a malformed amount is rejected.
+func (l *BalanceLedger) ApplyFutures(d *FuturesBalanceData) error {
+	wallet, err := d.Wallet()
+	if err != nil {
+		return err
+	}
+	available, err := d.Available()
+	if err != nil {
+		return err
+	}
+	// the push carries no time, it is applied when received
+	l.set(LedgerBalance{Asset: d.Coin, Available: available, Frozen: wallet.Sub(available), UpdateTime: time.Now().UnixMilli()})
+	return nil
+}
+
+// set store a pushed balance unless older than the stored one, the total is checked against the old total
+// plus the expected changes
+func (l *BalanceLedger) set(b LedgerBalance) {
+	if b.Asset == "" {
+		return
+	}
+
+	// held until published so subscribers see changes in the order they were applied
+	l.pubMu.Lock()
+	defer l.pubMu.Unlock()
+
+	l.mu.Lock()
+	old, ok := l.balances[b.Asset]
+	if ok && b.UpdateTime != 0 && b.UpdateTime < old.UpdateTime {
+		l.mu.Unlock()
+		return
+	}
+	l.balances[b.Asset] = b
+	expected := l.expected[b.Asset]
+	delete(l.expected, b.Asset)
+	l.mu.Unlock()
+
+	change := BalanceChange{Asset: b.Asset, Old: old, New: b, Source: "push"}
+	if ok {
+		change.Drift = b.Total().Sub(old.Total().Add(expected))
+		change.Drifted = change.Drift.Abs().GreaterThan(l.Tolerance)
+	}
+	l.publish(change)
+}
+
+func (l *BalanceLedger) publish(changes ...BalanceChange) {
+	if len(changes) == 0 {
+		return
+	}
+	l.subMu.Lock()
+	subs := l.subs
+	l.subMu.Unlock()
+
+	for _, c := range changes {
+		for _, s := range subs {
+			s.f(c)
+		}
+	}
+}
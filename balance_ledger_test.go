@@ -0,0 +1,165 @@
+package xtws
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func spotPush(asset, available, frozen string, t int64) *SpotBalanceData {
+	return &SpotBalanceData{Currency: asset, Balance: available, Freeze: frozen, BizType: "SPOT", Time: t}
+}
+
+func TestBalanceLedgerSeed(t *testing.T) {
+	snapshot := []LedgerBalance{
+		{Asset: "usdt", Available: MustParseDecimal("100"), UpdateTime: 10},
+		{Asset: "btc", Available: MustParseDecimal("1"), Frozen: MustParseDecimal("0.5"), UpdateTime: 10},
+	}
+	var loadErr error
+	l := NewBalanceLedger(BalanceSnapshotFunc(func(context.Context) ([]LedgerBalance, error) { return snapshot, loadErr }))
+	var changes []BalanceChange
+	l.Subscribe(func(c BalanceChange) { changes = append(changes, c) })
+
+	if err := l.Seed(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 || changes[0].Source != "snapshot" || changes[0].Drifted || changes[1].Drifted {
+		t.Fatalf("changes %+v", changes)
+	}
+	if b, _ := l.Balance("btc"); !b.Total().Equal(MustParseDecimal("1.5")) {
+		t.Fatalf("btc %+v", b)
+	}
+
+	// a push newer than the next snapshot is kept, a changed older balance is drift
+	l.ApplySpot(spotPush("btc", "1.5", "0", 20))
+	snapshot = []LedgerBalance{
+		{Asset: "usdt", Available: MustParseDecimal("90"), UpdateTime: 15},
+		{Asset: "btc", Available: MustParseDecimal("1"), UpdateTime: 15},
+	}
+	changes = nil
+	if err := l.Seed(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].Asset != "usdt" || !changes[0].Drifted || !changes[0].Drift.Equal(MustParseDecimal("-10")) {
+		t.Fatalf("changes %+v", changes)
+	}
+	if !l.Available("btc").Equal(MustParseDecimal("1.5")) {
+		t.Fatalf("btc %s rolled back by an older snapshot", l.Available("btc"))
+	}
+
+	loadErr = errors.New("down")
+	if err := l.Seed(context.Background()); !errors.Is(err, loadErr) {
+		t.Fatalf("got %v", err)
+	}
+	if err := NewBalanceLedger(nil).Seed(context.Background()); err == nil {
+		t.Fatal("seeded without a provider")
+	}
+}
+
+func TestBalanceLedgerDrift(t *testing.T) {
+	l := NewBalanceLedger(nil)
+	l.Tolerance = MustParseDecimal("0.01")
+	var last BalanceChange
+	l.Subscribe(func(c BalanceChange) { last = c })
+
+	push := func(available, frozen string, ts int64) BalanceChange {
+		t.Helper()
+		if err := l.ApplySpot(spotPush("usdt", available, frozen, ts)); err != nil {
+			t.Fatal(err)
+		}
+		return last
+	}
+
+	if c := push("100", "0", 1); c.Drifted {
+		t.Fatalf("first push drifted %+v", c)
+	}
+	// an order placed moves available to frozen
+	if c := push("70", "30", 2); c.Drifted || !c.Drift.IsZero() {
+		t.Fatalf("order placed drifted %s", c.Drift)
+	}
+	// a fill that was announced
+	l.Expect("usdt", MustParseDecimal("-30"))
+	if c := push("70", "0", 3); c.Drifted {
+		t.Fatalf("announced fill drifted %s", c.Drift)
+	}
+	// within the tolerance
+	if c := push("70.005", "0", 4); c.Drifted {
+		t.Fatalf("drift %s within the tolerance", c.Drift)
+	}
+	// an unannounced change
+	if c := push("80.005", "0", 5); !c.Drifted || !c.Drift.Equal(MustParseDecimal("10")) {
+		t.Fatalf("change %+v, want a drift of 10", c)
+	}
+
+	// futures pushes are checked on the wallet balance
+	l.ApplyFutures(&FuturesBalanceData{Coin: "usd", WalletBalance: "100", AvailableBalance: "100"})
+	l.Expect("usd", MustParseDecimal("-1"))
+	l.ApplyFutures(&FuturesBalanceData{Coin: "usd", WalletBalance: "99", AvailableBalance: "80"})
+	if last.Drifted {
+		t.Fatalf("announced futures fee drifted %s", last.Drift)
+	}
+	l.ApplyFutures(&FuturesBalanceData{Coin: "usd", WalletBalance: "95", AvailableBalance: "80"})
+	if !last.Drifted || !last.Drift.Equal(MustParseDecimal("-4")) {
+		t.Fatalf("futures change %+v, want a drift of -4", last)
+	}
+}
+
+func TestBalanceLedgerApplyFutures(t *testing.T) {
+	l := NewBalanceLedger(nil)
+	var changes []BalanceChange
+	l.Subscribe(func(c BalanceChange) { changes = append(changes, c) })
+
+	err := l.ApplyFutures(&FuturesBalanceData{Coin: "usdt", WalletBalance: "100", AvailableBalance: "60", OpenOrderMarginFrozen: "10"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, ok := l.Balance("usdt")
+	if !ok || !b.Available.Equal(MustParseDecimal("60")) || !b.Frozen.Equal(MustParseDecimal("40")) || b.UpdateTime == 0 {
+		t.Fatalf("balance %+v %v", b, ok)
+	}
+	if len(changes) != 1 || changes[0].Source != "push" {
+		t.Fatalf("changes %+v", changes)
+	}
+
+	if err := l.ApplyFutures(&FuturesBalanceData{Coin: "usdt", WalletBalance: "1e", AvailableBalance: "60"}); err == nil {
+		t.Fatal("malformed wallet balance applied")
+	}
+	if !l.Available("usdt").Equal(MustParseDecimal("60")) {
+		t.Fatalf("available %s after a rejected push", l.Available("usdt"))
+	}
+}
+
+func TestBalanceLedgerPublishOrder(t *testing.T) {
+	l := NewBalanceLedger(nil)
+
+	// every change starts from the balance the previous one published
+	var last LedgerBalance
+	broken := 0
+	l.Subscribe(func(c BalanceChange) {
+		if c.Old != last {
+			broken++
+		}
+		last = c.New
+	})
+
+	var wg sync.WaitGroup
+	for g := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 200 {
+				l.ApplySpot(&SpotBalanceData{Currency: "usdt", Balance: strconv.Itoa(g*1000 + i)})
+			}
+		}()
+	}
+	wg.Wait()
+
+	if broken != 0 {
+		t.Fatalf("%d changes published out of order", broken)
+	}
+	if b, _ := l.Balance("usdt"); b != last {
+		t.Fatalf("ledger %+v, last published %+v", b, last)
+	}
+}
@@ -2,25 +2,27 @@ package xtws
 
 import (
 	"bytes"
-	"crypto/hmac"
-	"crypto/sha512"
-	"encoding/hex"
+	"context"
 	"encoding/json"
 	"fmt"
-	"strconv"
+	"slices"
 	"strings"
 	"time"
-
-	"github.com/gorilla/websocket"
 )
 
 type SubscribeOptions struct {
 	ID          string `json:"id"`
 	IsReConnect bool   `json:"-"`
+	Private     bool   `json:"-"` // send ConnConf.ListenKey with the request, spot private topics
 }
 
 // https://doc.xt.com/#websocket_public_cnlimitDepth
 func (ws *WsService) SubscribeDepth(symbols []string, level int) error {
+	symbols, err := ws.normalizeSymbols(symbols)
+	if err != nil {
+		return err
+	}
+
 	channels := make([]string, 0, len(symbols))
 	for _, symbol := range symbols {
 		channels = append(channels, fmt.Sprintf("%s@%s,%d", ChannelSpotDeep, symbol, level))
@@ -31,6 +33,10 @@ func (ws *WsService) SubscribeDepth(symbols []string, level int) error {
 
 // https://doc.xt.com/#websocket_public_cntickerRealTime
 func (ws *WsService) SubscribeTicker(symbols []string) (channel string, err error) {
+	if symbols, err = ws.normalizeSymbols(symbols); err != nil {
+		return
+	}
+
 	channels := make([]string, 0, len(symbols))
 	for _, symbol := range symbols {
 		channels = append(channels, fmt.Sprintf("%s@%s", ChannelSpotTicker, symbol))
@@ -41,23 +47,96 @@ func (ws *WsService) SubscribeTicker(symbols []string) (channel string, err erro
 	return
 }
 
-func (ws *WsService) Subscribe(channels []string) error {
-	for _, channel := range channels {
-		if (ws.conf.Key == "" || ws.conf.Secret == "") && authChannel[channel] {
-			return newAuthEmptyErr()
-		}
+// https://doc.xt.com/#websocket_public_cnallTicker
+func (ws *WsService) SubscribeTickers() error {
+	return ws.newBaseChannel([]string{ChannelSpotTickers}, nil)
+}
+
+// SubscribeMiniTicker subscribe mini_ticker@{symbol}
+func (ws *WsService) SubscribeMiniTicker(symbols []string) error {
+	symbols, err := ws.normalizeSymbols(symbols)
+	if err != nil {
+		return err
+	}
+	return ws.newBaseChannel(symbolChannels(ChannelSpotMiniTicker, symbols), nil)
+}
+
+// SubscribeAggTicker subscribe agg_ticker@{symbol}
+func (ws *WsService) SubscribeAggTicker(symbols []string) error {
+	symbols, err := ws.normalizeSymbols(symbols)
+	if err != nil {
+		return err
+	}
+	return ws.newBaseChannel(symbolChannels(ChannelSpotAggTicker, symbols), nil)
+}
+
+// https://doc.xt.com/#websocket_public_cnincreDepth
+func (ws *WsService) SubscribeDepthUpdate(symbols []string) error {
+	symbols, err := ws.normalizeSymbols(symbols)
+	if err != nil {
+		return err
 	}
+	return ws.newBaseChannel(symbolChannels(ChannelSpotDepthUpdate, symbols), nil)
+}
 
+// https://doc.xt.com/#websocket_public_cndealRecord
+func (ws *WsService) SubscribeTrade(symbols []string) error {
+	symbols, err := ws.normalizeSymbols(symbols)
+	if err != nil {
+		return err
+	}
+	return ws.newBaseChannel(symbolChannels(ChannelSpotTrade, symbols), nil)
+}
+
+// https://doc.xt.com/#websocket_public_cnsymbolKline
+func (ws *WsService) SubscribeKline(symbols []string, interval string) error {
+	channels, err := ws.klineChannels(symbols, interval)
+	if err != nil {
+		return err
+	}
 	return ws.newBaseChannel(channels, nil)
 }
 
-func (ws *WsService) SubscribeWithOption(channels []string, op *SubscribeOptions) error {
-	for _, channel := range channels {
-		if (ws.conf.Key == "" || ws.conf.Secret == "") && authChannel[channel] {
-			return newAuthEmptyErr()
-		}
+// klineChannels kline@{symbol},{interval} of the symbols
+func (ws *WsService) klineChannels(symbols []string, interval string) ([]string, error) {
+	if !slices.Contains(SpotKlineIntervals, interval) {
+		return nil, fmt.Errorf("invalid kline interval %q, must be one of %v", interval, SpotKlineIntervals)
+	}
+	symbols, err := ws.normalizeSymbols(symbols)
+	if err != nil {
+		return nil, err
 	}
 
+	channels := make([]string, 0, len(symbols))
+	for _, symbol := range symbols {
+		channels = append(channels, fmt.Sprintf("%s@%s,%s", ChannelSpotKline, symbol, interval))
+	}
+	return channels, nil
+}
+
+// SubscribeSpotPrivate subscribe ChannelSpotBalance, ChannelSpotOrder or ChannelSpotUserTrade,
+// the connection must use PrivateBaseUrl and ConnConf.ListenKey must be set, see RestTokenProvider
+// https://doc.xt.com/#websocket_private_cnsubscribeParam
+func (ws *WsService) SubscribeSpotPrivate(topics []string) error {
+	if ws.GetListenKey() == "" {
+		return newListenKeyEmptyErr()
+	}
+	return ws.newBaseChannel(topics, &SubscribeOptions{Private: true})
+}
+
+func symbolChannels(topic string, symbols []string) []string {
+	channels := make([]string, 0, len(symbols))
+	for _, symbol := range symbols {
+		channels = append(channels, fmt.Sprintf("%s@%s", topic, symbol))
+	}
+	return channels
+}
+
+func (ws *WsService) Subscribe(channels []string) error {
+	return ws.newBaseChannel(channels, nil)
+}
+
+func (ws *WsService) SubscribeWithOption(channels []string, op *SubscribeOptions) error {
 	// msgCh, ok := ws.msgChs.Load(channel)
 	// if !ok {
 	// 	msgCh = make(chan *UpdateMsg, 1)
@@ -68,7 +147,11 @@ func (ws *WsService) SubscribeWithOption(channels []string, op *SubscribeOptions
 }
 
 func (ws *WsService) UnSubscribe(channels []string) error {
-	return ws.baseSubscribe(UnSubscribe, channels, nil)
+	if err := ws.baseSubscribe(UnSubscribe, channels, nil); err != nil {
+		return err
+	}
+	ws.saveSubscriptions()
+	return nil
 }
 
 func (ws *WsService) newBaseChannel(channels []string, op *SubscribeOptions) error {
@@ -77,45 +160,33 @@ func (ws *WsService) newBaseChannel(channels []string, op *SubscribeOptions) err
 		return err
 	}
 
+	if op == nil || !op.IsReConnect {
+		ws.saveSubscriptions()
+	}
 	return nil
 }
 
 func (ws *WsService) baseSubscribe(method string, channels []string, op *SubscribeOptions) error {
-
-	// hash := hmac.New(sha512.New, []byte(ws.conf.Secret))
-	// hash.Write([]byte(fmt.Sprintf("channel=%s&event=%s&time=%d", channel, Subscribe, ts)))
-	req := Request{
-		Method: method,
-		Params: channels,
-	}
-	// options
-	if op != nil {
-		req.Id = op.ID
-	}
-
-	byteReq, err := json.Marshal(req)
+	byteReq, err := ws.subscribeFrame(method, channels, op)
 	if err != nil {
-		ws.Logger.Printf("req Marshal err:%s", err.Error())
 		return err
 	}
 
-	ws.mu.Lock()
-	defer ws.mu.Unlock()
-
-	err = ws.Client.WriteMessage(websocket.TextMessage, byteReq)
-	fmt.Println("baseSubscribe", string(byteReq))
+	err = ws.write(byteReq)
 	if err != nil {
 		ws.Logger.Printf("wsWrite [%s] err:%s", channels, err.Error())
 		return err
 	}
-
+	ws.histMu.Lock()
+	defer ws.histMu.Unlock()
 	for _, channel := range channels {
 		if v, ok := ws.conf.subscribeMsg.Load(channel); ok {
 			if op != nil && op.IsReConnect {
-				return nil
+				continue
 			}
 			reqs := v.([]requestHistory)
-			reqs = append(reqs, requestHistory{
+			// copy, run may be ranging over the stored slice
+			reqs = append(reqs[:len(reqs):len(reqs)], requestHistory{
 				Channel: channel,
 				Method:  method,
 				op:      op,
@@ -124,7 +195,7 @@ func (ws *WsService) baseSubscribe(method string, channels []string, op *Subscri
 		} else {
 			// avoid saving invalid subscribe msg
 			if strings.HasSuffix(channel, ".ping") || strings.HasSuffix(channel, ".time") {
-				return nil
+				continue
 			}
 
 			ws.conf.subscribeMsg.Store(channel, []requestHistory{{
@@ -137,52 +208,75 @@ func (ws *WsService) baseSubscribe(method string, channels []string, op *Subscri
 	return nil
 }
 
-// readMsg only run once to read message
-func (ws *WsService) readMsg() {
-	ws.once.Do(func() {
-		go func() {
-			defer ws.Client.Close()
-
-			for {
-				select {
-				case <-ws.Ctx.Done():
-					ws.Logger.Printf("closing reader")
-					return
-
-				default:
-					_, rawMsg, err := ws.Client.ReadMessage()
-					fmt.Println("readMsg", string(rawMsg))
-					if err != nil {
-						ws.Logger.Printf("websocket err: %s", err.Error())
-						if e := ws.reconnect(); e != nil {
-							ws.Logger.Printf("reconnect err:%s", err.Error())
-							return
-						}
-						ws.Logger.Println("reconnect success, continue read message")
-						continue
-					}
-					if bytes.Equal(rawMsg, []byte("pong")) {
-						continue
-					}
-
-					var msg UpdateMsg
-					if err := json.Unmarshal(rawMsg, &msg); err != nil {
-						continue
-					}
-
-					channel := msg.GetChannel()
-					if channel == "" {
-						ws.Logger.Printf("channel is empty in message %v", msg)
-						continue
-					}
-
-					if call, ok := ws.calls.Load(channel); ok {
-						call.(CallBack)(rawMsg)
-					}
-				}
-			}
-		}()
-	})
+// subscribeFrame the request of method for channels
+func (ws *WsService) subscribeFrame(method string, channels []string, op *SubscribeOptions) ([]byte, error) {
+	// hash := hmac.New(sha512.New, []byte(ws.conf.Secret))
+	// hash.Write([]byte(fmt.Sprintf("channel=%s&event=%s&time=%d", channel, Subscribe, ts)))
+	// futures streams expect SUBSCRIBE/UNSUBSCRIBE
+	reqMethod := method
+	if ws.conf.isFutures() {
+		reqMethod = strings.ToUpper(method)
+	}
+	req := Request{
+		Method: reqMethod,
+		Params: channels,
+	}
+	// options
+	if op != nil {
+		req.Id = op.ID
+		if op.Private {
+			// read on every send, a refreshed listen key is used on resubscribe
+			req.ListenKey = ws.GetListenKey()
+		}
+	}
+
+	byteReq, err := json.Marshal(req)
+	if err != nil {
+		ws.Logger.Printf("req Marshal err:%s", err.Error())
+		return nil, err
+	}
+	return byteReq, nil
+}
+
+// handleMsg route a frame read from the connection to its callbacks
+func (ws *WsService) handleMsg(rawMsg []byte) {
+	now := time.Now()
+	if bytes.Equal(rawMsg, []byte("pong")) {
+		ws.observePong(now)
+		return
+	}
+
+	channel, event := "", ""
+	if topic, ev, t, ok := scanFrame(rawMsg); ok {
+		channel, event = string(topic), string(ev)
+		if t > 0 {
+			ws.observeTime(t, now)
+		}
+	} else {
+		// slow path, e.g. escaped strings
+		var msg UpdateMsg
+		if err := json.Unmarshal(rawMsg, &msg); err != nil {
+			return
+		}
+		channel, event = msg.GetChannel(), msg.Event
+	}
+
+	// the user stream shares topic names with public streams, its frames carry the listen key in the event
+	if route, ok := futuresPrivateRoutes[channel]; ok && ws.conf.isFutures() {
+		if key := ws.GetListenKey(); key != "" && strings.HasSuffix(event, "@"+key) {
+			channel = route
+		}
+	}
+
+	if channel == "" {
+		ws.Logger.Printf("channel is empty in message %s", rawMsg)
+		return
+	}
+
+	if call, ok := ws.calls.Load(channel); ok {
+		call.(CallBack)(rawMsg)
+	}
+	ws.dispatch(channel, rawMsg)
 }
 
 type CallBack func([]byte)
@@ -191,6 +285,73 @@ func NewCallBack(f func([]byte)) func([]byte) {
 	return f
 }
 
+// newTypedCallBack decode message into T before calling f, decode errors go to ws.Logger
+func newTypedCallBack[T any](ws *WsService, f func(*T)) CallBack {
+	return func(rawMsg []byte) {
+		var msg T
+		if err := json.Unmarshal(rawMsg, &msg); err != nil {
+			ws.Logger.Printf("decode %T err:%s", msg, err.Error())
+			return
+		}
+		f(&msg)
+	}
+}
+
+// NewTickerCallBack callback for ChannelSpotTicker
+func (ws *WsService) NewTickerCallBack(f func(*UpdateTickerMsg)) CallBack {
+	return newTypedCallBack(ws, f)
+}
+
+// NewTickersCallBack callback for ChannelSpotTickers
+func (ws *WsService) NewTickersCallBack(f func(*UpdateTickersMsg)) CallBack {
+	return newTypedCallBack(ws, f)
+}
+
+// NewMiniTickerCallBack callback for ChannelSpotMiniTicker
+func (ws *WsService) NewMiniTickerCallBack(f func(*UpdateMiniTickerMsg)) CallBack {
+	return newTypedCallBack(ws, f)
+}
+
+// NewAggTickerCallBack callback for ChannelSpotAggTicker
+func (ws *WsService) NewAggTickerCallBack(f func(*UpdateAggTickerMsg)) CallBack {
+	return newTypedCallBack(ws, f)
+}
+
+// NewDepthCallBack callback for ChannelSpotDeep
+func (ws *WsService) NewDepthCallBack(f func(*UpdateDepthMsg)) CallBack {
+	return newTypedCallBack(ws, f)
+}
+
+// NewDepthUpdateCallBack callback for ChannelSpotDepthUpdate
+func (ws *WsService) NewDepthUpdateCallBack(f func(*UpdateDepthIncrMsg)) CallBack {
+	return newTypedCallBack(ws, f)
+}
+
+// NewTradeCallBack callback for ChannelSpotTrade
+func (ws *WsService) NewTradeCallBack(f func(*UpdateTradeMsg)) CallBack {
+	return newTypedCallBack(ws, f)
+}
+
+// NewSpotBalanceCallBack callback for ChannelSpotBalance
+func (ws *WsService) NewSpotBalanceCallBack(f func(*UpdateSpotBalanceMsg)) CallBack {
+	return newTypedCallBack(ws, f)
+}
+
+// NewSpotOrderCallBack callback for ChannelSpotOrder
+func (ws *WsService) NewSpotOrderCallBack(f func(*UpdateSpotOrderMsg)) CallBack {
+	return newTypedCallBack(ws, f)
+}
+
+// NewSpotUserTradeCallBack callback for ChannelSpotUserTrade
+func (ws *WsService) NewSpotUserTradeCallBack(f func(*UpdateSpotUserTradeMsg)) CallBack {
+	return newTypedCallBack(ws, f)
+}
+
+// NewKlineCallBack callback for ChannelSpotKline
+func (ws *WsService) NewKlineCallBack(f func(*UpdateKlineMsg)) CallBack {
+	return newTypedCallBack(ws, f)
+}
+
 func (ws *WsService) SetCallBack(channel string, call CallBack) {
 	if call == nil {
 		return
@@ -198,86 +359,151 @@ func (ws *WsService) SetCallBack(channel string, call CallBack) {
 	ws.calls.Store(channel, call)
 }
 
-func (ws *WsService) APIRequest(channel string, keyVals map[string]any) error {
-	var err error
-	ws.loginOnce.Do(func() {
-		err = ws.login()
-	})
+type listener struct {
+	id   uint64
+	call CallBack
+}
 
-	if err != nil {
-		return err
+// AddCallBack add a callback for channel next to the one set by SetCallBack,
+// several consumers (aggregators, stats, ...) can listen to the same channel.
+// The returned func removes the callback.
+func (ws *WsService) AddCallBack(channel string, call CallBack) (remove func()) {
+	if call == nil {
+		return func() {}
 	}
 
-	if (ws.conf.Key == "" || ws.conf.Secret == "") && authChannel[channel] {
-		return newAuthEmptyErr()
+	ws.listenMu.Lock()
+	ws.listenSeq++
+	id := ws.listenSeq
+	var list []listener
+	if v, ok := ws.listeners.Load(channel); ok {
+		list = v.([]listener)
 	}
+	// copy on write, dispatch reads the slice without locking
+	ws.listeners.Store(channel, append(slices.Clip(list), listener{id: id, call: call}))
+	ws.listenMu.Unlock()
 
-	ws.readMsg()
+	return func() {
+		ws.listenMu.Lock()
+		defer ws.listenMu.Unlock()
 
-	return ws.apiRequest(channel, keyVals)
+		v, ok := ws.listeners.Load(channel)
+		if !ok {
+			return
+		}
+		list := slices.DeleteFunc(slices.Clone(v.([]listener)), func(l listener) bool { return l.id == id })
+		if len(list) == 0 {
+			ws.listeners.Delete(channel)
+			return
+		}
+		ws.listeners.Store(channel, list)
+	}
 }
 
-func (ws *WsService) login() error {
-	if ws.conf.Key == "" || ws.conf.Secret == "" {
-		return newAuthEmptyErr()
+func (ws *WsService) dispatch(channel string, rawMsg []byte) {
+	v, ok := ws.listeners.Load(channel)
+	if !ok {
+		return
 	}
-	channel := ChannelSpotLogin
-	if ws.conf.App == "futures" {
-		channel = ChannelFutureLogin
+	for _, l := range v.([]listener) {
+		l.call(rawMsg)
 	}
+}
 
-	ws.readMsg()
+// APIRequest send {"id", "method", "params", "listenKey"} on the connection, e.g. to subscribe private topics
+// by hand. keyVals may carry "id" (string) and "params" ([]string). Without a listen key one is fetched with
+// the credentials first, see UseTokens.
+func (ws *WsService) APIRequest(method string, keyVals map[string]any) error {
+	if err := ws.login(ws.Ctx, false); err != nil {
+		return err
+	}
+	return ws.apiRequest(method, keyVals)
+}
 
-	return ws.apiRequest(channel, nil)
+// UseTokens fetch listen keys with p, default a RestTokenProvider, or a RestFuturesTokenProvider for the
+// futures apps, with the current credentials
+func (ws *WsService) UseTokens(p TokenProvider) {
+	ws.hookMu.Lock()
+	defer ws.hookMu.Unlock()
+	ws.tokens = p
 }
 
-func (ws *WsService) apiRequest(channel string, keyVals map[string]any) error {
-	req := Request{
-		Method: channel,
-		Params: []string{channel},
+func (ws *WsService) tokenProvider() TokenProvider {
+	ws.hookMu.Lock()
+	p := ws.tokens
+	ws.hookMu.Unlock()
+	if p != nil {
+		return p
 	}
 
-	byteReq, err := json.Marshal(req)
-	if err != nil {
-		ws.Logger.Printf("req Marshal err:%s", err.Error())
-		return err
+	key, secret := ws.credentials()
+	switch ws.conf.App {
+	case AppFutures:
+		return &RestFuturesTokenProvider{Key: key, Secret: secret}
+	case AppCoinFutures:
+		return &RestFuturesTokenProvider{BaseURL: CoinFuturesRestBaseUrl, Key: key, Secret: secret}
 	}
-	ws.mu.Lock()
-	defer ws.mu.Unlock()
-
-	return ws.Client.WriteMessage(websocket.TextMessage, byteReq)
+	return &RestTokenProvider{Key: key, Secret: secret}
 }
 
-func (ws *WsService) generateAPIRequest(channel string, placeParam any, keyVals map[string]any) any {
-	reqID := "req_id"
-	gateChannelID := "T_channel_id"
+// login XT streams have no login request, private topics are authenticated by a listen key fetched
+// with the credentials. login fetches one, unless force is false and the service has a key, and moves
+// the private channels to it.
+func (ws *WsService) login(ctx context.Context, force bool) error {
+	ws.loginMu.Lock()
+	defer ws.loginMu.Unlock()
 
-	if v, ok := keyVals["req_id"]; ok {
-		reqID, _ = v.(string)
+	if !force && ws.GetListenKey() != "" {
+		return nil
 	}
-
-	if v, ok := keyVals["X-Gate-Channel-Id"]; ok {
-		gateChannelID, _ = v.(string)
+	if !ws.hasCredentials() {
+		return newAuthEmptyErr()
+	}
+	key, _, err := ws.tokenProvider().Token(ctx)
+	if err != nil {
+		return fmt.Errorf("fetch listen key: %w", err)
 	}
 
-	now := time.Now().Unix()
-
-	reqParam, _ := json.Marshal(placeParam)
+	ws.confMu.Lock()
+	old := ws.conf.ListenKey
+	ws.conf.ListenKey = key
+	ws.confMu.Unlock()
+	ws.loggedIn.Store(true)
 
-	message := fmt.Sprintf("api\n%s\n%s\n%d", channel, reqParam, now)
+	if key == old {
+		return nil
+	}
+	return ws.moveListenKey(old)
+}
 
-	return APIReq{
-		ApiKey:    ws.conf.Key,
-		Signature: calculateSignature(ws.conf.Secret, message),
-		Timestamp: strconv.Itoa(int(now)),
-		ReqId:     reqID,
-		ReqHeader: json.RawMessage(fmt.Sprintf(`{"X-Gate-Channel-Id":"%s"}`, gateChannelID)),
-		ReqParam:  reqParam,
+func (ws *WsService) apiRequest(method string, keyVals map[string]any) error {
+	byteReq, err := ws.apiFrame(method, keyVals)
+	if err != nil {
+		return err
 	}
+	return ws.write(byteReq)
 }
 
-func calculateSignature(secret string, message string) string {
-	h := hmac.New(sha512.New, []byte(secret))
-	h.Write([]byte(message))
-	return hex.EncodeToString(h.Sum(nil))
+func (ws *WsService) apiFrame(method string, keyVals map[string]any) ([]byte, error) {
+	if ws.conf.isFutures() {
+		method = strings.ToUpper(method)
+	}
+	req := Request{
+		Method:    method,
+		Params:    []string{},
+		ListenKey: ws.GetListenKey(),
+	}
+	if id, ok := keyVals["id"].(string); ok {
+		req.Id = id
+	}
+	if params, ok := keyVals["params"].([]string); ok {
+		req.Params = params
+	}
+
+	byteReq, err := json.Marshal(req)
+	if err != nil {
+		ws.Logger.Printf("req Marshal err:%s", err.Error())
+		return nil, err
+	}
+	return byteReq, nil
 }
@@ -0,0 +1,173 @@
+package xtws
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+)
+
+// https://doc.xt.com/#futures_market_websocket_v2base
+// futures streams need ConnConf.App set to AppFutures or AppCoinFutures
+
+func (ws *WsService) SubscribeFuturesTicker(symbols []string) error {
+	return ws.newBaseChannel(symbolChannels(ChannelFutureTicker, symbols), nil)
+}
+
+func (ws *WsService) SubscribeFuturesTickers() error {
+	return ws.newBaseChannel([]string{ChannelFutureTickers}, nil)
+}
+
+func (ws *WsService) SubscribeFuturesAggTicker(symbols []string) error {
+	return ws.newBaseChannel(symbolChannels(ChannelFutureAggTicker, symbols), nil)
+}
+
+func (ws *WsService) SubscribeFuturesAggTickers() error {
+	return ws.newBaseChannel([]string{ChannelFutureAggTickers}, nil)
+}
+
+func (ws *WsService) SubscribeFuturesTrade(symbols []string) error {
+	return ws.newBaseChannel(symbolChannels(ChannelFutureTrade, symbols), nil)
+}
+
+func (ws *WsService) SubscribeFuturesDepth(symbols []string, level int) error {
+	channels := make([]string, 0, len(symbols))
+	for _, symbol := range symbols {
+		channels = append(channels, fmt.Sprintf("%s@%s,%d", ChannelFutureDepth, symbol, level))
+	}
+
+	return ws.newBaseChannel(channels, nil)
+}
+
+func (ws *WsService) SubscribeFuturesDepthUpdate(symbols []string, interval string) error {
+	if !slices.Contains(FuturesDepthUpdateIntervals, interval) {
+		return fmt.Errorf("invalid depth update interval %q, must be one of %v", interval, FuturesDepthUpdateIntervals)
+	}
+
+	channels := make([]string, 0, len(symbols))
+	for _, symbol := range symbols {
+		channels = append(channels, fmt.Sprintf("%s@%s,%s", ChannelFutureDepthUpdate, symbol, interval))
+	}
+
+	return ws.newBaseChannel(channels, nil)
+}
+
+func (ws *WsService) SubscribeFuturesKline(symbols []string, interval string) error {
+	if !slices.Contains(FuturesKlineIntervals, interval) {
+		return fmt.Errorf("invalid kline interval %q, must be one of %v", interval, FuturesKlineIntervals)
+	}
+
+	channels := make([]string, 0, len(symbols))
+	for _, symbol := range symbols {
+		channels = append(channels, fmt.Sprintf("%s@%s,%s", ChannelFutureKline, symbol, interval))
+	}
+
+	return ws.newBaseChannel(channels, nil)
+}
+
+func (ws *WsService) SubscribeFuturesMarkPrice(symbols []string) error {
+	return ws.newBaseChannel(symbolChannels(ChannelFutureMarkPrice, symbols), nil)
+}
+
+func (ws *WsService) SubscribeFuturesIndexPrice(symbols []string) error {
+	return ws.newBaseChannel(symbolChannels(ChannelFutureIndexPrice, symbols), nil)
+}
+
+func (ws *WsService) SubscribeFuturesFundingRate(symbols []string) error {
+	return ws.newBaseChannel(symbolChannels(ChannelFutureFundingRate, symbols), nil)
+}
+
+// SubscribeFuturesPrivate subscribe user stream topics (balance, position, order, trade, notify),
+// the connection must use FuturesPrivateBaseUrl or CoinFuturesPrivateBaseUrl and ConnConf.ListenKey must be set
+func (ws *WsService) SubscribeFuturesPrivate(topics []string) error {
+	listenKey := ws.GetListenKey()
+	if listenKey == "" {
+		return newListenKeyEmptyErr()
+	}
+
+	channels := make([]string, 0, len(topics))
+	for _, topic := range topics {
+		channels = append(channels, fmt.Sprintf("%s@%s", cmp.Or(futuresPrivateTopics[topic], topic), listenKey))
+	}
+
+	return ws.newBaseChannel(channels, nil)
+}
+
+// NewFuturesTickerCallBack callback for ChannelFutureTicker
+func (ws *WsService) NewFuturesTickerCallBack(f func(*UpdateFuturesTickerMsg)) CallBack {
+	return newTypedCallBack(ws, f)
+}
+
+// NewFuturesTickersCallBack callback for ChannelFutureTickers
+func (ws *WsService) NewFuturesTickersCallBack(f func(*UpdateFuturesTickersMsg)) CallBack {
+	return newTypedCallBack(ws, f)
+}
+
+// NewFuturesAggTickerCallBack callback for ChannelFutureAggTicker
+func (ws *WsService) NewFuturesAggTickerCallBack(f func(*UpdateFuturesAggTickerMsg)) CallBack {
+	return newTypedCallBack(ws, f)
+}
+
+// NewFuturesAggTickersCallBack callback for ChannelFutureAggTickers
+func (ws *WsService) NewFuturesAggTickersCallBack(f func(*UpdateFuturesAggTickersMsg)) CallBack {
+	return newTypedCallBack(ws, f)
+}
+
+// NewFuturesTradeCallBack callback for ChannelFutureTrade on the market stream
+func (ws *WsService) NewFuturesTradeCallBack(f func(*UpdateFuturesTradeMsg)) CallBack {
+	return newTypedCallBack(ws, f)
+}
+
+// NewFuturesDepthCallBack callback for ChannelFutureDepth
+func (ws *WsService) NewFuturesDepthCallBack(f func(*UpdateFuturesDepthMsg)) CallBack {
+	return newTypedCallBack(ws, f)
+}
+
+// NewFuturesDepthUpdateCallBack callback for ChannelFutureDepthUpdate
+func (ws *WsService) NewFuturesDepthUpdateCallBack(f func(*UpdateFuturesDepthUpdateMsg)) CallBack {
+	return newTypedCallBack(ws, f)
+}
+
+// NewFuturesKlineCallBack callback for ChannelFutureKline
+func (ws *WsService) NewFuturesKlineCallBack(f func(*UpdateFuturesKlineMsg)) CallBack {
+	return newTypedCallBack(ws, f)
+}
+
+// NewFuturesMarkPriceCallBack callback for ChannelFutureMarkPrice
+func (ws *WsService) NewFuturesMarkPriceCallBack(f func(*UpdateFuturesMarkPriceMsg)) CallBack {
+	return newTypedCallBack(ws, f)
+}
+
+// NewFuturesIndexPriceCallBack callback for ChannelFutureIndexPrice
+func (ws *WsService) NewFuturesIndexPriceCallBack(f func(*UpdateFuturesIndexPriceMsg)) CallBack {
+	return newTypedCallBack(ws, f)
+}
+
+// NewFuturesFundingRateCallBack callback for ChannelFutureFundingRate
+func (ws *WsService) NewFuturesFundingRateCallBack(f func(*UpdateFuturesFundingRateMsg)) CallBack {
+	return newTypedCallBack(ws, f)
+}
+
+// NewFuturesBalanceCallBack callback for ChannelFutureBalance
+func (ws *WsService) NewFuturesBalanceCallBack(f func(*UpdateFuturesBalanceMsg)) CallBack {
+	return newTypedCallBack(ws, f)
+}
+
+// NewFuturesPositionCallBack callback for ChannelFuturePositions
+func (ws *WsService) NewFuturesPositionCallBack(f func(*UpdateFuturesPositionMsg)) CallBack {
+	return newTypedCallBack(ws, f)
+}
+
+// NewFuturesOrderCallBack callback for ChannelFutureOrder
+func (ws *WsService) NewFuturesOrderCallBack(f func(*UpdateFuturesOrderMsg)) CallBack {
+	return newTypedCallBack(ws, f)
+}
+
+// NewFuturesUserTradeCallBack callback for ChannelFutureUserTrade on the user stream
+func (ws *WsService) NewFuturesUserTradeCallBack(f func(*UpdateFuturesUserTradeMsg)) CallBack {
+	return newTypedCallBack(ws, f)
+}
+
+// NewFuturesNotifyCallBack callback for ChannelFutureNotify
+func (ws *WsService) NewFuturesNotifyCallBack(f func(*UpdateFuturesNotifyMsg)) CallBack {
+	return newTypedCallBack(ws, f)
+}
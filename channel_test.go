@@ -0,0 +1,206 @@
+package xtws
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// newTestService a WsService without connection, enough to build and run callbacks
+func newTestService(logs *bytes.Buffer) *WsService {
+	if logs == nil {
+		logs = new(bytes.Buffer)
+	}
+	return &WsService{
+		Logger:    log.New(logs, "", 0),
+		Ctx:       context.Background(),
+		conf:      getInitConnConf(),
+		calls:     new(sync.Map),
+		listeners: new(sync.Map),
+		listenMu:  new(sync.Mutex),
+		hookMu:    new(sync.Mutex),
+		confMu:    new(sync.RWMutex),
+		pending:   new(sync.Map),
+		rtts:      newWindow(DefaultLatencyWindow),
+		offsets:   newWindow(DefaultLatencyWindow),
+	}
+}
+
+func readFixture(t testing.TB, name string) []byte {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.TrimSpace(b)
+}
+
+func TestSpotPublicCallBacks(t *testing.T) {
+	ws := newTestService(nil)
+
+	tests := []struct {
+		fixture string
+		call    func(check func(topic, event, symbol string)) CallBack
+		topic   string
+		event   string
+		symbol  string
+	}{
+		{
+			fixture: "spot/ticker.json", topic: ChannelSpotTicker, event: "ticker@btc_usdt", symbol: "btc_usdt",
+			call: func(check func(topic, event, symbol string)) CallBack {
+				return ws.NewTickerCallBack(func(msg *UpdateTickerMsg) {
+					check(msg.Topic, msg.Event, msg.Data.Symbol)
+					closePrice, err1 := msg.Data.ClosePrice()
+					rate, err2 := msg.Data.ChangeRate()
+					if err1 != nil || err2 != nil || closePrice.String() != "37499.60" || rate.String() != "-0.0032" {
+						t.Errorf("ticker close %s %v rate %s %v", closePrice, err1, rate, err2)
+					}
+				})
+			},
+		},
+		{
+			fixture: "spot/tickers.json", topic: ChannelSpotTickers, event: "tickers", symbol: "btc_usdt",
+			call: func(check func(topic, event, symbol string)) CallBack {
+				return ws.NewTickersCallBack(func(msg *UpdateTickersMsg) {
+					if len(msg.Data) != 2 || msg.Data[1].Symbol != "eth_usdt" {
+						t.Errorf("tickers %+v", msg.Data)
+						return
+					}
+					check(msg.Topic, msg.Event, msg.Data[0].Symbol)
+				})
+			},
+		},
+		{
+			fixture: "spot/mini_ticker.json", topic: ChannelSpotMiniTicker, event: "mini_ticker@btc_usdt", symbol: "btc_usdt",
+			call: func(check func(topic, event, symbol string)) CallBack {
+				return ws.NewMiniTickerCallBack(func(msg *UpdateMiniTickerMsg) {
+					check(msg.Topic, msg.Event, msg.Data.Symbol)
+					if msg.Data.High != "38010.00" || msg.Data.Volume != "57098123.55" {
+						t.Errorf("mini ticker %+v", msg.Data)
+					}
+				})
+			},
+		},
+		{
+			fixture: "spot/agg_ticker.json", topic: ChannelSpotAggTicker, event: "agg_ticker@btc_usdt", symbol: "btc_usdt",
+			call: func(check func(topic, event, symbol string)) CallBack {
+				return ws.NewAggTickerCallBack(func(msg *UpdateAggTickerMsg) {
+					check(msg.Topic, msg.Event, msg.Data.Symbol)
+					if msg.Data.BidPrice != "37499.50" || msg.Data.AskQty != "1.205" || msg.Data.Close != "37499.60" {
+						t.Errorf("agg ticker %+v", msg.Data)
+					}
+				})
+			},
+		},
+		{
+			fixture: "spot/depth.json", topic: ChannelSpotDeep, event: "depth@btc_usdt,5", symbol: "btc_usdt",
+			call: func(check func(topic, event, symbol string)) CallBack {
+				return ws.NewDepthCallBack(func(msg *UpdateDepthMsg) {
+					check(msg.Topic, msg.Event, msg.Data.Symbol)
+					bid, ok := msg.Data.Bids.Best()
+					if !ok || bid.Price.String() != "37499.50" || len(msg.Data.Asks.Levels()) != 3 {
+						t.Errorf("depth %+v", msg.Data)
+					}
+				})
+			},
+		},
+		{
+			fixture: "spot/depth_update.json", topic: ChannelSpotDepthUpdate, event: "depth_update@btc_usdt", symbol: "btc_usdt",
+			call: func(check func(topic, event, symbol string)) CallBack {
+				return ws.NewDepthUpdateCallBack(func(msg *UpdateDepthIncrMsg) {
+					check(msg.Topic, msg.Event, msg.Data.Symbol)
+					if msg.Data.FirstUpdateID != 12345679 || msg.Data.LastUpdateID != 12345681 {
+						t.Errorf("depth update ids %d %d", msg.Data.FirstUpdateID, msg.Data.LastUpdateID)
+					}
+				})
+			},
+		},
+		{
+			fixture: "spot/trade.json", topic: ChannelSpotTrade, event: "trade@btc_usdt", symbol: "btc_usdt",
+			call: func(check func(topic, event, symbol string)) CallBack {
+				return ws.NewTradeCallBack(func(msg *UpdateTradeMsg) {
+					check(msg.Topic, msg.Event, msg.Data.Symbol)
+					if msg.Data.Price != "37499.60" || !msg.Data.IsBuyerMaker {
+						t.Errorf("trade %+v", msg.Data)
+					}
+				})
+			},
+		},
+		{
+			fixture: "spot/kline.json", topic: ChannelSpotKline, event: "kline@btc_usdt,1m", symbol: "btc_usdt",
+			call: func(check func(topic, event, symbol string)) CallBack {
+				return ws.NewKlineCallBack(func(msg *UpdateKlineMsg) {
+					check(msg.Topic, msg.Event, msg.Data.Symbol)
+					if msg.Data.Interval != "1m" || msg.Data.Time != 1701234540000 {
+						t.Errorf("kline %+v", msg.Data)
+					}
+				})
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			called := false
+			call := tt.call(func(topic, event, symbol string) {
+				called = true
+				if topic != tt.topic || event != tt.event || symbol != tt.symbol {
+					t.Errorf("got %s %s %s, want %s %s %s", topic, event, symbol, tt.topic, tt.event, tt.symbol)
+				}
+			})
+			call(readFixture(t, tt.fixture))
+			if !called {
+				t.Fatal("callback not called")
+			}
+		})
+	}
+}
+
+func TestTypedCallBackLogsDecodeError(t *testing.T) {
+	logs := new(bytes.Buffer)
+	ws := newTestService(logs)
+
+	called := false
+	ws.NewTradeCallBack(func(*UpdateTradeMsg) { called = true })([]byte(`{"topic":"trade","data":{"i":"not a number"}}`))
+	if called {
+		t.Fatal("callback called with an undecodable frame")
+	}
+	if !strings.Contains(logs.String(), "decode xtws.UpdateTradeMsg err") {
+		t.Fatalf("decode error not logged on ws.Logger: %q", logs.String())
+	}
+}
+
+func TestSubscribeKlineInterval(t *testing.T) {
+	ws := newTestService(nil)
+	if err := ws.SubscribeKline([]string{"btc_usdt"}, "2m"); err == nil || !strings.Contains(err.Error(), "invalid kline interval") {
+		t.Fatalf("got %v, want invalid kline interval", err)
+	}
+}
+
+func TestFuturesUserTradeRouting(t *testing.T) {
+	ws := newTestService(nil)
+	ws.conf.App = AppFutures
+	ws.SetListenKey("lk1")
+
+	var public, private int
+	ws.AddCallBack(ChannelFutureTrade, func([]byte) { public++ })
+	ws.AddCallBack(ChannelFutureUserTrade, func([]byte) { private++ })
+
+	ws.handleMsg([]byte(`{"topic":"trade","event":"trade@btc_usdt","data":{"s":"btc_usdt"}}`))
+	ws.handleMsg([]byte(`{"topic":"trade","event":"trade@lk1","data":{"symbol":"btc_usdt"}}`))
+	if public != 1 || private != 1 {
+		t.Fatalf("public %d private %d, want 1 and 1", public, private)
+	}
+
+	// spot connections never reroute
+	ws.conf.App = AppSpot
+	ws.handleMsg([]byte(`{"topic":"trade","event":"trade@lk1","data":{}}`))
+	if public != 2 || private != 1 {
+		t.Fatalf("spot: public %d private %d, want 2 and 1", public, private)
+	}
+}
@@ -1,13 +1,20 @@
 package xtws
 
 import (
+	"compress/flate"
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	mapset "github.com/deckarep/golang-set/v2"
@@ -22,17 +29,49 @@ const (
 	reconnecting
 )
 
+// WsService one connection owned by a single goroutine, see run. Every write goes through its queue,
+// so the methods are safe to call from any goroutine, callbacks included.
 type WsService struct {
-	mu        *sync.Mutex
 	Logger    *log.Logger
 	Ctx       context.Context
-	Client    *websocket.Conn
-	once      *sync.Once
-	loginOnce *sync.Once
+	conn      atomic.Pointer[websocket.Conn] // current connection, replaced by run on reconnect
+	writes    chan writeReq                  // served by run while connected
+	drop      chan struct{}                  // ask run to close the connection and reconnect
+	closed    chan struct{}                  // closed when run returns
+	histMu    *sync.Mutex                    // read-modify-write of conf.subscribeMsg
+	loginMu   *sync.Mutex                    // see login
 	calls     *sync.Map
+	listeners *sync.Map // channel -> []listener, see AddCallBack
+	listenMu  *sync.Mutex
+	listenSeq uint64
+	chanMu    *sync.Mutex
+	chanRefs  map[string]*channelRef // holders per channel, see AcquireChannels
 	conf      *ConnConf
-	status    status
-	clientMu  *sync.Mutex
+	hookMu    *sync.Mutex
+	onReconn  []reconnectHook // copy on write, see OnReconnect
+	hookSeq   uint64
+	risk      []RiskChecker // run by PlaceOrder and AmendOrder, see UseRisk
+	sender    OrderSender   // see UseOrderSender
+	tokens    TokenProvider // see UseTokens
+	topicsMu  *sync.Mutex
+	topics    []string // public channels of ConfigUpdate.Topics
+	deadman   atomic.Pointer[DeadManSwitch]
+	symbols   atomic.Pointer[SymbolRegistry] // see UseSymbols
+	clientIDs atomic.Pointer[ClientOrderIDGenerator]
+	pending   *sync.Map    // client order id -> submit time, see beginSubmit
+	swept     atomic.Int64 // unix nano of the last sweep of expired pending ids
+	persistMu *sync.Mutex
+	callNames map[string]string // channel -> callback name, see SetNamedCallBack
+	restored  *SubscriptionReport
+	restoring atomic.Bool
+	confMu    *sync.RWMutex // URL, Key, Secret, ListenKey, PingInterval and MaxRetryConn of conf
+	pingReset chan struct{} // ping interval changed, see UpdateConfig
+	loggedIn  atomic.Bool   // the listen key was fetched with the credentials, see login
+	status    atomic.Int32
+	deflate   atomic.Bool  // permessage-deflate negotiated on the current connection
+	pingSent  atomic.Int64 // unix nano of the ping waiting for its pong, 0 when none
+	rtts      *window
+	offsets   *window
 }
 
 // ConnConf default URL is spot websocket
@@ -42,21 +81,66 @@ type ConnConf struct {
 	URL              string
 	Key              string
 	Secret           string
+	ListenKey        string // futures user stream, subscribe private topics as {topic}@{listenKey}
 	MaxRetryConn     int
 	SkipTlsVerify    bool
 	ShowReconnectMsg bool
 	PingInterval     string
+
+	// dial options, applied the same way on the first connection and on every reconnect
+	Proxy            string        // http://[user:pass@]host:port or socks5://[user:pass@]host:port, empty uses HTTP_PROXY/HTTPS_PROXY
+	NetDialer        *net.Dialer   // dialer of the tcp connection, e.g. for keep alive or timeout
+	NetDialContext   DialFunc      // custom tcp dial, takes precedence over NetDialer
+	TLSConfig        *tls.Config   // root CAs, client certificates, ServerName (SNI) ...
+	HandshakeTimeout time.Duration // default 45s
+	Header           http.Header   // extra headers of the handshake request
+	LocalAddr        string        // local ip or ip:port to bind
+
+	// EnableCompression request permessage-deflate, the server may still refuse it, see WsService.Compression
+	EnableCompression bool
+	// CompressionLevel flate level of outbound frames, 1 (BestSpeed) .. 9 (BestCompression) or -2 (HuffmanOnly),
+	// 0 keeps the default BestSpeed
+	CompressionLevel int
+
+	Metrics     Metrics       // optional, receives round trips, clock offsets and watchdog events
+	PongTimeout time.Duration // reconnect when a ping gets no pong for this long, checked every ping interval, 0 disables
+
+	// SubscriptionStore persists the subscribed channels and named callbacks, NewWsService restores them
+	SubscriptionStore SubscriptionStore
+	// Subscriptions channels declared in code, listen key channels without the key.
+	// NewWsService reports the difference to the restored channels, see WsService.RestoreReport
+	Subscriptions []string
 }
 
+// DialFunc dials the tcp connection, the proxy if any is dialed through it
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
 type ConfOptions struct {
 	App              string
 	URL              string
 	Key              string
 	Secret           string
+	ListenKey        string
 	MaxRetryConn     int
 	SkipTlsVerify    bool
 	ShowReconnectMsg bool
 	PingInterval     string
+	Proxy            string
+	NetDialer        *net.Dialer
+	NetDialContext   DialFunc
+	TLSConfig        *tls.Config
+	HandshakeTimeout time.Duration
+	Header           http.Header
+	LocalAddr        string
+
+	EnableCompression bool
+	CompressionLevel  int
+
+	Metrics     Metrics
+	PongTimeout time.Duration
+
+	SubscriptionStore SubscriptionStore
+	Subscriptions     []string
 }
 
 func NewWsService(ctx context.Context, logger *log.Logger, conf *ConnConf) (*WsService, error) {
@@ -74,19 +158,17 @@ func NewWsService(ctx context.Context, logger *log.Logger, conf *ConnConf) (*WsS
 		conf = defaultConf
 	}
 
+	dialer, err := conf.NewDialer()
+	if err != nil {
+		return nil, err
+	}
+
 	stop := false
 	retry := 0
 	var conn *websocket.Conn
+	var compressed bool
 	for !stop {
-		dialer := websocket.DefaultDialer
-		header := http.Header{}
-		header.Set("Sec-Websocket-Extensions", "permessage-deflate")
-
-		if conf.SkipTlsVerify {
-			dialer.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
-		}
-
-		c, _, err := dialer.Dial(conf.URL, nil)
+		c, deflate, err := conf.dial(ctx, dialer, conf.URL)
 		if err != nil {
 			if retry >= conf.MaxRetryConn {
 				log.Printf("max reconnect time %d reached, give it up", conf.MaxRetryConn)
@@ -99,6 +181,7 @@ func NewWsService(ctx context.Context, logger *log.Logger, conf *ConnConf) (*WsS
 		} else {
 			stop = true
 			conn = c
+			compressed = deflate
 		}
 	}
 
@@ -107,27 +190,54 @@ func NewWsService(ctx context.Context, logger *log.Logger, conf *ConnConf) (*WsS
 	}
 
 	ws := &WsService{
-		mu:        new(sync.Mutex),
 		conf:      conf,
 		Logger:    logger,
 		Ctx:       ctx,
-		Client:    conn,
+		writes:    make(chan writeReq),
+		drop:      make(chan struct{}, 1),
+		closed:    make(chan struct{}),
+		histMu:    new(sync.Mutex),
 		calls:     new(sync.Map),
-		once:      new(sync.Once),
-		loginOnce: new(sync.Once),
-		status:    connected,
-		clientMu:  new(sync.Mutex),
+		listeners: new(sync.Map),
+		listenMu:  new(sync.Mutex),
+		chanMu:    new(sync.Mutex),
+		chanRefs:  make(map[string]*channelRef),
+		loginMu:   new(sync.Mutex),
+		hookMu:    new(sync.Mutex),
+		topicsMu:  new(sync.Mutex),
+		pending:   new(sync.Map),
+		persistMu: new(sync.Mutex),
+		confMu:    new(sync.RWMutex),
+		pingReset: make(chan struct{}, 1),
+		rtts:      newWindow(DefaultLatencyWindow),
+		offsets:   newWindow(DefaultLatencyWindow),
 	}
+	ws.conn.Store(conn)
+	ws.deflate.Store(compressed)
+	ws.setStatus(connected)
 
-	ws.readMsg()
+	go ws.run(conn)
 	go ws.activePing()
 
+	if conf.SubscriptionStore != nil {
+		// best effort, the caller can still subscribe what is missing
+		report, err := ws.restoreSubscriptions()
+		if err != nil {
+			ws.Logger.Printf("restore subscriptions err:%s", err.Error())
+		}
+		ws.restored = report
+		if report != nil && report.Changed() {
+			ws.Logger.Printf("restored subscriptions differ, missing:%v extra:%v unknown callbacks:%v skipped:%v",
+				report.Missing, report.Extra, report.UnknownCallBacks, report.Skipped)
+		}
+	}
+
 	return ws, nil
 }
 
 func getInitConnConf() *ConnConf {
 	return &ConnConf{
-		App:              "spot",
+		App:              AppSpot,
 		subscribeMsg:     new(sync.Map),
 		MaxRetryConn:     MaxRetryConn,
 		Key:              "",
@@ -145,7 +255,7 @@ func applyOptionConf(defaultConf, userConf *ConnConf) *ConnConf {
 	}
 
 	if userConf.URL == "" {
-		userConf.URL = defaultConf.URL
+		userConf.URL = defaultURL(userConf.App)
 	}
 
 	if userConf.MaxRetryConn == 0 {
@@ -162,7 +272,7 @@ func applyOptionConf(defaultConf, userConf *ConnConf) *ConnConf {
 // NewConnConfFromOption conf from options, recommend using this
 func NewConnConfFromOption(op *ConfOptions) *ConnConf {
 	if op.URL == "" {
-		op.URL = BaseUrl
+		op.URL = defaultURL(op.App)
 	}
 	if op.MaxRetryConn == 0 {
 		op.MaxRetryConn = MaxRetryConn
@@ -173,104 +283,426 @@ func NewConnConfFromOption(op *ConfOptions) *ConnConf {
 		MaxRetryConn:     op.MaxRetryConn,
 		Key:              op.Key,
 		Secret:           op.Secret,
+		ListenKey:        op.ListenKey,
 		URL:              op.URL,
 		SkipTlsVerify:    op.SkipTlsVerify,
 		ShowReconnectMsg: op.ShowReconnectMsg,
 		PingInterval:     op.PingInterval,
+		Proxy:            op.Proxy,
+		NetDialer:        op.NetDialer,
+		NetDialContext:   op.NetDialContext,
+		TLSConfig:        op.TLSConfig,
+		HandshakeTimeout: op.HandshakeTimeout,
+		Header:           op.Header,
+		LocalAddr:        op.LocalAddr,
+
+		EnableCompression: op.EnableCompression,
+		CompressionLevel:  op.CompressionLevel,
+
+		Metrics:     op.Metrics,
+		PongTimeout: op.PongTimeout,
+
+		SubscriptionStore: op.SubscriptionStore,
+		Subscriptions:     op.Subscriptions,
 	}
 }
 
+// NewDialer websocket dialer built from the dial options, a new one on every call
+func (c *ConnConf) NewDialer() (*websocket.Dialer, error) {
+	dialer := &websocket.Dialer{
+		Proxy:             http.ProxyFromEnvironment,
+		HandshakeTimeout:  c.HandshakeTimeout,
+		EnableCompression: c.EnableCompression,
+	}
+	if dialer.HandshakeTimeout <= 0 {
+		dialer.HandshakeTimeout = DefaultHandshakeTimeout
+	}
+	if c.CompressionLevel != 0 && (c.CompressionLevel < flate.HuffmanOnly || c.CompressionLevel > flate.BestCompression) {
+		return nil, fmt.Errorf("invalid compression level %d", c.CompressionLevel)
+	}
+
+	if c.Proxy != "" {
+		u, err := url.Parse(c.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy %q: %w", c.Proxy, err)
+		}
+		switch u.Scheme {
+		case "http", "socks5":
+		case "socks5h":
+			// the socks5 dialer always lets the proxy resolve the host
+			u.Scheme = "socks5"
+		default:
+			return nil, fmt.Errorf("unsupported proxy scheme %q, must be http or socks5", u.Scheme)
+		}
+		dialer.Proxy = http.ProxyURL(u)
+	}
+
+	if c.TLSConfig != nil {
+		dialer.TLSClientConfig = c.TLSConfig.Clone()
+	}
+	if c.SkipTlsVerify {
+		if dialer.TLSClientConfig == nil {
+			dialer.TLSClientConfig = &tls.Config{}
+		}
+		dialer.TLSClientConfig.InsecureSkipVerify = true
+	}
+
+	switch {
+	case c.NetDialContext != nil:
+		if c.LocalAddr != "" {
+			return nil, fmt.Errorf("LocalAddr can not be used with NetDialContext, bind in the dial func instead")
+		}
+		dialer.NetDialContext = c.NetDialContext
+	case c.NetDialer != nil || c.LocalAddr != "":
+		nd := new(net.Dialer)
+		if c.NetDialer != nil {
+			*nd = *c.NetDialer
+		}
+		if c.LocalAddr != "" {
+			addr, err := resolveLocalAddr(c.LocalAddr)
+			if err != nil {
+				return nil, err
+			}
+			nd.LocalAddr = addr
+		}
+		dialer.NetDialContext = nd.DialContext
+	}
+
+	return dialer, nil
+}
+
+// dial one attempt, compressed reports whether permessage-deflate was negotiated
+func (c *ConnConf) dial(ctx context.Context, dialer *websocket.Dialer, url string) (conn *websocket.Conn, compressed bool, err error) {
+	conn, resp, err := dialer.DialContext(ctx, url, c.Header)
+	if err != nil && dialer.EnableCompression && refusedCompression(resp, err) {
+		// only the no context takeover mode is supported, fall back to an uncompressed connection
+		plain := *dialer
+		plain.EnableCompression = false
+		conn, resp, err = plain.DialContext(ctx, url, c.Header)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	compressed = resp != nil && strings.Contains(resp.Header.Get("Sec-Websocket-Extensions"), "permessage-deflate")
+	if compressed && c.CompressionLevel != 0 {
+		if err := conn.SetCompressionLevel(c.CompressionLevel); err != nil {
+			conn.Close()
+			return nil, false, err
+		}
+	}
+	return conn, compressed, nil
+}
+
+// refusedCompression whether the server accepted the upgrade with a permessage-deflate mode the dialer refused,
+// the handshake itself succeeded so the error is not ErrBadHandshake
+func refusedCompression(resp *http.Response, err error) bool {
+	return !errors.Is(err, websocket.ErrBadHandshake) && resp != nil &&
+		resp.StatusCode == http.StatusSwitchingProtocols &&
+		strings.Contains(resp.Header.Get("Sec-Websocket-Extensions"), "permessage-deflate")
+}
+
+// resolveLocalAddr accept an ip with or without port
+func resolveLocalAddr(addr string) (*net.TCPAddr, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "0")
+	}
+	tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid local address %q: %w", addr, err)
+	}
+	return tcpAddr, nil
+}
+
+// defaultURL public market url of app
+func defaultURL(app string) string {
+	switch app {
+	case AppFutures:
+		return FuturesBaseUrl
+	case AppCoinFutures:
+		return CoinFuturesBaseUrl
+	default:
+		return BaseUrl
+	}
+}
+
+func (c *ConnConf) isFutures() bool {
+	return c.App == AppFutures || c.App == AppCoinFutures
+}
+
+// Compression whether permessage-deflate is in use on the current connection
+func (ws *WsService) Compression() bool {
+	return ws.deflate.Load()
+}
+
 func (ws *WsService) GetConnConf() *ConnConf {
 	return ws.conf
 }
 
-func (ws *WsService) reconnect() error {
-	// avoid repeated reconnection
-	if ws.status == reconnecting {
-		return nil
+type writeReq struct {
+	data []byte
+	done chan error
+}
+
+// errConnClosed the connection owner gave up reconnecting
+var errConnClosed = fmt.Errorf("websocket connection closed")
+
+// run own conn: the only goroutine writing to it, closing it and replacing it on reconnect.
+// Reads happen on a reader goroutine per connection, gorilla allows one reader next to one writer.
+func (ws *WsService) run(conn *websocket.Conn) {
+	defer close(ws.closed)
+
+	readErr := make(chan error, 1)
+	go ws.read(conn, readErr)
+
+	for {
+		select {
+		case <-ws.Ctx.Done():
+			ws.Logger.Printf("closing reader")
+			ws.setStatus(disconnected)
+			conn.Close()
+			return
+
+		case req := <-ws.writes:
+			req.done <- conn.WriteMessage(websocket.TextMessage, req.data)
+
+		case <-ws.drop:
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, "reconnect"), time.Now().Add(time.Second))
+			// the reader gets an error and run reconnects
+			conn.Close()
+
+		case err := <-readErr:
+			if ws.Ctx.Err() != nil {
+				// closed on purpose
+				ws.setStatus(disconnected)
+				conn.Close()
+				return
+			}
+			ws.Logger.Printf("websocket err: %s", err.Error())
+			c, err := ws.reconnect(conn)
+			if err != nil {
+				ws.Logger.Printf("reconnect err:%s", err.Error())
+				ws.setStatus(disconnected)
+				return
+			}
+			conn = c
+			ws.Logger.Println("reconnect success, continue read message")
+			go ws.read(conn, readErr)
+			// hooks may write, run them off the owner goroutine
+			go ws.runReconnectHooks()
+		}
 	}
+}
 
-	ws.clientMu.Lock()
-	defer ws.clientMu.Unlock()
+// read conn until it fails, the error goes to run
+func (ws *WsService) read(conn *websocket.Conn, readErr chan<- error) {
+	for {
+		_, rawMsg, err := conn.ReadMessage()
+		if err != nil {
+			readErr <- err
+			return
+		}
+		ws.handleMsg(rawMsg)
+	}
+}
 
-	if ws.Client != nil {
-		ws.Client.Close()
+// write queue data for the connection owner and wait until it is written.
+// Blocks while reconnecting, the frame goes out on the new connection.
+func (ws *WsService) write(data []byte) error {
+	req := writeReq{data: data, done: make(chan error, 1)}
+	select {
+	case ws.writes <- req:
+	case <-ws.closed:
+		return errConnClosed
+	case <-ws.Ctx.Done():
+		return ws.Ctx.Err()
 	}
+	return <-req.done
+}
 
-	ws.status = reconnecting
+// dropConnection close the current connection, run reconnects
+func (ws *WsService) dropConnection() {
+	select {
+	case ws.drop <- struct{}{}:
+	default:
+		// already asked
+	}
+}
 
-	stop := false
+// reconnect dial a replacement of old, resubscribe and log in on it. Only called by run,
+// which owns the new connection exclusively until it serves the write queue again.
+func (ws *WsService) reconnect(old *websocket.Conn) (*websocket.Conn, error) {
+	ws.setStatus(reconnecting)
+	old.Close()
+
+	dialer, err := ws.conf.NewDialer()
+	if err != nil {
+		return nil, err
+	}
+
+	var conn *websocket.Conn
 	retry := 0
-	for !stop {
-		c, _, err := websocket.DefaultDialer.Dial(ws.conf.URL, nil)
+	for conn == nil {
+		c, deflate, err := ws.conf.dial(ws.Ctx, dialer, ws.GetURL())
 		if err != nil {
-			if retry >= ws.conf.MaxRetryConn {
-				ws.Logger.Printf("max reconnect time %d reached, give it up", ws.conf.MaxRetryConn)
-				return err
+			if maxRetry := ws.GetMaxRetryConn(); retry >= maxRetry {
+				ws.Logger.Printf("max reconnect time %d reached, give it up", maxRetry)
+				if d := ws.deadman.Load(); d != nil {
+					d.fire("reconnect given up")
+				}
+				return nil, err
 			}
 			retry++
+			if d := ws.deadman.Load(); d != nil {
+				d.reconnectFailed(retry)
+			}
 			log.Printf("failed to connect to server for the %d time, try again later", retry)
-			time.Sleep(time.Millisecond * (time.Duration(retry) * 500))
+			select {
+			case <-ws.Ctx.Done():
+				return nil, ws.Ctx.Err()
+			case <-time.After(time.Millisecond * (time.Duration(retry) * 500)):
+			}
 			continue
-		} else {
-			stop = true
-			ws.Client = c
 		}
+		conn = c
+		ws.conn.Store(c)
+		ws.deflate.Store(deflate)
+		ws.pingSent.Store(0)
+	}
+
+	// a drop asked for the old connection
+	select {
+	case <-ws.drop:
+	default:
 	}
 
-	ws.status = connected
+	ws.setStatus(connected)
+	if d := ws.deadman.Load(); d != nil {
+		d.reconnected()
+	}
 
-	// resubscribe after reconnect
+	// resubscribe after reconnect, written directly: the queue is not served until run returns to it
 	ws.conf.subscribeMsg.Range(func(key, value interface{}) bool {
 		// key is channel, value is []requestHistory
-		if _, ok := value.([]requestHistory); ok {
-			for _, req := range value.([]requestHistory) {
-				if req.op == nil {
-					req.op = &SubscribeOptions{
-						IsReConnect: true,
-					}
-				} else {
-					req.op.IsReConnect = true
-				}
-				if err := ws.baseSubscribe(req.Method, []string{req.Channel}, req.op); err != nil {
-					ws.Logger.Printf("after reconnect, subscribe channel[%s] err:%s", key.(string), err.Error())
-				} else {
-					if ws.conf.ShowReconnectMsg {
-						ws.Logger.Printf("reconnect channel[%s] success", key.(string))
-					}
-				}
+		for _, req := range value.([]requestHistory) {
+			frame, err := ws.subscribeFrame(req.Method, []string{req.Channel}, req.op)
+			if err == nil {
+				err = conn.WriteMessage(websocket.TextMessage, frame)
+			}
+			if err != nil {
+				ws.Logger.Printf("after reconnect, subscribe channel[%s] err:%s", key.(string), err.Error())
+			} else if ws.conf.ShowReconnectMsg {
+				ws.Logger.Printf("reconnect channel[%s] success", key.(string))
 			}
 		}
 		return true
 	})
 
-	return nil
+	return conn, nil
+}
+
+type reconnectHook struct {
+	id uint64
+	f  func()
+}
+
+func (ws *WsService) runReconnectHooks() {
+	ws.hookMu.Lock()
+	hooks := ws.onReconn
+	ws.hookMu.Unlock()
+	for _, h := range hooks {
+		h.f()
+	}
 }
 
+// OnReconnect f is called after every successful reconnect, once channels are resubscribed.
+// The returned func removes f.
+func (ws *WsService) OnReconnect(f func()) (remove func()) {
+	if f == nil {
+		return func() {}
+	}
+	ws.hookMu.Lock()
+	defer ws.hookMu.Unlock()
+	ws.hookSeq++
+	id := ws.hookSeq
+	// copy on write, runReconnectHooks ranges over the slice without locking
+	ws.onReconn = append(slices.Clip(ws.onReconn), reconnectHook{id: id, f: f})
+
+	return func() {
+		ws.hookMu.Lock()
+		defer ws.hookMu.Unlock()
+		ws.onReconn = slices.DeleteFunc(slices.Clone(ws.onReconn), func(h reconnectHook) bool { return h.id == id })
+	}
+}
+
+// SetKey takes effect on the next login, use UpdateConfig to log in again right away
 func (ws *WsService) SetKey(key string) {
+	ws.confMu.Lock()
+	defer ws.confMu.Unlock()
 	ws.conf.Key = key
 }
 
 func (ws *WsService) GetKey() string {
+	ws.confMu.RLock()
+	defer ws.confMu.RUnlock()
 	return ws.conf.Key
 }
 
 func (ws *WsService) SetSecret(secret string) {
+	ws.confMu.Lock()
+	defer ws.confMu.Unlock()
 	ws.conf.Secret = secret
 }
 
 func (ws *WsService) GetSecret() string {
+	ws.confMu.RLock()
+	defer ws.confMu.RUnlock()
 	return ws.conf.Secret
 }
 
+func (ws *WsService) SetListenKey(listenKey string) {
+	ws.confMu.Lock()
+	defer ws.confMu.Unlock()
+	ws.conf.ListenKey = listenKey
+}
+
+func (ws *WsService) GetListenKey() string {
+	ws.confMu.RLock()
+	defer ws.confMu.RUnlock()
+	return ws.conf.ListenKey
+}
+
 func (ws *WsService) SetMaxRetryConn(max int) {
+	ws.confMu.Lock()
+	defer ws.confMu.Unlock()
 	ws.conf.MaxRetryConn = max
 }
 
 func (ws *WsService) GetMaxRetryConn() int {
+	ws.confMu.RLock()
+	defer ws.confMu.RUnlock()
 	return ws.conf.MaxRetryConn
 }
 
+// GetURL url of the next (re)connect
+func (ws *WsService) GetURL() string {
+	ws.confMu.RLock()
+	defer ws.confMu.RUnlock()
+	return ws.conf.URL
+}
+
+func (ws *WsService) credentials() (key, secret string) {
+	ws.confMu.RLock()
+	defer ws.confMu.RUnlock()
+	return ws.conf.Key, ws.conf.Secret
+}
+
+func (ws *WsService) hasCredentials() bool {
+	key, secret := ws.credentials()
+	return key != "" && secret != ""
+}
+
 func (ws *WsService) GetChannelMarkets(channel string) []string {
 	var markets []string
 	set := mapset.NewSet[string]()
@@ -292,35 +724,49 @@ func (ws *WsService) GetChannels() []string {
 	return channels
 }
 
+// GetConnection current connection, only for inspection: reading, writing or closing it races with the WsService
 func (ws *WsService) GetConnection() *websocket.Conn {
-	return ws.Client
+	return ws.conn.Load()
 }
 
-func (ws *WsService) activePing() {
-	fmt.Println("ping interval:", ws.conf.PingInterval)
+// pingInterval the configured ping interval, DefaultPingInterval when it does not parse
+func (ws *WsService) pingInterval() time.Duration {
+	ws.confMu.RLock()
+	interval := ws.conf.PingInterval
+	ws.confMu.RUnlock()
 
-	du, err := time.ParseDuration(ws.conf.PingInterval)
-	if err != nil {
-		ws.Logger.Printf("failed to parse ping interval: %s, use default ping interval 10s instead", ws.conf.PingInterval)
+	du, err := time.ParseDuration(interval)
+	if err != nil || du <= 0 {
+		ws.Logger.Printf("failed to parse ping interval: %s, use default ping interval 10s instead", interval)
 		du, err = time.ParseDuration(DefaultPingInterval)
 		if err != nil {
 			du = time.Second * 10
 		}
 	}
+	return du
+}
 
-	ticker := time.NewTicker(du)
+func (ws *WsService) activePing() {
+	ticker := time.NewTicker(ws.pingInterval())
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ws.Ctx.Done():
 			return
+		case <-ws.pingReset:
+			ticker.Reset(ws.pingInterval())
 		case <-ticker.C:
-			if ws.status != connected {
+			if ws.getStatus() != connected {
+				continue
+			}
+			if ws.watchdog(time.Now()) {
 				continue
 			}
 
-			err = ws.Client.WriteMessage(websocket.TextMessage, []byte("ping"))
+			// keep the oldest outstanding ping so a late pong is not matched with a newer ping
+			ws.pingSent.CompareAndSwap(0, time.Now().UnixNano())
+			err := ws.write([]byte("ping"))
 			if err != nil {
 				ws.Logger.Printf("wsWrite [ping] err:%s", err.Error())
 			}
@@ -335,5 +781,13 @@ var statusString = map[status]string{
 }
 
 func (ws *WsService) Status() string {
-	return statusString[ws.status]
+	return statusString[ws.getStatus()]
+}
+
+func (ws *WsService) getStatus() status {
+	return status(ws.status.Load())
+}
+
+func (ws *WsService) setStatus(s status) {
+	ws.status.Store(int32(s))
 }
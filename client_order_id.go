@@ -0,0 +1,256 @@
+package xtws
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// ClientOrderIDPrefix every client order id starts with it
+	ClientOrderIDPrefix = "t-"
+	// MaxClientOrderIDLen bytes after ClientOrderIDPrefix
+	MaxClientOrderIDLen = 28
+
+	// DefaultPendingOrderTTL a submission without acknowledgement stops blocking its client order id after this long
+	DefaultPendingOrderTTL = 30 * time.Second
+
+	// clientOrderIDBlock sequence numbers reserved in the store at once
+	clientOrderIDBlock = 1000
+)
+
+// ErrDuplicateOrder an order with the same client order id is still pending
+var ErrDuplicateOrder = errors.New("duplicate client order id")
+
+// ValidClientOrderID check the rules of client order ids: the t- prefix, at most 28 bytes after it,
+// only 0-9, A-Z, a-z, underscore, hyphen and dot
+func ValidClientOrderID(id string) error {
+	body, ok := strings.CutPrefix(id, ClientOrderIDPrefix)
+	if !ok {
+		return fmt.Errorf("client order id %q: missing %s prefix", id, ClientOrderIDPrefix)
+	}
+	if body == "" || len(body) > MaxClientOrderIDLen {
+		return fmt.Errorf("client order id %q: %d bytes after the prefix, must be 1 to %d", id, len(body), MaxClientOrderIDLen)
+	}
+	for _, c := range body {
+		if !validClientOrderIDChar(c) {
+			return fmt.Errorf("client order id %q: invalid character %q", id, c)
+		}
+	}
+	return nil
+}
+
+func validClientOrderIDChar(c rune) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c == '-' || c == '.'
+}
+
+// ClientOrderIDStore persists the sequence of a ClientOrderIDGenerator
+type ClientOrderIDStore interface {
+	// LoadSeq returns 0 when nothing was saved yet
+	LoadSeq() (uint64, error)
+	SaveSeq(seq uint64) error
+}
+
+// FileClientOrderIDStore sequence in a text file, replaced atomically
+type FileClientOrderIDStore struct {
+	Path string
+}
+
+func (s *FileClientOrderIDStore) LoadSeq() (uint64, error) {
+	b, err := os.ReadFile(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+}
+
+func (s *FileClientOrderIDStore) SaveSeq(seq uint64) error {
+	tmp, err := os.CreateTemp(filepath.Dir(s.Path), filepath.Base(s.Path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(strconv.FormatUint(seq, 10)); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.Path)
+}
+
+// MemoryClientOrderIDStore keeps the sequence in memory, ids are only unique within the process
+type MemoryClientOrderIDStore struct {
+	mu  sync.Mutex
+	seq uint64
+}
+
+func (s *MemoryClientOrderIDStore) LoadSeq() (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.seq, nil
+}
+
+func (s *MemoryClientOrderIDStore) SaveSeq(seq uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq = seq
+	return nil
+}
+
+// ClientOrderIDGenerator ids like t-{tag}-{seq base36}. Sequence numbers are reserved in blocks in the
+// store before they are used, so a restart, even after a crash, never reissues an id.
+type ClientOrderIDGenerator struct {
+	tag   string
+	store ClientOrderIDStore
+
+	mu       *sync.Mutex
+	next     uint64
+	reserved uint64 // first sequence number not reserved in the store
+}
+
+// NewClientOrderIDGenerator tag distinguishes processes sharing an account, it may be empty
+func NewClientOrderIDGenerator(tag string, store ClientOrderIDStore) (*ClientOrderIDGenerator, error) {
+	if store == nil {
+		store = new(MemoryClientOrderIDStore)
+	}
+	for _, c := range tag {
+		if !validClientOrderIDChar(c) {
+			return nil, fmt.Errorf("client order id tag %q: invalid character %q", tag, c)
+		}
+	}
+	// room for a separator and 13 base36 digits of a uint64
+	if len(tag) > MaxClientOrderIDLen-14 {
+		return nil, fmt.Errorf("client order id tag %q longer than %d bytes", tag, MaxClientOrderIDLen-14)
+	}
+
+	seq, err := store.LoadSeq()
+	if err != nil {
+		return nil, fmt.Errorf("load client order id seq: %w", err)
+	}
+	return &ClientOrderIDGenerator{tag: tag, store: store, mu: new(sync.Mutex), next: seq, reserved: seq}, nil
+}
+
+// Next a new client order id
+func (g *ClientOrderIDGenerator) Next() (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.next >= g.reserved {
+		reserved := g.next + clientOrderIDBlock
+		if err := g.store.SaveSeq(reserved); err != nil {
+			return "", fmt.Errorf("save client order id seq: %w", err)
+		}
+		g.reserved = reserved
+	}
+	seq := g.next
+	g.next++
+
+	id := ClientOrderIDPrefix
+	if g.tag != "" {
+		id += g.tag + "-"
+	}
+	return id + strconv.FormatUint(seq, 36), nil
+}
+
+// UseClientOrderIDs PlaceOrder assigns an id of g to orders without ClientOrderID
+func (ws *WsService) UseClientOrderIDs(g *ClientOrderIDGenerator) {
+	ws.clientIDs.Store(g)
+}
+
+// OrderAcked release the client order id of a pending submission. PlaceOrder does it once the order is
+// acknowledged or rejected, ids of submissions with an unknown outcome stay pending until an order push
+// seen by ReleaseOrdersFrom or DefaultPendingOrderTTL.
+func (ws *WsService) OrderAcked(clientOrderID string) {
+	ws.pending.Delete(clientOrderID)
+}
+
+// ReleaseOrdersFrom release pending client order ids on the ChannelSpotOrder or ChannelFutureOrder pushes of
+// private, the listen-key connection of the account. The placing connection never gets those pushes.
+func (ws *WsService) ReleaseOrdersFrom(private *WsService) (remove func()) {
+	return private.AddCallBack(ChannelSpotOrder, func(rawMsg []byte) {
+		var msg struct {
+			Data struct {
+				ClientOrderID        string `json:"ci"`
+				FuturesClientOrderID string `json:"clientOrderId"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(rawMsg, &msg); err != nil {
+			ws.Logger.Printf("release order skip push err:%s", err.Error())
+			return
+		}
+		ws.OrderAcked(cmp.Or(msg.Data.ClientOrderID, msg.Data.FuturesClientOrderID))
+	})
+}
+
+// Pending client order ids submitted and not acknowledged yet
+func (ws *WsService) Pending() []string {
+	var ids []string
+	now := time.Now()
+	ws.pending.Range(func(key, value any) bool {
+		if now.Sub(value.(time.Time)) < DefaultPendingOrderTTL {
+			ids = append(ids, key.(string))
+		}
+		return true
+	})
+	return ids
+}
+
+// beginSubmit assign a client order id and mark it pending, ErrDuplicateOrder while an earlier submission is pending
+func (ws *WsService) beginSubmit(o *OrderIntent) error {
+	if o.ClientOrderID == "" {
+		g := ws.clientIDs.Load()
+		if g == nil {
+			return nil
+		}
+		id, err := g.Next()
+		if err != nil {
+			return err
+		}
+		o.ClientOrderID = id
+	}
+	if err := ValidClientOrderID(o.ClientOrderID); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	ws.sweepPending(now)
+	if v, loaded := ws.pending.LoadOrStore(o.ClientOrderID, now); loaded {
+		// expired, the earlier submission was lost. Of concurrent retries only the one swapping it goes on.
+		if now.Sub(v.(time.Time)) < DefaultPendingOrderTTL || !ws.pending.CompareAndSwap(o.ClientOrderID, v, now) {
+			return fmt.Errorf("%w %s", ErrDuplicateOrder, o.ClientOrderID)
+		}
+	}
+	return nil
+}
+
+// sweepPending forget the expired pending ids, at most once per DefaultPendingOrderTTL
+func (ws *WsService) sweepPending(now time.Time) {
+	last := ws.swept.Load()
+	if now.Sub(time.Unix(0, last)) < DefaultPendingOrderTTL || !ws.swept.CompareAndSwap(last, now.UnixNano()) {
+		return
+	}
+	ws.pending.Range(func(key, value any) bool {
+		if now.Sub(value.(time.Time)) >= DefaultPendingOrderTTL {
+			// a retry may have renewed it meanwhile
+			ws.pending.CompareAndDelete(key, value)
+		}
+		return true
+	})
+}
@@ -0,0 +1,104 @@
+package xtws
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPlaceOrderReleasesAckedID(t *testing.T) {
+	ws, _ := newOrderService(t, newOrderServer(t), RiskConf{})
+
+	for range 2 {
+		o := limitOrder("buy", "30000", "0.1")
+		o.ClientOrderID = "t-1"
+		if _, err := ws.PlaceOrder(context.Background(), o); err != nil {
+			t.Fatal(err)
+		}
+		if len(ws.Pending()) != 0 {
+			t.Fatalf("pending %v after the ack", ws.Pending())
+		}
+	}
+}
+
+func TestPendingReleasedFromPrivateStream(t *testing.T) {
+	s := newOrderServer(t)
+	ws, _ := newOrderService(t, s, RiskConf{})
+	private := newTestService(nil)
+	remove := ws.ReleaseOrdersFrom(private)
+	defer remove()
+
+	// no response, the order may have been placed
+	s.srv.Close()
+	o := limitOrder("buy", "30000", "0.1")
+	o.ClientOrderID = "t-1"
+	if _, err := ws.PlaceOrder(context.Background(), o); err == nil {
+		t.Fatal("order sent to a closed server")
+	}
+	if _, err := ws.PlaceOrder(context.Background(), o); !errors.Is(err, ErrDuplicateOrder) {
+		t.Fatalf("retry got %v, want ErrDuplicateOrder", err)
+	}
+
+	ws.handleMsg([]byte(finalOrderPush))
+	if len(ws.Pending()) != 1 {
+		t.Fatal("id released by a push on the placing connection")
+	}
+	private.handleMsg([]byte(finalOrderPush))
+	if len(ws.Pending()) != 0 {
+		t.Fatalf("pending %v after the push on the private stream", ws.Pending())
+	}
+}
+
+func TestBeginSubmitExpired(t *testing.T) {
+	ws := newTestService(nil)
+	ws.pending.Store("t-1", time.Now().Add(-DefaultPendingOrderTTL))
+	// no sweep, the retries find the expired entry
+	ws.swept.Store(time.Now().UnixNano())
+
+	var wg sync.WaitGroup
+	var ok atomic.Int32
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := ws.beginSubmit(&OrderIntent{ClientOrderID: "t-1"})
+			if err == nil {
+				ok.Add(1)
+			} else if !errors.Is(err, ErrDuplicateOrder) {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if ok.Load() != 1 {
+		t.Fatalf("%d retries of an expired id went on, want 1", ok.Load())
+	}
+}
+
+func TestSweepPending(t *testing.T) {
+	ws := newTestService(nil)
+	ws.pending.Store("t-old", time.Now().Add(-DefaultPendingOrderTTL))
+	ws.pending.Store("t-new", time.Now())
+
+	if err := ws.beginSubmit(&OrderIntent{ClientOrderID: "t-2"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ws.pending.Load("t-old"); ok {
+		t.Fatal("expired id not swept")
+	}
+	for _, id := range []string{"t-new", "t-2"} {
+		if _, ok := ws.pending.Load(id); !ok {
+			t.Fatalf("%s swept", id)
+		}
+	}
+
+	// the next sweep waits a TTL
+	ws.pending.Store("t-old", time.Now().Add(-DefaultPendingOrderTTL))
+	ws.beginSubmit(&OrderIntent{ClientOrderID: "t-3"})
+	if _, ok := ws.pending.Load("t-old"); !ok {
+		t.Fatal("swept twice within a TTL")
+	}
+}
@@ -0,0 +1,410 @@
+package xtws
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func wsURL(srv *httptest.Server) string { return "ws" + strings.TrimPrefix(srv.URL, "http") }
+
+// countConn counts the bytes read from the wire
+type countConn struct {
+	net.Conn
+	n *atomic.Int64
+}
+
+func (c countConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+func TestDialCompressionFallback(t *testing.T) {
+	var dials atomic.Int32
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		dials.Add(1)
+		if !strings.Contains(r.Header.Get("Sec-Websocket-Extensions"), "permessage-deflate") {
+			if c, err := upgrader.Upgrade(w, r, nil); err == nil {
+				io.Copy(io.Discard, c.UnderlyingConn())
+			}
+			return
+		}
+
+		// accept the upgrade with context takeover, a mode the dialer does not support
+		conn, rw, _ := w.(http.Hijacker).Hijack()
+		defer conn.Close()
+		h := sha1.Sum([]byte(r.Header.Get("Sec-Websocket-Key") + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+			"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(h[:]) + "\r\n" +
+			"Sec-WebSocket-Extensions: permessage-deflate\r\n\r\n")
+		rw.Flush()
+	}))
+	defer srv.Close()
+
+	conf := NewConnConfFromOption(&ConfOptions{URL: wsURL(srv), EnableCompression: true})
+	dialer, err := conf.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, compressed, err := conf.dial(context.Background(), dialer, conf.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if compressed || dials.Load() != 2 {
+		t.Fatalf("compressed %v after %d dials, want a plain connection on the second dial", compressed, dials.Load())
+	}
+}
+
+func TestDialBadHandshake(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	conf := NewConnConfFromOption(&ConfOptions{URL: wsURL(srv), EnableCompression: true})
+	dialer, _ := conf.NewDialer()
+	if _, _, err := conf.dial(context.Background(), dialer, conf.URL); err != websocket.ErrBadHandshake {
+		t.Fatalf("got %v, want ErrBadHandshake", err)
+	}
+}
+
+// BenchmarkReceiveDepth depth frames pushed by a local server through WsService dispatch,
+// wire-B/op is the size read from the socket per message
+func BenchmarkReceiveDepth(b *testing.B) {
+	for _, deflate := range []bool{false, true} {
+		b.Run("deflate="+strconv.FormatBool(deflate), func(b *testing.B) {
+			benchmarkReceive(b, deflate, readFixture(b, "spot/depth.json"))
+		})
+	}
+}
+
+func benchmarkReceive(b *testing.B, deflate bool, frame []byte) {
+	upgrader := websocket.Upgrader{EnableCompression: deflate}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		n, _ := strconv.Atoi(r.URL.Query().Get("n"))
+
+		// push once subscribed
+		for {
+			_, msg, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			if strings.Contains(string(msg), Subscribe) {
+				break
+			}
+		}
+		pm, _ := websocket.NewPreparedMessage(websocket.TextMessage, frame)
+		for range n {
+			if c.WritePreparedMessage(pm) != nil {
+				return
+			}
+		}
+		io.Copy(io.Discard, c.UnderlyingConn())
+	}))
+	defer srv.Close()
+
+	var wire atomic.Int64
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ws, err := NewWsService(ctx, log.New(io.Discard, "", 0), NewConnConfFromOption(&ConfOptions{
+		URL:               wsURL(srv) + "?n=" + strconv.Itoa(b.N),
+		EnableCompression: deflate,
+		NetDialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			c, err := new(net.Dialer).DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			return countConn{Conn: c, n: &wire}, nil
+		},
+	}))
+	if err != nil {
+		b.Fatal(err)
+	}
+	if ws.Compression() != deflate {
+		b.Fatalf("compression %v, want %v", ws.Compression(), deflate)
+	}
+
+	done := make(chan struct{})
+	var got int
+	ws.AddCallBack("depth", func([]byte) {
+		if got++; got == b.N {
+			close(done)
+		}
+	})
+
+	b.SetBytes(int64(len(frame)))
+	b.ReportAllocs()
+	handshake := wire.Load()
+	b.ResetTimer()
+	if err := ws.Subscribe([]string{"depth@btc_usdt,5"}); err != nil {
+		b.Fatal(err)
+	}
+	<-done
+	b.StopTimer()
+	b.ReportMetric(float64(wire.Load()-handshake)/float64(b.N), "wire-B/op")
+}
+
+// testServer fake XT stream: accepts any request, answers pings unless silent and pushes a trade
+// every publish interval (0 for none). It records the requests and the channels of every connection.
+type testServer struct {
+	*httptest.Server
+	publish time.Duration
+	conns   atomic.Int64
+	pings   atomic.Int64
+	silent  atomic.Bool // no pongs
+
+	mu       *sync.Mutex
+	latest   *websocket.Conn
+	subs     map[*websocket.Conn]map[string]bool
+	requests []Request
+}
+
+func newTestServer(t *testing.T, publish time.Duration) *testServer {
+	s := &testServer{publish: publish, mu: new(sync.Mutex), subs: make(map[*websocket.Conn]map[string]bool)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// dial a WsService to the server, closed with the test
+func (s *testServer) dial(t *testing.T, op *ConfOptions) *WsService {
+	t.Helper()
+	if op == nil {
+		op = &ConfOptions{}
+	}
+	op.URL = cmp.Or(op.URL, wsURL(s.Server))
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	ws, err := NewWsService(ctx, log.New(io.Discard, "", 0), NewConnConfFromOption(op))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ws
+}
+
+func (s *testServer) serve(w http.ResponseWriter, r *http.Request) {
+	up := websocket.Upgrader{}
+	c, err := up.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	s.conns.Add(1)
+	s.mu.Lock()
+	s.latest = c
+	s.subs[c] = make(map[string]bool)
+	s.mu.Unlock()
+
+	wmu := new(sync.Mutex)
+	done := make(chan struct{})
+	defer func() {
+		close(done)
+		c.Close()
+		s.mu.Lock()
+		delete(s.subs, c)
+		s.mu.Unlock()
+	}()
+
+	if s.publish > 0 {
+		go func() {
+			frame := []byte(`{"topic":"trade","event":"trade@btc_usdt","data":{"s":"btc_usdt","i":"1","t":1700000000000,"p":"1","q":"1","b":true}}`)
+			ticker := time.NewTicker(s.publish)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+				}
+				wmu.Lock()
+				err := c.WriteMessage(websocket.TextMessage, frame)
+				wmu.Unlock()
+				if err != nil {
+					return
+				}
+			}
+		}()
+	}
+
+	for {
+		_, msg, err := c.ReadMessage()
+		if err != nil {
+			return
+		}
+		if string(msg) == "ping" {
+			s.pings.Add(1)
+			if !s.silent.Load() {
+				wmu.Lock()
+				c.WriteMessage(websocket.TextMessage, []byte("pong"))
+				wmu.Unlock()
+			}
+			continue
+		}
+		var req Request
+		if err := json.Unmarshal(msg, &req); err != nil {
+			continue
+		}
+		method := strings.ToLower(req.Method)
+		s.mu.Lock()
+		s.requests = append(s.requests, req)
+		if method == Subscribe || method == UnSubscribe {
+			for _, channel := range req.Params {
+				s.subs[c][channel] = method == Subscribe
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// subscribed channels of the newest connection, sorted
+func (s *testServer) subscribed() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var channels []string
+	for channel, on := range s.subs[s.latest] {
+		if on {
+			channels = append(channels, channel)
+		}
+	}
+	slices.Sort(channels)
+	return channels
+}
+
+// received requests so far
+func (s *testServer) received() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.requests)
+}
+
+// waitFor poll cond until it holds or a second passed
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !cond(); time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+// TestStress Subscribe, UnSubscribe and APIRequest from many goroutines while the connection is dropped,
+// meant for go test -race. The connection after the load must carry exactly the subscribed channels.
+func TestStress(t *testing.T) {
+	const workers, channels = 8, 4
+	duration := 2 * time.Second
+	if testing.Short() {
+		duration = 200 * time.Millisecond
+	}
+
+	srv := newTestServer(t, time.Millisecond)
+	ws := srv.dial(t, &ConfOptions{
+		Key:          "key",
+		Secret:       "secret",
+		MaxRetryConn: 100,
+		PingInterval: "20ms",
+		PongTimeout:  time.Second,
+	})
+	ws.UseTokens(TokenProviderFunc(func(context.Context) (string, time.Time, error) { return "lk", time.Time{}, nil }))
+
+	var received, reconnects atomic.Int64
+	ws.OnReconnect(func() { reconnects.Add(1) })
+	ws.AddCallBack(ChannelSpotTrade, func([]byte) { received.Add(1) })
+
+	loadCtx, stop := context.WithTimeout(ws.Ctx, duration)
+	defer stop()
+	go func() {
+		for {
+			select {
+			case <-loadCtx.Done():
+				return
+			case <-time.After(time.Duration(20+rand.IntN(50)) * time.Millisecond):
+				ws.dropConnection()
+			}
+		}
+	}()
+
+	// each worker owns its channels, want holds what it subscribed last
+	want := make([]map[string]bool, workers)
+	var wg sync.WaitGroup
+	for w := range workers {
+		want[w] = make(map[string]bool)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for loadCtx.Err() == nil {
+				channel := fmt.Sprintf("trade@s%d_%d", w, rand.IntN(channels))
+				var err error
+				if want[w][channel] {
+					err = ws.UnSubscribe([]string{channel})
+				} else {
+					err = ws.Subscribe([]string{channel})
+				}
+				if err != nil {
+					// the connection died under the write, run is about to reconnect
+					time.Sleep(time.Millisecond)
+					continue
+				}
+				want[w][channel] = !want[w][channel]
+
+				remove := ws.AddCallBack(channel, func([]byte) {})
+				ws.APIRequest("stress", map[string]any{"id": strconv.Itoa(w)})
+				_ = ws.Status()
+				_ = ws.Latency()
+				remove()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// settle on a fresh connection
+	conns := srv.conns.Load()
+	ws.dropConnection()
+	var expect []string
+	for _, m := range want {
+		for channel, on := range m {
+			if on {
+				expect = append(expect, channel)
+			}
+		}
+	}
+	slices.Sort(expect)
+
+	var got []string
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		if got = srv.subscribed(); srv.conns.Load() > conns && slices.Equal(got, expect) && ws.Status() == "connected" {
+			break
+		}
+	}
+	if !slices.Equal(got, expect) {
+		t.Fatalf("server has %d channels subscribed, want %d:\n got %v\nwant %v", len(got), len(expect), got, expect)
+	}
+	if received.Load() == 0 || reconnects.Load() == 0 {
+		t.Fatalf("received %d frames over %d reconnects", received.Load(), reconnects.Load())
+	}
+	t.Logf("received %d frames, %d reconnects, %d connections", received.Load(), reconnects.Load(), srv.conns.Load())
+}
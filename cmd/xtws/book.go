@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	xtws "github.com/liuhengloveyou/xtws-go"
+)
+
+func runBook(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("book", flag.ExitOnError)
+	var conn connFlags
+	conn.register(fs)
+	levels := fs.Int("levels", 5, "depth levels to subscribe: 5, 10, 20 or 50")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: xtws book [flags] symbol\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("need exactly one symbol")
+	}
+
+	// the pushes carry the XT spelling, e.g. btc_usdt for BTC-USDT or BTCUSDT. The registry lists
+	// spot symbols, for the futures apps only the spelling is normalized.
+	symbols := xtws.NewSymbolRegistry(&xtws.RestSymbolLoader{})
+	if conn.app == xtws.AppSpot {
+		if err := symbols.Load(ctx); err != nil {
+			fmt.Fprintf(os.Stderr, "load symbols err:%s, only the spelling is normalized\n", err.Error())
+		}
+	}
+	symbol, err := symbols.Normalize(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	ws, err := conn.connect(ctx)
+	if err != nil {
+		return err
+	}
+	ws.UseSymbols(symbols)
+
+	ws.AddCallBack(xtws.ChannelSpotDeep, ws.NewDepthCallBack(func(msg *xtws.UpdateDepthMsg) {
+		if msg.Data.Symbol != symbol {
+			return
+		}
+		bid, okBid := msg.Data.Bids.Best()
+		ask, okAsk := msg.Data.Asks.Best()
+		if !okBid || !okAsk {
+			return
+		}
+
+		spread := ask.Price.Sub(bid.Price)
+		mid := ask.Price.Add(bid.Price).Div(xtws.NewDecimalFromInt(2), bid.Price.Places()+1)
+		bps := xtws.Decimal{}
+		if !mid.IsZero() {
+			bps = spread.Mul(xtws.NewDecimalFromInt(10000)).Div(mid, 2)
+		}
+
+		// redraw one line in place
+		// price x quantity on both sides
+		fmt.Fprintf(os.Stdout, "\r\033[K%s %s  bid %s x %s | ask %s x %s  spread %s (%s bps)",
+			time.UnixMilli(msg.Data.Time).Format("15:04:05.000"), symbol,
+			bid.Price, bid.Quantity, ask.Price, ask.Quantity, spread, bps)
+	}))
+
+	if err := ws.SubscribeDepth([]string{symbol}, *levels); err != nil {
+		return err
+	}
+
+	<-ctx.Done()
+	fmt.Fprintln(os.Stdout)
+	return nil
+}
@@ -0,0 +1,136 @@
+// xtws command line client for XT websocket streams
+//
+//	xtws sub [flags] channel...      print messages, e.g. xtws sub ticker@btc_usdt depth@btc_usdt,5
+//	xtws book [flags] symbol         live top of book
+//	xtws record [flags] channel...   record messages to rotating files
+//	xtws replay [flags] file...      replay recorded files to stdout or a local websocket
+//	xtws ping [flags]                websocket round trip latency
+//	xtws relay [flags]               local fan-out websocket relay
+//
+// XT_API_KEY and XT_API_SECRET are read from the environment.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	xtws "github.com/liuhengloveyou/xtws-go"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(ctx context.Context, args []string) error
+}
+
+var commands = []command{
+	{"sub", "subscribe channels and print messages", runSub},
+	{"book", "live top of book display for a symbol", runBook},
+	{"record", "record channels to rotating files", runRecord},
+	{"replay", "replay recorded files to stdout or a local websocket", runReplay},
+	{"ping", "websocket round trip latency probe", runPing},
+	{"relay", "serve one upstream connection to many local websocket clients", runRelay},
+}
+
+func main() {
+	log.SetOutput(os.Stderr)
+
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	for _, cmd := range commands {
+		if cmd.name != os.Args[1] {
+			continue
+		}
+		if err := cmd.run(ctx, os.Args[2:]); err != nil {
+			log.Printf("%s: %s", cmd.name, err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: xtws <command> [flags] [args]\n\ncommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", cmd.name, cmd.usage)
+	}
+	fmt.Fprintf(os.Stderr, "\nrun xtws <command> -h for the flags of a command\n")
+}
+
+// connFlags flags shared by the commands that connect to XT
+type connFlags struct {
+	url          string
+	app          string
+	proxy        string
+	localAddr    string
+	insecure     bool
+	compress     bool
+	level        int
+	maxRetry     int
+	pingInterval string
+	quiet        bool
+}
+
+func (c *connFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&c.url, "url", "", "websocket url, default depends on -app")
+	fs.StringVar(&c.app, "app", xtws.AppSpot, "spot, futures or coin_futures")
+	fs.StringVar(&c.proxy, "proxy", "", "proxy url, http://host:port or socks5://host:port, default from HTTP_PROXY/HTTPS_PROXY")
+	fs.StringVar(&c.localAddr, "local-addr", "", "local ip to bind")
+	fs.BoolVar(&c.insecure, "insecure", false, "skip tls certificate verification")
+	fs.BoolVar(&c.compress, "compress", false, "request permessage-deflate")
+	fs.IntVar(&c.level, "compress-level", 0, "flate level of outbound frames, 1..9 or -2, 0 is default")
+	fs.IntVar(&c.maxRetry, "max-retry", 10, "max reconnect attempts before giving up")
+	fs.StringVar(&c.pingInterval, "ping-interval", xtws.DefaultPingInterval, "ping interval")
+	fs.BoolVar(&c.quiet, "quiet", false, "hide reconnect messages")
+}
+
+func (c *connFlags) conf() *xtws.ConnConf {
+	return xtws.NewConnConfFromOption(&xtws.ConfOptions{
+		App:              c.app,
+		URL:              c.url,
+		Key:              os.Getenv("XT_API_KEY"),
+		Secret:           os.Getenv("XT_API_SECRET"),
+		MaxRetryConn:     c.maxRetry,
+		ShowReconnectMsg: !c.quiet,
+		PingInterval:     c.pingInterval,
+		Proxy:            c.proxy,
+		LocalAddr:        c.localAddr,
+		SkipTlsVerify:    c.insecure,
+
+		EnableCompression: c.compress,
+		CompressionLevel:  c.level,
+	})
+}
+
+func (c *connFlags) connect(ctx context.Context) (*xtws.WsService, error) {
+	return xtws.NewWsService(ctx, log.New(os.Stderr, "", log.LstdFlags), c.conf())
+}
+
+// channelTopics topics of channels like depth@btc_usdt,5, callbacks are registered by topic
+func channelTopics(channels []string) []string {
+	var topics []string
+	seen := make(map[string]bool)
+	for _, channel := range channels {
+		topic, _, _ := strings.Cut(channel, "@")
+		if !seen[topic] {
+			seen[topic] = true
+			topics = append(topics, topic)
+		}
+	}
+	return topics
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func runPing(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("ping", flag.ExitOnError)
+	var conn connFlags
+	conn.register(fs)
+	count := fs.Int("count", 10, "number of pings, 0 pings until interrupted")
+	interval := fs.Duration("interval", time.Second, "time between pings")
+	timeout := fs.Duration("timeout", 5*time.Second, "pong timeout")
+	fs.Parse(args)
+
+	conf := conn.conf()
+	dialer, err := conf.NewDialer()
+	if err != nil {
+		return err
+	}
+
+	url := conf.URL
+	start := time.Now()
+	c, _, err := dialer.DialContext(ctx, url, conf.Header)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	fmt.Printf("connected to %s in %s\n", url, time.Since(start).Round(time.Microsecond))
+
+	var rtts []time.Duration
+	for i := 0; *count == 0 || i < *count; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				printPingStats(rtts, i)
+				return nil
+			case <-time.After(*interval):
+			}
+		}
+
+		sent := time.Now()
+		if err := c.WriteMessage(websocket.TextMessage, []byte("ping")); err != nil {
+			return err
+		}
+		c.SetReadDeadline(sent.Add(*timeout))
+		for {
+			_, msg, err := c.ReadMessage()
+			if err != nil {
+				fmt.Printf("seq=%d timeout: %s\n", i, err.Error())
+				printPingStats(rtts, i+1)
+				return err
+			}
+			if string(msg) == "pong" {
+				break
+			}
+		}
+		rtt := time.Since(sent)
+		rtts = append(rtts, rtt)
+		fmt.Printf("seq=%d rtt=%s\n", i, rtt.Round(time.Microsecond))
+	}
+
+	printPingStats(rtts, len(rtts))
+	return nil
+}
+
+func printPingStats(rtts []time.Duration, sent int) {
+	if len(rtts) == 0 {
+		fmt.Printf("%d sent, 0 received\n", sent)
+		return
+	}
+	sorted := slices.Clone(rtts)
+	slices.Sort(sorted)
+
+	var sum time.Duration
+	for _, rtt := range sorted {
+		sum += rtt
+	}
+	fmt.Printf("%d sent, %d received, min/avg/p50/max = %s/%s/%s/%s\n", sent, len(rtts),
+		sorted[0].Round(time.Microsecond), (sum / time.Duration(len(sorted))).Round(time.Microsecond),
+		sorted[len(sorted)/2].Round(time.Microsecond), sorted[len(sorted)-1].Round(time.Microsecond))
+}
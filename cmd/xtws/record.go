@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// record one line of a recording file
+type record struct {
+	TS  int64           `json:"ts"` // receive time, milliseconds
+	Msg json.RawMessage `json:"msg"`
+}
+
+func runRecord(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("record", flag.ExitOnError)
+	var conn connFlags
+	conn.register(fs)
+	dir := fs.String("dir", ".", "output directory")
+	prefix := fs.String("prefix", "xtws", "file name prefix")
+	rotate := fs.Duration("rotate", time.Hour, "start a new file after this duration, 0 disables")
+	maxSize := fs.Int64("max-size", 100<<20, "start a new file after this many bytes, 0 disables")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: xtws record [flags] channel...\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	channels := fs.Args()
+	if len(channels) == 0 {
+		fs.Usage()
+		return fmt.Errorf("no channel")
+	}
+
+	if err := os.MkdirAll(*dir, 0o755); err != nil {
+		return err
+	}
+	w := &rotatingWriter{dir: *dir, prefix: *prefix, rotate: *rotate, maxSize: *maxSize}
+	defer w.Close()
+
+	ws, err := conn.connect(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, topic := range channelTopics(channels) {
+		ws.AddCallBack(topic, func(msg []byte) {
+			line, err := json.Marshal(record{TS: time.Now().UnixMilli(), Msg: msg})
+			if err != nil {
+				log.Printf("record: %s", err.Error())
+				return
+			}
+			if err := w.WriteLine(line); err != nil {
+				log.Printf("record: %s", err.Error())
+			}
+		})
+	}
+	if err := ws.Subscribe(channels); err != nil {
+		return err
+	}
+
+	<-ctx.Done()
+	return nil
+}
+
+// rotatingWriter writes lines to prefix-YYYYmmdd-HHMMSS.jsonl files, rotated by age and size
+type rotatingWriter struct {
+	dir     string
+	prefix  string
+	rotate  time.Duration
+	maxSize int64
+
+	mu     sync.Mutex
+	file   *os.File
+	buf    *bufio.Writer
+	size   int64
+	opened time.Time
+}
+
+func (w *rotatingWriter) WriteLine(line []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := time.Now()
+	if w.file == nil ||
+		(w.rotate > 0 && now.Sub(w.opened) >= w.rotate) ||
+		(w.maxSize > 0 && w.size+int64(len(line))+1 > w.maxSize) {
+		if err := w.open(now); err != nil {
+			return err
+		}
+	}
+
+	n, err := w.buf.Write(append(line, '\n'))
+	w.size += int64(n)
+	if err != nil {
+		return err
+	}
+	return w.buf.Flush()
+}
+
+func (w *rotatingWriter) open(now time.Time) error {
+	w.closeFile()
+
+	name := filepath.Join(w.dir, fmt.Sprintf("%s-%s.jsonl", w.prefix, now.Format("20060102-150405.000")))
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	log.Printf("recording to %s", name)
+
+	w.file, w.buf, w.size, w.opened = f, bufio.NewWriter(f), 0, now
+	return nil
+}
+
+func (w *rotatingWriter) closeFile() {
+	if w.file == nil {
+		return
+	}
+	w.buf.Flush()
+	w.file.Close()
+	w.file = nil
+}
+
+func (w *rotatingWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closeFile()
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recorded lines of the files in dir, one slice per file in the order they were opened
+func recordedFiles(t *testing.T, dir string) [][]string {
+	t.Helper()
+	names, err := filepath.Glob(filepath.Join(dir, "test-*.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(names)
+
+	var files [][]string
+	for _, name := range names {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, strings.Split(strings.TrimSuffix(string(b), "\n"), "\n"))
+	}
+	return files
+}
+
+func TestRotatingWriterSize(t *testing.T) {
+	dir := t.TempDir()
+	w := &rotatingWriter{dir: dir, prefix: "test", maxSize: 20}
+
+	// 10 bytes a line with the newline, two fit in a file
+	for _, line := range []string{"line00001", "line00002", "line00003"} {
+		if err := w.WriteLine([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+		// file names have millisecond resolution
+		time.Sleep(2 * time.Millisecond)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files := recordedFiles(t, dir)
+	if len(files) != 2 || !slices.Equal(files[0], []string{"line00001", "line00002"}) || !slices.Equal(files[1], []string{"line00003"}) {
+		t.Fatalf("files %q", files)
+	}
+}
+
+func TestRotatingWriterAge(t *testing.T) {
+	dir := t.TempDir()
+	w := &rotatingWriter{dir: dir, prefix: "test", rotate: 20 * time.Millisecond}
+	defer w.Close()
+
+	for _, line := range []string{"a", "b"} {
+		if err := w.WriteLine([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(25 * time.Millisecond)
+	if err := w.WriteLine([]byte("c")); err != nil {
+		t.Fatal(err)
+	}
+
+	// every line is flushed, the files are complete before Close
+	files := recordedFiles(t, dir)
+	if len(files) != 2 || !slices.Equal(files[0], []string{"a", "b"}) || !slices.Equal(files[1], []string{"c"}) {
+		t.Fatalf("files %q", files)
+	}
+}
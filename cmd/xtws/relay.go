@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/liuhengloveyou/xtws-go/relay"
+)
+
+func runRelay(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("relay", flag.ExitOnError)
+	var conn connFlags
+	conn.register(fs)
+	listen := fs.String("listen", "127.0.0.1:8081", "local address to serve")
+	path := fs.String("path", "/", "websocket path")
+	buffer := fs.Int("client-buffer", 1024, "messages queued per client")
+	disconnectSlow := fs.Bool("disconnect-slow", false, "disconnect clients whose buffer is full instead of dropping messages")
+	fs.Parse(args)
+
+	ws, err := conn.connect(ctx)
+	if err != nil {
+		return err
+	}
+
+	srv := relay.New(ws, relay.Options{
+		ClientBuffer:   *buffer,
+		DisconnectSlow: *disconnectSlow,
+		Logger:         log.New(os.Stderr, "relay ", log.LstdFlags),
+	})
+
+	mux := http.NewServeMux()
+	mux.Handle(*path, srv)
+	httpSrv := &http.Server{Addr: *listen, Handler: mux}
+
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+		httpSrv.Close()
+	}()
+
+	log.Printf("relaying %s on ws://%s%s", ws.GetConnConf().URL, *listen, *path)
+	if err := httpSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
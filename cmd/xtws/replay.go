@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func runReplay(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	speed := fs.Float64("speed", 1, "replay speed factor, 0 replays without delay")
+	listen := fs.String("listen", "", "serve a local websocket on this address, e.g. 127.0.0.1:8080, instead of printing to stdout")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: xtws replay [flags] file...\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	files := fs.Args()
+	if len(files) == 0 {
+		fs.Usage()
+		return fmt.Errorf("no file")
+	}
+
+	if *listen == "" {
+		return replayFiles(ctx, files, *speed, func(msg []byte) error {
+			_, err := os.Stdout.Write(append(msg, '\n'))
+			return err
+		})
+	}
+
+	return serveReplay(ctx, *listen, files, *speed)
+}
+
+// replayFiles calls send for every recorded message, keeping the recorded gaps divided by speed
+func replayFiles(ctx context.Context, files []string, speed float64, send func(msg []byte) error) error {
+	var last int64
+	for _, name := range files {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+
+		sc := bufio.NewScanner(f)
+		sc.Buffer(make([]byte, 64<<10), 16<<20)
+		for sc.Scan() {
+			var rec record
+			if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+				log.Printf("replay %s: skip malformed line: %s", name, err.Error())
+				continue
+			}
+
+			if speed > 0 && last > 0 && rec.TS > last {
+				select {
+				case <-ctx.Done():
+					f.Close()
+					return nil
+				case <-time.After(time.Duration(float64(time.Duration(rec.TS-last)*time.Millisecond) / speed)):
+				}
+			}
+			last = rec.TS
+
+			if err := send(rec.Msg); err != nil {
+				f.Close()
+				return err
+			}
+		}
+		f.Close()
+		if err := sc.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// serveReplay local websocket speaking the subscribe protocol, every connection gets its own replay
+// of the messages matching the channels it subscribed
+func serveReplay(ctx context.Context, addr string, files []string, speed float64) error {
+	upgrader := websocket.Upgrader{CheckOrigin: func(*http.Request) bool { return true }}
+
+	srv := &http.Server{Addr: addr, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		replayConn(r.Context(), conn, files, speed)
+	})}
+
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+
+	log.Printf("replaying on ws://%s", addr)
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+func replayConn(ctx context.Context, conn *websocket.Conn, files []string, speed float64) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		writeMu  sync.Mutex
+		subMu    sync.Mutex
+		channels = make(map[string]bool)
+		started  = make(chan struct{})
+		once     sync.Once
+	)
+	write := func(msg []byte) error {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		return conn.WriteMessage(websocket.TextMessage, msg)
+	}
+
+	go func() {
+		defer cancel()
+		for {
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if string(msg) == "ping" {
+				write([]byte("pong"))
+				continue
+			}
+
+			var req struct {
+				Id     string   `json:"id"`
+				Method string   `json:"method"`
+				Params []string `json:"params"`
+			}
+			if err := json.Unmarshal(msg, &req); err != nil {
+				continue
+			}
+
+			subMu.Lock()
+			for _, channel := range req.Params {
+				channels[channel] = strings.EqualFold(req.Method, "subscribe")
+			}
+			subMu.Unlock()
+
+			resp, _ := json.Marshal(map[string]any{"id": req.Id, "code": 0, "msg": "success"})
+			write(resp)
+			once.Do(func() { close(started) })
+		}
+	}()
+
+	// wait for the first subscribe so its messages are not missed
+	select {
+	case <-ctx.Done():
+		return
+	case <-started:
+	}
+
+	err := replayFiles(ctx, files, speed, func(msg []byte) error {
+		var frame struct {
+			Event string `json:"event"`
+		}
+		if json.Unmarshal(msg, &frame) == nil && frame.Event != "" {
+			subMu.Lock()
+			ok := channels[frame.Event]
+			subMu.Unlock()
+			if !ok {
+				return nil
+			}
+		}
+		return write(msg)
+	})
+	if err != nil {
+		log.Printf("replay to %s: %s", conn.RemoteAddr(), err.Error())
+		return
+	}
+
+	// keep the connection open like the exchange does, closing it would make clients reconnect and replay again
+	<-ctx.Done()
+}
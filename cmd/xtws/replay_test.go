@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeRecording(t *testing.T, lines ...string) string {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "rec.jsonl")
+	if err := os.WriteFile(name, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestReplayFiles(t *testing.T) {
+	first := writeRecording(t,
+		`{"ts":1000,"msg":{"event":"trade@btc_usdt","n":1}}`,
+		`not json`,
+		`{"ts":1040,"msg":{"event":"trade@btc_usdt","n":2}}`,
+	)
+	second := writeRecording(t, `{"ts":1080,"msg":"pong"}`)
+
+	var got []string
+	send := func(msg []byte) error {
+		got = append(got, string(msg))
+		return nil
+	}
+	want := []string{`{"event":"trade@btc_usdt","n":1}`, `{"event":"trade@btc_usdt","n":2}`, `"pong"`}
+
+	// the recorded gaps of 80ms at double speed, across the files
+	start := time.Now()
+	if err := replayFiles(context.Background(), []string{first, second}, 2, send); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Fatalf("replayed in %s, want at least 40ms", elapsed)
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("sent %q, want %q", got, want)
+	}
+
+	got = nil
+	if err := replayFiles(context.Background(), []string{first, second}, 0, send); err != nil || !slices.Equal(got, want) {
+		t.Fatalf("sent %q err %v without delay", got, err)
+	}
+
+	if err := replayFiles(context.Background(), []string{filepath.Join(t.TempDir(), "missing.jsonl")}, 0, send); err == nil {
+		t.Fatal("missing file replayed")
+	}
+}
+
+func TestReplayFilesStop(t *testing.T) {
+	name := writeRecording(t, `{"ts":1000,"msg":1}`, `{"ts":3601000,"msg":2}`)
+
+	// canceled during the hour long gap
+	ctx, cancel := context.WithCancel(context.Background())
+	var sent int
+	done := make(chan error, 1)
+	go func() {
+		done <- replayFiles(ctx, []string{name}, 1, func([]byte) error {
+			sent++
+			return nil
+		})
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil || sent != 1 {
+			t.Fatalf("sent %d err %v after cancel", sent, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("replay not stopped by the context")
+	}
+
+	// a send error ends the replay
+	errSend := errors.New("closed")
+	sent = 0
+	err := replayFiles(context.Background(), []string{name}, 0, func([]byte) error {
+		sent++
+		return errSend
+	})
+	if !errors.Is(err, errSend) || sent != 1 {
+		t.Fatalf("sent %d err %v", sent, err)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+func runSub(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("sub", flag.ExitOnError)
+	var conn connFlags
+	conn.register(fs)
+	format := fs.String("format", "pretty", "output format: pretty, json or csv")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: xtws sub [flags] channel...\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	channels := fs.Args()
+	if len(channels) == 0 {
+		fs.Usage()
+		return fmt.Errorf("no channel")
+	}
+
+	out, err := newPrinter(*format)
+	if err != nil {
+		return err
+	}
+
+	ws, err := conn.connect(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, topic := range channelTopics(channels) {
+		ws.AddCallBack(topic, func(msg []byte) {
+			out.print(time.Now(), msg)
+		})
+	}
+	if err := ws.Subscribe(channels); err != nil {
+		return err
+	}
+
+	<-ctx.Done()
+	out.flush()
+	return nil
+}
+
+type printer struct {
+	format string
+	mu     sync.Mutex
+	csv    *csv.Writer
+}
+
+func newPrinter(format string) (*printer, error) {
+	p := &printer{format: format}
+	switch format {
+	case "pretty", "json":
+	case "csv":
+		p.csv = csv.NewWriter(os.Stdout)
+		p.csv.Write([]string{"recv_time", "topic", "event", "data"})
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+	return p, nil
+}
+
+func (p *printer) print(recv time.Time, msg []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.format == "json" {
+		os.Stdout.Write(append(bytes.TrimSpace(msg), '\n'))
+		return
+	}
+
+	var frame struct {
+		Topic string          `json:"topic"`
+		Event string          `json:"event"`
+		Data  json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(msg, &frame); err != nil || frame.Topic == "" {
+		// subscribe responses and other control frames
+		frame.Event = "-"
+		frame.Data = msg
+	}
+
+	switch p.format {
+	case "csv":
+		p.csv.Write([]string{strconv.FormatInt(recv.UnixMilli(), 10), frame.Topic, frame.Event, string(frame.Data)})
+		p.csv.Flush()
+	default:
+		var data bytes.Buffer
+		if err := json.Indent(&data, frame.Data, "  ", "  "); err != nil {
+			data.Reset()
+			data.Write(frame.Data)
+		}
+		fmt.Fprintf(os.Stdout, "%s %s\n  %s\n", recv.Format("15:04:05.000"), frame.Event, data.String())
+	}
+}
+
+func (p *printer) flush() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.csv != nil {
+		p.csv.Flush()
+	}
+}
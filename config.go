@@ -0,0 +1,233 @@
+package xtws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ConfigUpdate live changes of UpdateConfig, empty fields are left unchanged
+type ConfigUpdate struct {
+	URL          string `json:"url,omitempty"`          // reconnect to the new url
+	Key          string `json:"key,omitempty"`          // fetch a new listen key when one was fetched with the old credentials
+	Secret       string `json:"secret,omitempty"`       // fetch a new listen key when one was fetched with the old credentials
+	ListenKey    string `json:"listenKey,omitempty"`    // resubscribe the private channels with the new key
+	PingInterval string `json:"pingInterval,omitempty"` // e.g. "10s", the ping ticker is reset
+	MaxRetryConn int    `json:"maxRetryConn,omitempty"`
+	// Topics public channels owned by the config, the difference to the previous Topics is subscribed and
+	// unsubscribed. Channels also subscribed otherwise, e.g. by SubscribeChan, stay until released there.
+	// nil leaves the channels unchanged.
+	Topics []string `json:"topics,omitempty"`
+}
+
+// UpdateConfig apply changes to the running service, safe to call from any goroutine.
+// Everything is validated before anything is applied.
+func (ws *WsService) UpdateConfig(u ConfigUpdate) error {
+	var ping time.Duration
+	if u.PingInterval != "" {
+		du, err := time.ParseDuration(u.PingInterval)
+		if err != nil || du <= 0 {
+			return fmt.Errorf("invalid ping interval %q", u.PingInterval)
+		}
+		ping = du
+	}
+	if (u.Key == "") != (u.Secret == "") {
+		return fmt.Errorf("key and secret must be rotated together")
+	}
+
+	ws.confMu.Lock()
+	urlChanged := u.URL != "" && u.URL != ws.conf.URL
+	authChanged := u.Key != "" && (u.Key != ws.conf.Key || u.Secret != ws.conf.Secret)
+	oldListenKey := ws.conf.ListenKey
+	listenKeyChanged := u.ListenKey != "" && u.ListenKey != oldListenKey
+	if urlChanged {
+		ws.conf.URL = u.URL
+	}
+	if authChanged {
+		ws.conf.Key, ws.conf.Secret = u.Key, u.Secret
+	}
+	if listenKeyChanged {
+		ws.conf.ListenKey = u.ListenKey
+	}
+	if ping > 0 {
+		ws.conf.PingInterval = u.PingInterval
+	}
+	if u.MaxRetryConn > 0 {
+		ws.conf.MaxRetryConn = u.MaxRetryConn
+	}
+	ws.confMu.Unlock()
+
+	if ping > 0 {
+		// the ping loop reads the interval from conf, a pending signal already covers this change
+		select {
+		case ws.pingReset <- struct{}{}:
+		default:
+		}
+	}
+
+	var errs []error
+	if u.Topics != nil {
+		if err := ws.applyTopics(u.Topics); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	// the reconnect resubscribes and logs in again with the new values
+	if urlChanged {
+		ws.Logger.Printf("url changed to %s, reconnect", u.URL)
+		ws.dropConnection()
+		return errors.Join(errs...)
+	}
+
+	if listenKeyChanged {
+		if err := ws.moveListenKey(oldListenKey); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if authChanged && ws.loggedIn.Load() {
+		if err := ws.login(ws.Ctx, true); err != nil {
+			errs = append(errs, fmt.Errorf("log in with new credentials: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// applyTopics subscribe and unsubscribe the difference of topics to the previous Topics, through the
+// channel ref counts shared with SubscribeChan
+func (ws *WsService) applyTopics(topics []string) error {
+	ws.topicsMu.Lock()
+	defer ws.topicsMu.Unlock()
+
+	var add, drop []string
+	for _, topic := range topics {
+		if !slices.Contains(ws.topics, topic) && !slices.Contains(add, topic) {
+			add = append(add, topic)
+		}
+	}
+	for _, channel := range ws.topics {
+		if !slices.Contains(topics, channel) {
+			drop = append(drop, channel)
+		}
+	}
+
+	if len(drop) > 0 {
+		if err := ws.ReleaseChannels(drop); err != nil {
+			return fmt.Errorf("unsubscribe %v: %w", drop, err)
+		}
+		ws.topics = slices.DeleteFunc(ws.topics, func(c string) bool { return slices.Contains(drop, c) })
+	}
+	if len(add) > 0 {
+		if err := ws.AcquireChannels(add); err != nil {
+			return fmt.Errorf("subscribe %v: %w", add, err)
+		}
+		ws.topics = append(ws.topics, add...)
+	}
+	return nil
+}
+
+// moveListenKey resubscribe the spot private channels and move the {topic}@{listenKey} channels to the new key
+func (ws *WsService) moveListenKey(oldKey string) error {
+	newKey := ws.GetListenKey()
+
+	var private, moved, stale []string
+	ws.conf.subscribeMsg.Range(func(key, value any) bool {
+		channel := key.(string)
+		reqs := value.([]requestHistory)
+		if len(reqs) == 0 || reqs[len(reqs)-1].Method != Subscribe {
+			return true
+		}
+		last := reqs[len(reqs)-1]
+		switch {
+		case last.op != nil && last.op.Private:
+			private = append(private, channel)
+		case oldKey != "" && strings.HasSuffix(channel, "@"+oldKey):
+			stale = append(stale, channel)
+			moved = append(moved, strings.TrimSuffix(channel, oldKey)+newKey)
+		}
+		return true
+	})
+
+	if len(private) > 0 {
+		// IsReConnect keeps the subscribe history unchanged
+		if err := ws.SubscribeWithOption(private, &SubscribeOptions{Private: true, IsReConnect: true}); err != nil {
+			return fmt.Errorf("resubscribe private channels: %w", err)
+		}
+	}
+	if len(stale) > 0 {
+		if err := ws.UnSubscribe(stale); err != nil {
+			return fmt.Errorf("unsubscribe old listen key channels: %w", err)
+		}
+		if err := ws.Subscribe(moved); err != nil {
+			return fmt.Errorf("subscribe new listen key channels: %w", err)
+		}
+	}
+	return nil
+}
+
+// WatchConfigFile apply the ConfigUpdate in the JSON file at path now and whenever its
+// modification time changes, checked every interval (default 5s) until ctx is done
+func (ws *WsService) WatchConfigFile(ctx context.Context, path string, interval time.Duration) error {
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+
+	load := func() (time.Time, error) {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+		var u ConfigUpdate
+		if err := json.Unmarshal(b, &u); err != nil {
+			// not retried until the file changes again
+			return info.ModTime(), fmt.Errorf("config %s: %w", path, err)
+		}
+		return info.ModTime(), ws.UpdateConfig(u)
+	}
+
+	modTime, err := load()
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ws.Ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			info, err := os.Stat(path)
+			if err != nil {
+				ws.Logger.Printf("watch config %s err:%s", path, err.Error())
+				continue
+			}
+			if info.ModTime().Equal(modTime) {
+				continue
+			}
+			t, err := load()
+			if !t.IsZero() {
+				modTime = t
+			}
+			if err != nil {
+				ws.Logger.Printf("reload config %s err:%s", path, err.Error())
+				continue
+			}
+			ws.Logger.Printf("reloaded config %s", path)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,198 @@
+package xtws
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// sentWith a request of method for channel was received, with listen key when not empty
+func sentWith(srv *testServer, method, channel, listenKey string) bool {
+	for _, req := range srv.received() {
+		if req.Method == method && slices.Contains(req.Params, channel) && (listenKey == "" || req.ListenKey == listenKey) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestUpdateConfigPing(t *testing.T) {
+	srv := newTestServer(t, 0)
+	ws := srv.dial(t, &ConfOptions{PingInterval: "1h"})
+
+	if err := ws.UpdateConfig(ConfigUpdate{PingInterval: "-1s"}); err == nil {
+		t.Fatal("negative ping interval accepted")
+	}
+	if err := ws.UpdateConfig(ConfigUpdate{PingInterval: "10ms"}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "pings at the new interval", func() bool { return srv.pings.Load() >= 3 })
+}
+
+func TestUpdateConfigPingAfterClose(t *testing.T) {
+	srv := newTestServer(t, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	ws, err := NewWsService(ctx, log.New(io.Discard, "", 0), NewConnConfFromOption(&ConfOptions{URL: wsURL(srv.Server)}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+
+	// the ping loop is gone, concurrent updates must not block
+	done := make(chan struct{})
+	go func() {
+		var wg sync.WaitGroup
+		for range 4 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ws.UpdateConfig(ConfigUpdate{PingInterval: "5s"})
+			}()
+		}
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("UpdateConfig blocked after the service stopped")
+	}
+}
+
+func TestUpdateConfigURL(t *testing.T) {
+	first, second := newTestServer(t, 0), newTestServer(t, 0)
+	ws := first.dial(t, nil)
+	if err := ws.Subscribe([]string{"trade@btc_usdt"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ws.UpdateConfig(ConfigUpdate{URL: wsURL(second.Server)}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the subscriptions on the new url", func() bool {
+		return slices.Equal(second.subscribed(), []string{"trade@btc_usdt"})
+	})
+	if ws.GetURL() != wsURL(second.Server) {
+		t.Fatalf("url %s", ws.GetURL())
+	}
+}
+
+func TestUpdateConfigCredentials(t *testing.T) {
+	srv := newTestServer(t, 0)
+	ws := srv.dial(t, &ConfOptions{Key: "k1", Secret: "s1"})
+	ws.UseTokens(TokenProviderFunc(func(context.Context) (string, time.Time, error) {
+		key, _ := ws.credentials()
+		return "lk-" + key, time.Time{}, nil
+	}))
+
+	// the first private request fetches a listen key with the credentials
+	if err := ws.APIRequest(Subscribe, map[string]any{"id": "1", "params": []string{ChannelSpotBalance}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ws.SubscribeSpotPrivate([]string{ChannelSpotOrder}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the private subscribe", func() bool { return sentWith(srv, Subscribe, ChannelSpotOrder, "lk-k1") })
+
+	if err := ws.UpdateConfig(ConfigUpdate{Key: "k2"}); err == nil {
+		t.Fatal("key rotated without secret")
+	}
+	if err := ws.UpdateConfig(ConfigUpdate{Key: "k2", Secret: "s2"}); err != nil {
+		t.Fatal(err)
+	}
+	if ws.GetListenKey() != "lk-k2" {
+		t.Fatalf("listen key %s after the rotation", ws.GetListenKey())
+	}
+	waitFor(t, "the private channels with the new listen key", func() bool { return sentWith(srv, Subscribe, ChannelSpotOrder, "lk-k2") })
+}
+
+func TestUpdateConfigTopics(t *testing.T) {
+	srv := newTestServer(t, 0)
+	ws := srv.dial(t, nil)
+	expect := func(channels ...string) {
+		t.Helper()
+		slices.Sort(channels)
+		waitFor(t, fmt.Sprintf("channels %v", channels), func() bool { return slices.Equal(srv.subscribed(), channels) })
+	}
+
+	// subscribed outside the config
+	if err := ws.Subscribe([]string{"ticker@eth_usdt"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ws.UpdateConfig(ConfigUpdate{Topics: []string{"trade@btc_usdt", "ticker@eth_usdt"}}); err != nil {
+		t.Fatal(err)
+	}
+	expect("trade@btc_usdt", "ticker@eth_usdt")
+
+	sub, err := SubscribeChan[UpdateTradeMsg](context.Background(), ws, ChannelSpotTrade, []string{"btc_usdt"}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ws.UpdateConfig(ConfigUpdate{Topics: []string{"depth@btc_usdt,5"}}); err != nil {
+		t.Fatal(err)
+	}
+	// trade@btc_usdt is still held by the subscription
+	expect("trade@btc_usdt", "ticker@eth_usdt", "depth@btc_usdt,5")
+
+	sub.Unsubscribe()
+	expect("ticker@eth_usdt", "depth@btc_usdt,5")
+	if err := ws.UpdateConfig(ConfigUpdate{Topics: []string{}}); err != nil {
+		t.Fatal(err)
+	}
+	expect("ticker@eth_usdt")
+}
+
+func TestUpdateConfigListenKey(t *testing.T) {
+	srv := newTestServer(t, 0)
+	ws := srv.dial(t, &ConfOptions{ListenKey: "lk1"})
+
+	if err := ws.Subscribe([]string{"order@lk1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ws.SubscribeSpotPrivate([]string{ChannelSpotBalance}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ws.UpdateConfig(ConfigUpdate{ListenKey: "lk2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "the listen key channels moved", func() bool {
+		return slices.Equal(srv.subscribed(), []string{ChannelSpotBalance, "order@lk2"})
+	})
+	if !sentWith(srv, Subscribe, ChannelSpotBalance, "lk2") {
+		t.Fatal("private channel not resubscribed with the new listen key")
+	}
+}
+
+func TestWatchConfigFile(t *testing.T) {
+	ws := newTestService(nil)
+	path := filepath.Join(t.TempDir(), "conf.json")
+
+	os.WriteFile(path, []byte(`{"maxRetryConn":`), 0o644)
+	if err := ws.WatchConfigFile(context.Background(), path, 10*time.Millisecond); err == nil {
+		t.Fatal("malformed config accepted")
+	}
+
+	os.WriteFile(path, []byte(`{"maxRetryConn":7}`), 0o644)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := ws.WatchConfigFile(ctx, path, 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if ws.GetMaxRetryConn() != 7 {
+		t.Fatalf("max retry %d", ws.GetMaxRetryConn())
+	}
+
+	// reloaded once the modification time changes
+	os.WriteFile(path, []byte(`{"maxRetryConn":9}`), 0o644)
+	future := time.Now().Add(time.Hour)
+	os.Chtimes(path, future, future)
+	waitFor(t, "the reload", func() bool { return ws.GetMaxRetryConn() == 9 })
+}
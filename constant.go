@@ -1,11 +1,27 @@
 package xtws
 
-import "math"
+import (
+	"math"
+	"time"
+)
 
 const (
 	BaseUrl        = "wss://stream.xt.com/public"
 	PrivateBaseUrl = "wss://stream.xt.com/private"
 
+	// https://doc.xt.com/#documentationbaseUrl
+	RestBaseUrl = "https://sapi.xt.com"
+
+	// https://doc.xt.com/#futures_market_websocket_v2base
+	FuturesBaseUrl            = "wss://fstream.xt.com/ws/market" // USDT-M
+	FuturesPrivateBaseUrl     = "wss://fstream.xt.com/ws/user"   // USDT-M
+	CoinFuturesBaseUrl        = "wss://dstream.xt.com/ws/market" // COIN-M
+	CoinFuturesPrivateBaseUrl = "wss://dstream.xt.com/ws/user"   // COIN-M
+
+	// https://doc.xt.com/#futures_documentationbaseUrl
+	FuturesRestBaseUrl     = "https://fapi.xt.com" // USDT-M
+	CoinFuturesRestBaseUrl = "https://dapi.xt.com" // COIN-M
+
 	AuthMethodApiKey = "api_key"
 	MaxRetryConn     = math.MaxInt64
 )
@@ -18,69 +34,69 @@ const (
 	ServiceTypeSpot    = 1
 	ServiceTypeFutures = 2
 
+	// ConnConf.App
+	AppSpot        = "spot"
+	AppFutures     = "futures"      // USDT-M perpetual
+	AppCoinFutures = "coin_futures" // COIN-M perpetual
+
 	DefaultPingInterval = "10s"
+
+	DefaultHandshakeTimeout = 45 * time.Second
 )
 
 // spot channels
+// https://doc.xt.com/#websocket_public_cnsubscribeParam
 const (
-	ChannelSpotDeep   = "depth"
-	ChannelSpotTicker = "ticker"
-
-	// order
-	ChannelSpotLogin          = "spot.login"
-	ChannelSpotOrderAmend     = "spot.order_amend"
-	ChannelSpotOrderCancel    = "spot.order_cancel"
-	ChannelSpotOrderCancelCp  = "spot.order_cancel_cp"
-	ChannelSpotOrderCancelIds = "spot.order_cancel_ids"
-	ChannelSpotOrderPlace     = "spot.order_place"
-	ChannelSpotOrderStatus    = "spot.order_status"
+	ChannelSpotDeep        = "depth"        // depth@{symbol},{levels}
+	ChannelSpotDepthUpdate = "depth_update" // depth_update@{symbol}
+	ChannelSpotTicker      = "ticker"       // ticker@{symbol}
+	ChannelSpotTickers     = "tickers"      // tickers
+	ChannelSpotMiniTicker  = "mini_ticker"  // mini_ticker@{symbol}
+	ChannelSpotAggTicker   = "agg_ticker"   // agg_ticker@{symbol}
+	ChannelSpotTrade       = "trade"        // trade@{symbol}
+	ChannelSpotKline       = "kline"        // kline@{symbol},{interval}
+
+	// private, subscribed with ConnConf.ListenKey on PrivateBaseUrl
+	// https://doc.xt.com/#websocket_private_cnsubscribeParam
+	ChannelSpotBalance   = "balance"
+	ChannelSpotOrder     = "order"
+	ChannelSpotUserTrade = "trade"
 )
 
 // future channels
+// https://doc.xt.com/#futures_market_websocket_v2base
 const (
-	ChannelFutureTicker           = "futures.tickers"
-	ChannelFutureTrade            = "futures.trades"
-	ChannelFutureOrderBook        = "futures.order_book"
-	ChannelFutureBookTicker       = "futures.book_ticker"
-	ChannelFutureOrderBookUpdate  = "futures.order_book_update"
-	ChannelFutureCandleStick      = "futures.candlesticks"
-	ChannelFutureOrder            = "futures.orders"
-	ChannelFutureUserTrade        = "futures.usertrades"
-	ChannelFutureLiquidates       = "futures.liquidates"
-	ChannelFutureAutoDeleverages  = "futures.auto_deleverages"
-	ChannelFuturePositionCloses   = "futures.position_closes"
-	ChannelFutureBalance          = "futures.balances"
-	ChannelFutureReduceRiskLimits = "futures.reduce_risk_limits"
-	ChannelFuturePositions        = "futures.positions"
-	ChannelFutureAutoOrders       = "futures.autoorders"
-
-	// order
-	ChannelFutureLogin           = "futures.login"
-	ChannelFutureOrderAmend      = "futures.order_amend"
-	ChannelFutureOrderCancel     = "futures.order_cancel"
-	ChannelFutureOrderCancelCp   = "futures.order_cancel_cp"
-	ChannelFutureOrderPlace      = "futures.order_place"
-	ChannelFutureOrderBatchPlace = "futures.order_batch_place"
-	ChannelFutureOrderStatus     = "futures.order_status"
-	ChannelFutureOrderList       = "futures.order_list"
+	ChannelFutureTicker      = "ticker"       // ticker@{symbol}
+	ChannelFutureAggTicker   = "agg_ticker"   // agg_ticker@{symbol}
+	ChannelFutureTickers     = "tickers"      // tickers
+	ChannelFutureAggTickers  = "agg_tickers"  // agg_tickers
+	ChannelFutureTrade       = "trade"        // trade@{symbol}
+	ChannelFutureDepth       = "depth"        // depth@{symbol},{levels}
+	ChannelFutureDepthUpdate = "depth_update" // depth_update@{symbol},{interval}
+	ChannelFutureKline       = "kline"        // kline@{symbol},{interval}
+	ChannelFutureMarkPrice   = "mark_price"   // mark_price@{symbol}
+	ChannelFutureIndexPrice  = "index_price"  // index_price@{symbol}
+	ChannelFutureFundingRate = "funding_rate" // funding_rate@{symbol}
+
+	// private, {topic}@{listenKey} on the user stream
+	ChannelFutureBalance   = "balance"
+	ChannelFuturePositions = "position"
+	ChannelFutureOrder     = "order"
+	ChannelFutureUserTrade = "user_trade" // routing key of trade@{listenKey}, public trade frames keep ChannelFutureTrade
+	ChannelFutureNotify    = "notify"
 )
 
-var authChannel = map[string]bool{
-	// // spot
-	// ChannelSpotBalance:        true,
-	// ChannelSpotFundingBalance: true,
-	// ChannelSpotMarginBalance:  true,
-	// ChannelSpotOrder:          true,
-	// ChannelSpotUserTrade:      true,
-
-	// // future
-	// ChannelFutureOrder:            true,
-	// ChannelFutureUserTrade:        true,
-	// ChannelFutureLiquidates:       true,
-	// ChannelFutureAutoDeleverages:  true,
-	// ChannelFuturePositionCloses:   true,
-	// ChannelFutureReduceRiskLimits: true,
-	// ChannelFuturePositions:        true,
-	// ChannelFutureAutoOrders:       true,
-	// ChannelFutureBalance:          true,
-}
+// futuresPrivateTopics wire topic of the private routing keys that differ from it
+var futuresPrivateTopics = map[string]string{ChannelFutureUserTrade: "trade"}
+
+// futuresPrivateRoutes routing key of the private frames of a wire topic shared with a public one
+var futuresPrivateRoutes = map[string]string{"trade": ChannelFutureUserTrade}
+
+// SpotKlineIntervals intervals accepted by kline@{symbol},{interval}
+var SpotKlineIntervals = []string{"1m", "3m", "5m", "15m", "30m", "1h", "2h", "4h", "6h", "8h", "12h", "1d", "3d", "1w", "1M"}
+
+// FuturesKlineIntervals intervals accepted by futures kline@{symbol},{interval}
+var FuturesKlineIntervals = []string{"1m", "5m", "15m", "30m", "1h", "4h", "1d", "1w", "1M"}
+
+// FuturesDepthUpdateIntervals intervals accepted by futures depth_update@{symbol},{interval}
+var FuturesDepthUpdateIntervals = []string{"100ms", "1000ms"}
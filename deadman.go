@@ -0,0 +1,326 @@
+package xtws
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// OrderCanceler cancels resting orders without the websocket, symbols is nil to cancel every symbol
+type OrderCanceler interface {
+	CancelAll(ctx context.Context, symbols []string) error
+}
+
+// OrderCancelerFunc adapts a func to OrderCanceler
+type OrderCancelerFunc func(ctx context.Context, symbols []string) error
+
+func (f OrderCancelerFunc) CancelAll(ctx context.Context, symbols []string) error {
+	return f(ctx, symbols)
+}
+
+// CountdownCanceler server side countdown: the exchange cancels every order when it is not re-armed
+// within timeout, a zero timeout disarms it
+type CountdownCanceler interface {
+	Arm(ctx context.Context, timeout time.Duration) error
+}
+
+// CountdownCancelerFunc adapts a func to CountdownCanceler
+type CountdownCancelerFunc func(ctx context.Context, timeout time.Duration) error
+
+func (f CountdownCancelerFunc) Arm(ctx context.Context, timeout time.Duration) error {
+	return f(ctx, timeout)
+}
+
+// RestOrderCanceler spot cancel all, https://doc.xt.com/#orderopenOrderDel
+type RestOrderCanceler struct {
+	BaseURL    string // default RestBaseUrl
+	Key        string
+	Secret     string
+	BizType    string        // default SPOT
+	RecvWindow time.Duration // default 5s
+	Client     *http.Client
+}
+
+func (c *RestOrderCanceler) CancelAll(ctx context.Context, symbols []string) error {
+	if c.Key == "" || c.Secret == "" {
+		return newAuthEmptyErr()
+	}
+	if symbols == nil {
+		return c.cancel(ctx, "")
+	}
+	for _, symbol := range symbols {
+		if err := c.cancel(ctx, symbol); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *RestOrderCanceler) cancel(ctx context.Context, symbol string) error {
+	base := c.BaseURL
+	if base == "" {
+		base = RestBaseUrl
+	}
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	recvWindow := c.RecvWindow
+	if recvWindow <= 0 {
+		recvWindow = 5 * time.Second
+	}
+
+	params := map[string]string{"bizType": cmp.Or(c.BizType, "SPOT")}
+	if symbol != "" {
+		params["symbol"] = symbol
+	}
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	const path = "/v4/open-order"
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, base+path, strings.NewReader(string(body)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range SignRestHeaders(c.Key, c.Secret, http.MethodDelete, path, "", string(body), recvWindow, time.Now()) {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("cancel all %s: http status %d", symbol, resp.StatusCode)
+	}
+	var res struct {
+		Rc int    `json:"rc"`
+		Mc string `json:"mc"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return err
+	}
+	if res.Rc != 0 {
+		return fmt.Errorf("cancel all %s: %s", symbol, res.Mc)
+	}
+	return nil
+}
+
+type DeadManConf struct {
+	Canceler            OrderCanceler // fallback cancel path, required
+	MaxFailedReconnects int           // trigger after this many failed reconnect attempts, default 1
+	CancelTimeout       time.Duration // default 10s
+	AllSymbols          bool          // cancel every symbol, not only the symbols with orders placed through the WsService
+
+	Countdown        CountdownCanceler // optional server side countdown
+	CountdownTimeout time.Duration     // default 60s, re-armed every third of it while connected
+
+	// OnTrigger called after the cancel-all ran, err is its result
+	OnTrigger func(reason string, err error)
+
+	// Orders private listen-key connection whose final ChannelSpotOrder pushes forget tracked orders,
+	// default the connection the switch is enabled on, which only gets them when it is the private stream
+	Orders *WsService
+	// Tracker forget tracked orders once final in the tracker, used instead of Orders
+	Tracker *OrderTracker
+}
+
+// DeadManSwitch cancels resting orders when the connection is lost, see WsService.EnableDeadManSwitch
+type DeadManSwitch struct {
+	ws   *WsService
+	conf DeadManConf
+
+	mu     *sync.Mutex
+	open   map[string]map[string]bool // symbol -> client order ids of open orders, "" for orders without one
+	fired  atomic.Bool                // triggered during the current outage
+	cancel context.CancelFunc
+	remove func()
+}
+
+// EnableDeadManSwitch track the orders placed with PlaceOrder and cancel them through conf.Canceler
+// when reconnecting fails MaxFailedReconnects times or the pong watchdog closes the connection.
+// Orders are forgotten once final in conf.Tracker, or else on the final ChannelSpotOrder pushes of conf.Orders.
+func (ws *WsService) EnableDeadManSwitch(conf DeadManConf) (*DeadManSwitch, error) {
+	if conf.Canceler == nil {
+		return nil, fmt.Errorf("dead man switch: canceler is nil")
+	}
+	if conf.MaxFailedReconnects <= 0 {
+		conf.MaxFailedReconnects = 1
+	}
+	if conf.CancelTimeout <= 0 {
+		conf.CancelTimeout = 10 * time.Second
+	}
+	if conf.CountdownTimeout <= 0 {
+		conf.CountdownTimeout = time.Minute
+	}
+
+	ctx, cancel := context.WithCancel(ws.Ctx)
+	d := &DeadManSwitch{
+		ws:     ws,
+		conf:   conf,
+		mu:     new(sync.Mutex),
+		open:   make(map[string]map[string]bool),
+		cancel: cancel,
+	}
+	if conf.Tracker != nil {
+		d.remove = conf.Tracker.OnChange(func(o TrackedOrder) {
+			if o.Final() {
+				d.untrack(o.Symbol, o.ClientOrderID)
+			}
+		})
+	} else {
+		orders := cmp.Or(conf.Orders, ws)
+		d.remove = orders.AddCallBack(ChannelSpotOrder, orders.NewSpotOrderCallBack(func(msg *UpdateSpotOrderMsg) {
+			if msg.Data.Final() {
+				d.untrack(msg.Data.Symbol, msg.Data.ClientOrderID)
+			}
+		}))
+	}
+
+	if conf.Countdown != nil {
+		if err := conf.Countdown.Arm(ctx, conf.CountdownTimeout); err != nil {
+			cancel()
+			d.remove()
+			return nil, fmt.Errorf("dead man switch: arm countdown: %w", err)
+		}
+		go d.keepArmed(ctx)
+	}
+
+	if old := ws.deadman.Swap(d); old != nil {
+		old.Disable()
+	}
+	return d, nil
+}
+
+// Disable stop tracking and disarm the server side countdown
+func (d *DeadManSwitch) Disable() {
+	d.ws.deadman.CompareAndSwap(d, nil)
+	d.cancel()
+	d.remove()
+
+	if d.conf.Countdown != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), d.conf.CancelTimeout)
+		defer cancel()
+		if err := d.conf.Countdown.Arm(ctx, 0); err != nil {
+			d.ws.Logger.Printf("dead man switch disarm countdown err:%s", err.Error())
+		}
+	}
+}
+
+// Symbols symbols with tracked open orders, sorted
+func (d *DeadManSwitch) Symbols() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	symbols := make([]string, 0, len(d.open))
+	for symbol := range d.open {
+		symbols = append(symbols, symbol)
+	}
+	slices.Sort(symbols)
+	return symbols
+}
+
+// Trigger run the cancel-all now
+func (d *DeadManSwitch) Trigger(reason string) error {
+	var symbols []string
+	if !d.conf.AllSymbols {
+		symbols = d.Symbols()
+		if len(symbols) == 0 {
+			return nil
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), d.conf.CancelTimeout)
+	defer cancel()
+
+	err := d.conf.Canceler.CancelAll(ctx, symbols)
+	if err != nil {
+		d.ws.Logger.Printf("dead man switch (%s) cancel all err:%s", reason, err.Error())
+	} else {
+		d.ws.Logger.Printf("dead man switch (%s) canceled orders of %v", reason, symbols)
+		d.mu.Lock()
+		for _, symbol := range symbols {
+			delete(d.open, symbol)
+		}
+		if symbols == nil {
+			clear(d.open)
+		}
+		d.mu.Unlock()
+	}
+	if d.conf.OnTrigger != nil {
+		d.conf.OnTrigger(reason, err)
+	}
+	return err
+}
+
+func (d *DeadManSwitch) track(symbol, clientOrderID string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.open[symbol] == nil {
+		d.open[symbol] = make(map[string]bool)
+	}
+	d.open[symbol][clientOrderID] = true
+}
+
+// untrack orders without client order id stay tracked until the next cancel-all
+func (d *DeadManSwitch) untrack(symbol, clientOrderID string) {
+	if clientOrderID == "" {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.open[symbol], clientOrderID)
+	if len(d.open[symbol]) == 0 {
+		delete(d.open, symbol)
+	}
+}
+
+// fire trigger once per outage, without blocking the reader
+func (d *DeadManSwitch) fire(reason string) {
+	if !d.fired.CompareAndSwap(false, true) {
+		return
+	}
+	go d.Trigger(reason)
+}
+
+func (d *DeadManSwitch) reconnectFailed(attempts int) {
+	if attempts >= d.conf.MaxFailedReconnects {
+		d.fire(fmt.Sprintf("%d failed reconnects", attempts))
+	}
+}
+
+func (d *DeadManSwitch) reconnected() {
+	d.fired.Store(false)
+}
+
+// keepArmed re-arm the countdown while the connection is up, once it is down the exchange cancels
+func (d *DeadManSwitch) keepArmed(ctx context.Context) {
+	ticker := time.NewTicker(d.conf.CountdownTimeout / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if d.ws.getStatus() != connected || d.fired.Load() {
+			continue
+		}
+		if err := d.conf.Countdown.Arm(ctx, d.conf.CountdownTimeout); err != nil && ctx.Err() == nil {
+			d.ws.Logger.Printf("dead man switch arm countdown err:%s", err.Error())
+		}
+	}
+}
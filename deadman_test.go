@@ -0,0 +1,68 @@
+package xtws
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+const finalOrderPush = `{"topic":"order","event":"order","data":{"s":"btc_usdt","i":"1","ci":"t-1","st":"FILLED","oq":"0.1","eq":"0.1","p":"30000","t":2}}`
+
+func placeTracked(t *testing.T, conf DeadManConf) (*WsService, *DeadManSwitch) {
+	t.Helper()
+	ws, _ := newOrderService(t, newOrderServer(t), RiskConf{})
+	conf.Canceler = OrderCancelerFunc(func(context.Context, []string) error { return nil })
+	d, err := ws.EnableDeadManSwitch(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(d.Disable)
+
+	o := limitOrder("buy", "30000", "0.1")
+	o.ClientOrderID = "t-1"
+	if _, err := ws.PlaceOrder(context.Background(), o); err != nil {
+		t.Fatal(err)
+	}
+	if got := d.Symbols(); !slices.Equal(got, []string{"btc_usdt"}) {
+		t.Fatalf("tracked %v", got)
+	}
+	return ws, d
+}
+
+func TestDeadManOrdersFromPrivateStream(t *testing.T) {
+	private := newTestService(nil)
+	ws, d := placeTracked(t, DeadManConf{Orders: private})
+
+	// the placing connection never gets private pushes
+	ws.handleMsg([]byte(finalOrderPush))
+	if len(d.Symbols()) != 1 {
+		t.Fatal("order forgotten by a push on the placing connection")
+	}
+	private.handleMsg([]byte(finalOrderPush))
+	if len(d.Symbols()) != 0 {
+		t.Fatalf("tracked %v after the final push on the private stream", d.Symbols())
+	}
+}
+
+func TestDeadManOrdersFromTracker(t *testing.T) {
+	tracker := NewOrderTracker()
+	_, d := placeTracked(t, DeadManConf{Tracker: tracker})
+
+	tracker.Submitted("", TrackedOrder{Symbol: "btc_usdt", ClientOrderID: "t-1"})
+	if len(d.Symbols()) != 1 {
+		t.Fatal("order forgotten while pending")
+	}
+	if err := tracker.ApplyOrder("", &SpotOrderData{Symbol: "btc_usdt", OrderID: "1", ClientOrderID: "t-1", State: OrderStateCanceled,
+		OrigQty: "0.1", ExecutedQty: "0", Price: "30000", Time: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Symbols()) != 0 {
+		t.Fatalf("tracked %v after the tracker saw the order canceled", d.Symbols())
+	}
+
+	// Disable removes the tracker callback
+	d.Disable()
+	if n := len(tracker.onChange); n != 0 {
+		t.Fatalf("%d tracker callbacks after Disable", n)
+	}
+}
@@ -0,0 +1,352 @@
+package xtws
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Decimal exact fixed-point number, value = coef * 10^exp.
+// The zero value is 0 and a Decimal is immutable, every operation returns a new value.
+type Decimal struct {
+	coef *big.Int
+	exp  int32
+}
+
+// MaxDecimalExponent bound of the exponent ParseDecimal accepts, far beyond any price or quantity.
+// It keeps inputs like "1e999999999" from expanding into gigabytes in String.
+const MaxDecimalExponent = 1000
+
+var (
+	bigTen  = big.NewInt(10)
+	bigZero = new(big.Int)
+)
+
+// NewDecimal returns coef * 10^exp
+func NewDecimal(coef int64, exp int32) Decimal {
+	return Decimal{coef: big.NewInt(coef), exp: exp}
+}
+
+// NewDecimalFromInt returns v as a Decimal
+func NewDecimalFromInt(v int64) Decimal {
+	return NewDecimal(v, 0)
+}
+
+// ParseDecimal parse numbers like "123", "-0.0015", "1.5e-3" without losing precision
+func ParseDecimal(s string) (Decimal, error) {
+	str := strings.TrimSpace(s)
+	if str == "" {
+		return Decimal{}, fmt.Errorf("parse decimal: empty string")
+	}
+
+	var exp int64
+	if i := strings.IndexAny(str, "eE"); i >= 0 {
+		e, err := strconv.ParseInt(str[i+1:], 10, 32)
+		if err != nil {
+			return Decimal{}, fmt.Errorf("parse decimal %q: invalid exponent", s)
+		}
+		if e < -MaxDecimalExponent || e > MaxDecimalExponent {
+			return Decimal{}, fmt.Errorf("parse decimal %q: exponent out of range", s)
+		}
+		exp = e
+		str = str[:i]
+	}
+
+	neg := false
+	switch {
+	case strings.HasPrefix(str, "-"):
+		neg = true
+		str = str[1:]
+	case strings.HasPrefix(str, "+"):
+		str = str[1:]
+	}
+
+	intPart, fracPart, hasDot := strings.Cut(str, ".")
+	if intPart == "" && fracPart == "" {
+		return Decimal{}, fmt.Errorf("parse decimal %q: no digits", s)
+	}
+	if hasDot && strings.Contains(fracPart, ".") {
+		return Decimal{}, fmt.Errorf("parse decimal %q: too many dots", s)
+	}
+
+	digits := intPart + fracPart
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return Decimal{}, fmt.Errorf("parse decimal %q: invalid character %q", s, c)
+		}
+	}
+
+	exp -= int64(len(fracPart))
+	if exp < -MaxDecimalExponent || exp > MaxDecimalExponent {
+		return Decimal{}, fmt.Errorf("parse decimal %q: exponent out of range", s)
+	}
+
+	coef, ok := new(big.Int).SetString(digits, 10)
+	if !ok {
+		return Decimal{}, fmt.Errorf("parse decimal %q", s)
+	}
+	if neg {
+		coef.Neg(coef)
+	}
+
+	return Decimal{coef: coef, exp: int32(exp)}, nil
+}
+
+// MustParseDecimal like ParseDecimal but panics on error, for constants
+func MustParseDecimal(s string) Decimal {
+	d, err := ParseDecimal(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// optionalDecimal parse exchange fields that may be left empty, e.g. the price of a market order.
+// Empty is 0, malformed is an error.
+func optionalDecimal(s string) (Decimal, error) {
+	if strings.TrimSpace(s) == "" {
+		return Decimal{}, nil
+	}
+	return ParseDecimal(s)
+}
+
+func (d Decimal) value() *big.Int {
+	if d.coef == nil {
+		return bigZero
+	}
+	return d.coef
+}
+
+// rescale returns the coefficient of d expressed with exponent exp, exp must be <= d.exp
+func (d Decimal) rescale(exp int32) *big.Int {
+	c := new(big.Int).Set(d.value())
+	if exp >= d.exp {
+		return c
+	}
+	m := new(big.Int).Exp(bigTen, big.NewInt(int64(d.exp-exp)), nil)
+	return c.Mul(c, m)
+}
+
+func align(a, b Decimal) (*big.Int, *big.Int, int32) {
+	exp := min(a.exp, b.exp)
+	return a.rescale(exp), b.rescale(exp), exp
+}
+
+func (d Decimal) Add(o Decimal) Decimal {
+	x, y, exp := align(d, o)
+	return Decimal{coef: x.Add(x, y), exp: exp}
+}
+
+func (d Decimal) Sub(o Decimal) Decimal {
+	x, y, exp := align(d, o)
+	return Decimal{coef: x.Sub(x, y), exp: exp}
+}
+
+func (d Decimal) Mul(o Decimal) Decimal {
+	return Decimal{coef: new(big.Int).Mul(d.value(), o.value()), exp: d.exp + o.exp}
+}
+
+// Div returns d / o rounded half away from zero to places decimal places, o must not be zero
+func (d Decimal) Div(o Decimal, places int32) Decimal {
+	if o.IsZero() {
+		panic("xtws: decimal division by zero")
+	}
+	// d / o = (d.coef * 10^k) / o.coef * 10^(d.exp - k - o.exp), pick k so the result has places+1 digits
+	k := int64(d.exp) - int64(o.exp) + int64(places) + 1
+	num := new(big.Int).Set(d.value())
+	if k > 0 {
+		num.Mul(num, new(big.Int).Exp(bigTen, big.NewInt(k), nil))
+	} else if k < 0 {
+		num.Quo(num, new(big.Int).Exp(bigTen, big.NewInt(-k), nil))
+	}
+	q := num.Quo(num, o.value())
+	return Decimal{coef: q, exp: int32(int64(d.exp) - k - int64(o.exp))}.Round(places)
+}
+
+func (d Decimal) Neg() Decimal {
+	return Decimal{coef: new(big.Int).Neg(d.value()), exp: d.exp}
+}
+
+func (d Decimal) Abs() Decimal {
+	return Decimal{coef: new(big.Int).Abs(d.value()), exp: d.exp}
+}
+
+// Sign returns -1, 0 or 1
+func (d Decimal) Sign() int {
+	return d.value().Sign()
+}
+
+func (d Decimal) IsZero() bool {
+	return d.Sign() == 0
+}
+
+// Cmp returns -1 if d < o, 0 if d == o, 1 if d > o
+func (d Decimal) Cmp(o Decimal) int {
+	x, y, _ := align(d, o)
+	return x.Cmp(y)
+}
+
+// Equal compares values, 1.50 equals 1.5
+func (d Decimal) Equal(o Decimal) bool {
+	return d.Cmp(o) == 0
+}
+
+func (d Decimal) LessThan(o Decimal) bool {
+	return d.Cmp(o) < 0
+}
+
+func (d Decimal) GreaterThan(o Decimal) bool {
+	return d.Cmp(o) > 0
+}
+
+func MinDecimal(a, b Decimal) Decimal {
+	if a.Cmp(b) <= 0 {
+		return a
+	}
+	return b
+}
+
+func MaxDecimal(a, b Decimal) Decimal {
+	if a.Cmp(b) >= 0 {
+		return a
+	}
+	return b
+}
+
+// Round rounds half away from zero to places decimal places
+func (d Decimal) Round(places int32) Decimal {
+	if d.exp >= -places {
+		return d
+	}
+	divisor := new(big.Int).Exp(bigTen, big.NewInt(int64(-places-d.exp)), nil)
+	q, r := new(big.Int).QuoRem(d.value(), divisor, new(big.Int))
+	r.Abs(r).Mul(r, big.NewInt(2))
+	if r.Cmp(divisor) >= 0 {
+		if d.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	return Decimal{coef: q, exp: -places}
+}
+
+// Truncate drops digits after places decimal places
+func (d Decimal) Truncate(places int32) Decimal {
+	if d.exp >= -places {
+		return d
+	}
+	divisor := new(big.Int).Exp(bigTen, big.NewInt(int64(-places-d.exp)), nil)
+	return Decimal{coef: new(big.Int).Quo(d.value(), divisor), exp: -places}
+}
+
+// Normalize drop trailing zeros after the decimal point, 1.500 becomes 1.5
+func (d Decimal) Normalize() Decimal {
+	if d.exp >= 0 || d.IsZero() {
+		return d
+	}
+	c := new(big.Int).Set(d.value())
+	exp := d.exp
+	r := new(big.Int)
+	for exp < 0 {
+		q, m := new(big.Int).QuoRem(c, bigTen, r)
+		if m.Sign() != 0 {
+			break
+		}
+		c = q
+		exp++
+	}
+	return Decimal{coef: c, exp: exp}
+}
+
+// Places number of digits after the decimal point
+func (d Decimal) Places() int32 {
+	if d.exp >= 0 {
+		return 0
+	}
+	return -d.exp
+}
+
+// Float64 nearest float64, for display and statistics only
+func (d Decimal) Float64() float64 {
+	f, _ := strconv.ParseFloat(d.String(), 64)
+	return f
+}
+
+// String formats without exponent, keeping trailing zeros of the parsed input
+func (d Decimal) String() string {
+	c := d.value()
+	if d.exp >= 0 {
+		if c.Sign() == 0 {
+			return "0"
+		}
+		return c.String() + strings.Repeat("0", int(d.exp))
+	}
+
+	digits := new(big.Int).Abs(c).String()
+	places := int(-d.exp)
+	if len(digits) <= places {
+		digits = strings.Repeat("0", places-len(digits)+1) + digits
+	}
+
+	var b strings.Builder
+	if c.Sign() < 0 {
+		b.WriteByte('-')
+	}
+	b.WriteString(digits[:len(digits)-places])
+	b.WriteByte('.')
+	b.WriteString(digits[len(digits)-places:])
+	return b.String()
+}
+
+// StringFixed formats with exactly places decimal places
+func (d Decimal) StringFixed(places int32) string {
+	r := d.Round(places)
+	if r.exp > -places {
+		r = Decimal{coef: r.rescale(-places), exp: -places}
+	}
+	return r.String()
+}
+
+// MarshalJSON encodes as a JSON string so no precision is lost
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(d.String())), nil
+}
+
+// UnmarshalJSON accepts JSON strings and numbers, null and "" are 0
+func (d *Decimal) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	if bytes.Equal(b, []byte("null")) {
+		*d = Decimal{}
+		return nil
+	}
+	if len(b) >= 2 && b[0] == '"' && b[len(b)-1] == '"' {
+		b = b[1 : len(b)-1]
+	}
+	if len(b) == 0 {
+		*d = Decimal{}
+		return nil
+	}
+
+	v, err := ParseDecimal(string(b))
+	if err != nil {
+		return err
+	}
+	*d = v
+	return nil
+}
+
+func (d Decimal) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Decimal) UnmarshalText(b []byte) error {
+	v, err := ParseDecimal(string(b))
+	if err != nil {
+		return err
+	}
+	*d = v
+	return nil
+}
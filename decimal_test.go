@@ -0,0 +1,41 @@
+package xtws
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseDecimalExponentRange(t *testing.T) {
+	for _, s := range []string{"1e1000", "1e-1000", "12.5e3"} {
+		if _, err := ParseDecimal(s); err != nil {
+			t.Errorf("%s: %v", s, err)
+		}
+	}
+	for _, s := range []string{"1e1001", "1e-1001", "1e999999999", "0." + strings.Repeat("1", 1001)} {
+		if _, err := ParseDecimal(s); err == nil || !strings.Contains(err.Error(), "out of range") {
+			t.Errorf("%s: got %v, want exponent out of range", s, err)
+		}
+	}
+}
+
+func TestModelDecimalErrors(t *testing.T) {
+	trade := TradeData{Price: "abc", Quantity: "1"}
+	if _, err := trade.TradePrice(); err == nil {
+		t.Fatal("malformed trade price parsed")
+	}
+
+	// empty optional fields are 0, malformed ones are errors
+	order := SpotOrderData{OrigQty: "1", Price: ""}
+	if p, err := order.OrderPrice(); err != nil || !p.IsZero() {
+		t.Fatalf("empty price: %s %v", p, err)
+	}
+	order.Price = "1..2"
+	if _, err := order.OrderPrice(); err == nil {
+		t.Fatal("malformed order price parsed")
+	}
+
+	stats := NewMarketStats(StatsConfig{})
+	if err := stats.AddTrade(trade); err == nil {
+		t.Fatal("market stats accepted a malformed trade")
+	}
+}
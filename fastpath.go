@@ -0,0 +1,474 @@
+package xtws
+
+import (
+	"errors"
+	"sync"
+)
+
+// Hand-written decoding for the hot path. Frames look like
+// {"topic":"depth","event":"depth@btc_usdt,20","data":{...}}, readMsg only needs topic to route,
+// depth and ticker payloads can be decoded into pooled structs without reflection.
+
+var errFastDecode = errors.New("fast decode: unsupported json")
+
+type jsonScanner struct {
+	b []byte
+	i int
+}
+
+func (s *jsonScanner) skipWS() {
+	for s.i < len(s.b) {
+		switch s.b[s.i] {
+		case ' ', '\t', '\n', '\r':
+			s.i++
+		default:
+			return
+		}
+	}
+}
+
+func (s *jsonScanner) consume(c byte) bool {
+	s.skipWS()
+	if s.i < len(s.b) && s.b[s.i] == c {
+		s.i++
+		return true
+	}
+	return false
+}
+
+func (s *jsonScanner) peek() byte {
+	s.skipWS()
+	if s.i < len(s.b) {
+		return s.b[s.i]
+	}
+	return 0
+}
+
+// readString returns the raw bytes between quotes, strings with escapes are not supported
+func (s *jsonScanner) readString() ([]byte, bool) {
+	if !s.consume('"') {
+		return nil, false
+	}
+	start := s.i
+	for s.i < len(s.b) {
+		switch s.b[s.i] {
+		case '\\':
+			return nil, false
+		case '"':
+			str := s.b[start:s.i]
+			s.i++
+			return str, true
+		}
+		s.i++
+	}
+	return nil, false
+}
+
+func (s *jsonScanner) readInt() (int64, bool) {
+	s.skipWS()
+	neg := false
+	if s.i < len(s.b) && s.b[s.i] == '-' {
+		neg = true
+		s.i++
+	}
+	start := s.i
+	var n int64
+	for s.i < len(s.b) && s.b[s.i] >= '0' && s.b[s.i] <= '9' {
+		n = n*10 + int64(s.b[s.i]-'0')
+		s.i++
+	}
+	if s.i == start {
+		return 0, false
+	}
+	// not an integer
+	if s.i < len(s.b) && (s.b[s.i] == '.' || s.b[s.i] == 'e' || s.b[s.i] == 'E') {
+		return 0, false
+	}
+	if neg {
+		n = -n
+	}
+	return n, true
+}
+
+// readNumberOrString returns string contents or the raw number literal
+func (s *jsonScanner) readNumberOrString() ([]byte, bool) {
+	if s.peek() == '"' {
+		return s.readString()
+	}
+	start := s.i
+	if !s.skipValue() {
+		return nil, false
+	}
+	return s.b[start:s.i], true
+}
+
+func (s *jsonScanner) skipValue() bool {
+	s.skipWS()
+	if s.i >= len(s.b) {
+		return false
+	}
+	switch s.b[s.i] {
+	case '"':
+		s.i++
+		for s.i < len(s.b) {
+			switch s.b[s.i] {
+			case '\\':
+				s.i += 2
+				continue
+			case '"':
+				s.i++
+				return true
+			}
+			s.i++
+		}
+		return false
+	case '{', '[':
+		depth := 0
+		for s.i < len(s.b) {
+			switch s.b[s.i] {
+			case '"':
+				if !s.skipValue() {
+					return false
+				}
+				continue
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+				if depth == 0 {
+					s.i++
+					return true
+				}
+			}
+			s.i++
+		}
+		return false
+	default:
+		for s.i < len(s.b) {
+			switch s.b[s.i] {
+			case ',', '}', ']', ' ', '\t', '\n', '\r':
+				return true
+			}
+			s.i++
+		}
+		return true
+	}
+}
+
+// object calls f for each key of the object at the current position, f must consume the value
+func (s *jsonScanner) object(f func(key []byte) bool) bool {
+	if !s.consume('{') {
+		return false
+	}
+	if s.consume('}') {
+		return true
+	}
+	for {
+		key, ok := s.readString()
+		if !ok || !s.consume(':') {
+			return false
+		}
+		if !f(key) {
+			return false
+		}
+		if s.consume(',') {
+			continue
+		}
+		return s.consume('}')
+	}
+}
+
+// ScanTopicEvent extract topic and event of a frame without a full json.Unmarshal,
+// the returned slices alias raw
+func ScanTopicEvent(raw []byte) (topic, event []byte, ok bool) {
+	s := jsonScanner{b: raw}
+	ok = s.object(func(key []byte) bool {
+		switch string(key) {
+		case "topic":
+			v, ok := s.readString()
+			topic = v
+			return ok
+		case "event":
+			v, ok := s.readString()
+			event = v
+			return ok
+		default:
+			return s.skipValue()
+		}
+	})
+	return topic, event, ok
+}
+
+// scanFrame ScanTopicEvent plus data.t of the frames whose topic passes clockTopic, t is 0 otherwise
+func scanFrame(raw []byte) (topic, event []byte, t int64, ok bool) {
+	s := jsonScanner{b: raw}
+	ok = s.object(func(key []byte) bool {
+		switch string(key) {
+		case "topic":
+			v, ok := s.readString()
+			topic = v
+			return ok
+		case "event":
+			v, ok := s.readString()
+			event = v
+			return ok
+		case "data":
+			if !clockTopic(topic) || s.peek() != '{' {
+				return s.skipValue()
+			}
+			return s.object(func(key []byte) bool {
+				if string(key) != "t" {
+					return s.skipValue()
+				}
+				v, ok := s.readInt()
+				t = v
+				return ok
+			})
+		default:
+			return s.skipValue()
+		}
+	})
+	return topic, event, t, ok
+}
+
+// scanData decode the data object of the frame in s with f, topic and event are returned as well
+func scanData(s *jsonScanner, f func(key []byte) bool) (topic, event []byte, err error) {
+	found := false
+	ok := s.object(func(key []byte) bool {
+		switch string(key) {
+		case "topic":
+			v, ok := s.readString()
+			topic = v
+			return ok
+		case "event":
+			v, ok := s.readString()
+			event = v
+			return ok
+		case "data":
+			found = true
+			return s.object(f)
+		default:
+			return s.skipValue()
+		}
+	})
+	if !ok || !found {
+		return nil, nil, errFastDecode
+	}
+	return topic, event, nil
+}
+
+// FastLevel order book level, fields alias the buffer of the owning FastDepth
+type FastLevel struct {
+	Price    []byte
+	Quantity []byte
+}
+
+func (l FastLevel) PriceDecimal() (Decimal, error)    { return ParseDecimal(string(l.Price)) }
+func (l FastLevel) QuantityDecimal() (Decimal, error) { return ParseDecimal(string(l.Quantity)) }
+
+// FastDepth pooled depth and depth_update payload.
+// All byte slices alias an internal copy of the frame and are only valid until ReleaseFastDepth.
+type FastDepth struct {
+	Topic         []byte
+	Event         []byte
+	Symbol        []byte
+	FirstUpdateID int64 // fi on spot depth_update, fu on futures
+	UpdateID      int64 // i on spot, id or u on futures
+	Time          int64
+	Asks          []FastLevel
+	Bids          []FastLevel
+
+	buf  []byte
+	scan jsonScanner
+}
+
+var fastDepthPool = sync.Pool{New: func() any { return new(FastDepth) }}
+
+func AcquireFastDepth() *FastDepth {
+	return fastDepthPool.Get().(*FastDepth)
+}
+
+func ReleaseFastDepth(d *FastDepth) {
+	d.reset()
+	fastDepthPool.Put(d)
+}
+
+func (d *FastDepth) reset() {
+	d.scan = jsonScanner{}
+	d.Topic, d.Event, d.Symbol = nil, nil, nil
+	d.FirstUpdateID, d.UpdateID, d.Time = 0, 0, 0
+	d.Asks = d.Asks[:0]
+	d.Bids = d.Bids[:0]
+	d.buf = d.buf[:0]
+}
+
+// DecodeDepth decode a depth or depth_update frame into d, reusing its buffers
+func DecodeDepth(raw []byte, d *FastDepth) error {
+	d.reset()
+	d.buf = append(d.buf, raw...)
+
+	s := &d.scan
+	*s = jsonScanner{b: d.buf}
+
+	var err error
+	d.Topic, d.Event, err = scanData(s, func(key []byte) bool {
+		var ok bool
+		switch string(key) {
+		case "s":
+			d.Symbol, ok = s.readString()
+		case "i", "id", "u":
+			d.UpdateID, ok = s.readInt()
+		case "fi", "fu":
+			d.FirstUpdateID, ok = s.readInt()
+		case "t":
+			d.Time, ok = s.readInt()
+		case "a":
+			d.Asks, ok = scanLevels(s, d.Asks)
+		case "b":
+			d.Bids, ok = scanLevels(s, d.Bids)
+		default:
+			ok = s.skipValue()
+		}
+		return ok
+	})
+	return err
+}
+
+func scanLevels(s *jsonScanner, levels []FastLevel) ([]FastLevel, bool) {
+	if !s.consume('[') {
+		return levels, false
+	}
+	if s.consume(']') {
+		return levels, true
+	}
+	for {
+		if !s.consume('[') {
+			return levels, false
+		}
+		price, ok := s.readNumberOrString()
+		if !ok || !s.consume(',') {
+			return levels, false
+		}
+		quantity, ok := s.readNumberOrString()
+		if !ok {
+			return levels, false
+		}
+		// ignore extra elements of a level
+		for s.consume(',') {
+			if !s.skipValue() {
+				return levels, false
+			}
+		}
+		if !s.consume(']') {
+			return levels, false
+		}
+		levels = append(levels, FastLevel{Price: price, Quantity: quantity})
+
+		if s.consume(',') {
+			continue
+		}
+		return levels, s.consume(']')
+	}
+}
+
+// FastTicker pooled ticker payload, byte slices are only valid until ReleaseFastTicker
+type FastTicker struct {
+	Topic    []byte
+	Event    []byte
+	Symbol   []byte
+	Time     int64
+	PriceChg []byte
+	ChgRate  []byte
+	Open     []byte
+	Close    []byte
+	High     []byte
+	Low      []byte
+	Quantity []byte
+	Volume   []byte
+
+	buf  []byte
+	scan jsonScanner
+}
+
+var fastTickerPool = sync.Pool{New: func() any { return new(FastTicker) }}
+
+func AcquireFastTicker() *FastTicker {
+	return fastTickerPool.Get().(*FastTicker)
+}
+
+func ReleaseFastTicker(t *FastTicker) {
+	t.reset()
+	fastTickerPool.Put(t)
+}
+
+func (t *FastTicker) reset() {
+	buf := t.buf[:0]
+	*t = FastTicker{buf: buf}
+}
+
+// DecodeTicker decode a spot or futures ticker frame into t, reusing its buffer
+func DecodeTicker(raw []byte, t *FastTicker) error {
+	t.reset()
+	t.buf = append(t.buf, raw...)
+
+	s := &t.scan
+	*s = jsonScanner{b: t.buf}
+
+	var err error
+	t.Topic, t.Event, err = scanData(s, func(key []byte) bool {
+		var ok bool
+		switch string(key) {
+		case "s":
+			t.Symbol, ok = s.readString()
+		case "t":
+			t.Time, ok = s.readInt()
+		case "cv":
+			t.PriceChg, ok = s.readNumberOrString()
+		case "cr", "r":
+			t.ChgRate, ok = s.readNumberOrString()
+		case "o":
+			t.Open, ok = s.readNumberOrString()
+		case "c":
+			t.Close, ok = s.readNumberOrString()
+		case "h":
+			t.High, ok = s.readNumberOrString()
+		case "l":
+			t.Low, ok = s.readNumberOrString()
+		case "q", "a":
+			t.Quantity, ok = s.readNumberOrString()
+		case "v":
+			t.Volume, ok = s.readNumberOrString()
+		default:
+			ok = s.skipValue()
+		}
+		return ok
+	})
+	return err
+}
+
+// NewFastDepthCallBack callback for depth and depth_update using pooled decoding,
+// d must not be retained after f returns
+func (ws *WsService) NewFastDepthCallBack(f func(d *FastDepth)) CallBack {
+	return func(rawMsg []byte) {
+		d := AcquireFastDepth()
+		defer ReleaseFastDepth(d)
+		if err := DecodeDepth(rawMsg, d); err != nil {
+			ws.Logger.Printf("fast decode depth err:%s", err.Error())
+			return
+		}
+		f(d)
+	}
+}
+
+// NewFastTickerCallBack callback for ticker using pooled decoding, t must not be retained after f returns
+func (ws *WsService) NewFastTickerCallBack(f func(t *FastTicker)) CallBack {
+	return func(rawMsg []byte) {
+		t := AcquireFastTicker()
+		defer ReleaseFastTicker(t)
+		if err := DecodeTicker(rawMsg, t); err != nil {
+			ws.Logger.Printf("fast decode ticker err:%s", err.Error())
+			return
+		}
+		f(t)
+	}
+}
@@ -0,0 +1,216 @@
+package xtws
+
+import (
+	"bytes"
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// refDepth the fields DecodeDepth reads, decoded with encoding/json
+type refDepth struct {
+	Topic string `json:"topic"`
+	Event string `json:"event"`
+	Data  struct {
+		Symbol string     `json:"s"`
+		I      int64      `json:"i"`
+		ID     int64      `json:"id"`
+		U      int64      `json:"u"`
+		Fi     int64      `json:"fi"`
+		Fu     int64      `json:"fu"`
+		Time   int64      `json:"t"`
+		Asks   [][]string `json:"a"`
+		Bids   [][]string `json:"b"`
+	} `json:"data"`
+}
+
+func fastLevels(levels []FastLevel) [][]string {
+	res := [][]string{}
+	for _, l := range levels {
+		res = append(res, []string{string(l.Price), string(l.Quantity)})
+	}
+	return res
+}
+
+func TestDecodeDepthFixtures(t *testing.T) {
+	for _, name := range []string{"spot/depth.json", "spot/depth_update.json", "futures/depth_update.json"} {
+		t.Run(name, func(t *testing.T) {
+			raw := readFixture(t, name)
+
+			var want refDepth
+			if err := json.Unmarshal(raw, &want); err != nil {
+				t.Fatal(err)
+			}
+			d := AcquireFastDepth()
+			defer ReleaseFastDepth(d)
+			if err := DecodeDepth(raw, d); err != nil {
+				t.Fatal(err)
+			}
+
+			if string(d.Topic) != want.Topic || string(d.Event) != want.Event || string(d.Symbol) != want.Data.Symbol {
+				t.Errorf("got %s %s %s", d.Topic, d.Event, d.Symbol)
+			}
+			if id := max(want.Data.I, want.Data.ID, want.Data.U); d.UpdateID != id {
+				t.Errorf("update id %d, want %d", d.UpdateID, id)
+			}
+			if first := max(want.Data.Fi, want.Data.Fu); d.FirstUpdateID != first {
+				t.Errorf("first update id %d, want %d", d.FirstUpdateID, first)
+			}
+			if d.Time != want.Data.Time {
+				t.Errorf("time %d, want %d", d.Time, want.Data.Time)
+			}
+			if asks := fastLevels(d.Asks); !slices.EqualFunc(asks, want.Data.Asks, slices.Equal) {
+				t.Errorf("asks %v, want %v", asks, want.Data.Asks)
+			}
+			if bids := fastLevels(d.Bids); !slices.EqualFunc(bids, want.Data.Bids, slices.Equal) {
+				t.Errorf("bids %v, want %v", bids, want.Data.Bids)
+			}
+		})
+	}
+}
+
+func TestDecodeDepthReuse(t *testing.T) {
+	d := AcquireFastDepth()
+	defer ReleaseFastDepth(d)
+
+	if err := DecodeDepth(readFixture(t, "spot/depth.json"), d); err != nil {
+		t.Fatal(err)
+	}
+	if err := DecodeDepth(readFixture(t, "spot/depth_update.json"), d); err != nil {
+		t.Fatal(err)
+	}
+	// nothing of the first frame is left
+	if len(d.Asks) != 1 || len(d.Bids) != 1 || d.Time != 0 || string(d.Topic) != ChannelSpotDepthUpdate {
+		t.Fatalf("stale state after reuse: %+v", d)
+	}
+}
+
+func TestDecodeTickerFixtures(t *testing.T) {
+	var spot UpdateTickerMsg
+	raw := readFixture(t, "spot/ticker.json")
+	if err := json.Unmarshal(raw, &spot); err != nil {
+		t.Fatal(err)
+	}
+	tk := AcquireFastTicker()
+	defer ReleaseFastTicker(tk)
+	if err := DecodeTicker(raw, tk); err != nil {
+		t.Fatal(err)
+	}
+	got := []string{string(tk.Symbol), string(tk.PriceChg), string(tk.ChgRate), string(tk.Open), string(tk.Close),
+		string(tk.High), string(tk.Low), string(tk.Quantity), string(tk.Volume)}
+	want := []string{spot.Data.Symbol, spot.Data.PriceChg, spot.Data.ChgRate, spot.Data.Open, spot.Data.Close,
+		spot.Data.High, spot.Data.Low, spot.Data.Quantity, spot.Data.Volume}
+	if !slices.Equal(got, want) || tk.Time != spot.Data.Time || string(tk.Event) != spot.Event {
+		t.Errorf("spot ticker %v, want %v", got, want)
+	}
+
+	var futures UpdateFuturesTickerMsg
+	raw = readFixture(t, "futures/ticker.json")
+	if err := json.Unmarshal(raw, &futures); err != nil {
+		t.Fatal(err)
+	}
+	if err := DecodeTicker(raw, tk); err != nil {
+		t.Fatal(err)
+	}
+	got = []string{string(tk.Symbol), string(tk.ChgRate), string(tk.Close), string(tk.Quantity), string(tk.Volume)}
+	want = []string{futures.Data.Symbol, futures.Data.ChgRate, futures.Data.Close, futures.Data.Amount, futures.Data.Volume}
+	if !slices.Equal(got, want) || tk.Time != futures.Data.Time {
+		t.Errorf("futures ticker %v, want %v", got, want)
+	}
+}
+
+func TestScanTopicEvent(t *testing.T) {
+	topic, event, ok := ScanTopicEvent(readFixture(t, "spot/depth.json"))
+	if !ok || string(topic) != ChannelSpotDeep || string(event) != "depth@btc_usdt,5" {
+		t.Fatalf("got %s %s %v", topic, event, ok)
+	}
+	if _, _, ok := ScanTopicEvent([]byte(`{"topic":"depth","event":`)); ok {
+		t.Fatal("truncated frame scanned")
+	}
+}
+
+func TestFastCallBackLogsDecodeError(t *testing.T) {
+	logs := new(bytes.Buffer)
+	ws := newTestService(logs)
+
+	called := false
+	ws.NewFastDepthCallBack(func(*FastDepth) { called = true })([]byte(`{"topic":"depth","data":{"a":[["1"]]}}`))
+	ws.NewFastTickerCallBack(func(*FastTicker) { called = true })([]byte(`{"topic":"ticker","data":{"s":"a\"b"}}`))
+	if called {
+		t.Fatal("callback called with an undecodable frame")
+	}
+	if !strings.Contains(logs.String(), "fast decode depth err") || !strings.Contains(logs.String(), "fast decode ticker err") {
+		t.Fatalf("decode errors not logged on ws.Logger: %q", logs.String())
+	}
+}
+
+func BenchmarkScanTopicEvent(b *testing.B) {
+	raw := readFixture(b, "spot/depth.json")
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, _, ok := ScanTopicEvent(raw); !ok {
+			b.Fatal("scan failed")
+		}
+	}
+}
+
+func BenchmarkUnmarshalTopicEvent(b *testing.B) {
+	raw := readFixture(b, "spot/depth.json")
+	b.ReportAllocs()
+	for b.Loop() {
+		var msg struct {
+			Topic string `json:"topic"`
+			Event string `json:"event"`
+		}
+		if err := json.Unmarshal(raw, &msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeDepth(b *testing.B) {
+	raw := readFixture(b, "spot/depth.json")
+	b.ReportAllocs()
+	for b.Loop() {
+		d := AcquireFastDepth()
+		if err := DecodeDepth(raw, d); err != nil {
+			b.Fatal(err)
+		}
+		ReleaseFastDepth(d)
+	}
+}
+
+func BenchmarkUnmarshalDepth(b *testing.B) {
+	raw := readFixture(b, "spot/depth.json")
+	b.ReportAllocs()
+	for b.Loop() {
+		var msg UpdateDepthMsg
+		if err := json.Unmarshal(raw, &msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeTicker(b *testing.B) {
+	raw := readFixture(b, "spot/ticker.json")
+	b.ReportAllocs()
+	for b.Loop() {
+		tk := AcquireFastTicker()
+		if err := DecodeTicker(raw, tk); err != nil {
+			b.Fatal(err)
+		}
+		ReleaseFastTicker(tk)
+	}
+}
+
+func BenchmarkUnmarshalTicker(b *testing.B) {
+	raw := readFixture(b, "spot/ticker.json")
+	b.ReportAllocs()
+	for b.Loop() {
+		var msg UpdateTickerMsg
+		if err := json.Unmarshal(raw, &msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
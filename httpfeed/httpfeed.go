@@ -0,0 +1,495 @@
+// Package httpfeed serves XT market data over plain HTTP for clients that do not speak websocket.
+//
+//	GET /stream?channel=ticker@btc_usdt&channel=depth@btc_usdt,5   Server-Sent Events, one event per frame
+//	GET /ticker/{symbol}                                            latest ticker
+//	GET /book/{symbol}                                              latest top of book
+//	GET /trades/{symbol}?limit=20                                   recent trades, oldest first
+//
+// Snapshots are kept for the symbols passed to Watch. Mount the Handler under a prefix with
+// mux.Handle("/market/", http.StripPrefix("/market", h)).
+package httpfeed
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	xtws "github.com/liuhengloveyou/xtws-go"
+)
+
+type Options struct {
+	DepthLevel   int           // level of the depth channel used for book snapshots, default 5
+	TradeHistory int           // recent trades kept per symbol, default 100
+	StreamBuffer int           // frames queued per SSE stream before dropping, default 256
+	KeepAlive    time.Duration // SSE comment interval keeping idle proxies open, default 15s
+	Logger       *log.Logger
+}
+
+type Handler struct {
+	ws   *xtws.WsService
+	opts Options
+	mux  *http.ServeMux
+
+	// watchMu serializes Watch and Unwatch, mu is never held while writing upstream.
+	// Upstream channels are held with WsService.AcquireChannels, shared with the other holders of the service.
+	watchMu *sync.Mutex
+	mu      *sync.Mutex
+	streams map[string]map[*stream]struct{} // channel (frame event) -> streams
+	topics  map[string]func()               // topic -> remove upstream callback
+	cached  map[string]bool                 // channels feeding the snapshots
+	tickers map[string]xtws.TickerData
+	books   map[string]xtws.DepthData
+	trades  map[string][]xtws.TradeData
+	dropped int64
+}
+
+// Book top of book snapshot, Bid or Ask is nil when the side is empty
+type Book struct {
+	Symbol string `json:"s"`
+	Time   int64  `json:"t"`
+	Bid    *Level `json:"bid"`
+	Ask    *Level `json:"ask"`
+}
+
+type Level struct {
+	Price    xtws.Decimal `json:"p"`
+	Quantity xtws.Decimal `json:"q"`
+}
+
+type errorResponse struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+}
+
+func New(ws *xtws.WsService, opts Options) *Handler {
+	if opts.DepthLevel <= 0 {
+		opts.DepthLevel = 5
+	}
+	if opts.TradeHistory <= 0 {
+		opts.TradeHistory = 100
+	}
+	if opts.StreamBuffer <= 0 {
+		opts.StreamBuffer = 256
+	}
+	if opts.KeepAlive <= 0 {
+		opts.KeepAlive = 15 * time.Second
+	}
+	if opts.Logger == nil {
+		opts.Logger = log.New(os.Stderr, "httpfeed ", log.LstdFlags)
+	}
+
+	h := &Handler{
+		ws:      ws,
+		opts:    opts,
+		mux:     http.NewServeMux(),
+		watchMu: new(sync.Mutex),
+		mu:      new(sync.Mutex),
+		streams: make(map[string]map[*stream]struct{}),
+		topics:  make(map[string]func()),
+		cached:  make(map[string]bool),
+		tickers: make(map[string]xtws.TickerData),
+		books:   make(map[string]xtws.DepthData),
+		trades:  make(map[string][]xtws.TradeData),
+	}
+
+	h.mux.HandleFunc("GET /stream", h.serveStream)
+	h.mux.HandleFunc("GET /ticker/{symbol}", h.serveTicker)
+	h.mux.HandleFunc("GET /book/{symbol}", h.serveBook)
+	h.mux.HandleFunc("GET /trades/{symbol}", h.serveTrades)
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// Watch subscribe ticker, depth and trade of symbols and keep their snapshots
+func (h *Handler) Watch(symbols ...string) error {
+	var channels []string
+	for _, symbol := range symbols {
+		channels = append(channels, h.snapshotChannels(symbol)...)
+	}
+	// a symbol given twice is held once
+	channels = uniq(channels)
+
+	h.watchMu.Lock()
+	defer h.watchMu.Unlock()
+
+	h.mu.Lock()
+	var fresh []string
+	for _, channel := range channels {
+		if !h.cached[channel] {
+			fresh = append(fresh, channel)
+		}
+	}
+	h.mu.Unlock()
+
+	if len(fresh) == 0 {
+		return nil
+	}
+	return h.acquire(fresh, func() {
+		for _, channel := range fresh {
+			h.cached[channel] = true
+		}
+	})
+}
+
+// Unwatch stop keeping snapshots of symbols
+func (h *Handler) Unwatch(symbols ...string) error {
+	h.watchMu.Lock()
+	defer h.watchMu.Unlock()
+
+	h.mu.Lock()
+	var channels []string
+	for _, symbol := range symbols {
+		for _, channel := range h.snapshotChannels(symbol) {
+			if h.cached[channel] {
+				delete(h.cached, channel)
+				channels = append(channels, channel)
+			}
+		}
+		delete(h.tickers, symbol)
+		delete(h.books, symbol)
+		delete(h.trades, symbol)
+	}
+	h.mu.Unlock()
+
+	if len(channels) == 0 {
+		return nil
+	}
+	return h.release(channels)
+}
+
+func (h *Handler) snapshotChannels(symbol string) []string {
+	return []string{
+		fmt.Sprintf("%s@%s", xtws.ChannelSpotTicker, symbol),
+		fmt.Sprintf("%s@%s,%d", xtws.ChannelSpotDeep, symbol, h.opts.DepthLevel),
+		fmt.Sprintf("%s@%s", xtws.ChannelSpotTrade, symbol),
+	}
+}
+
+// Ticker latest ticker of a watched symbol
+func (h *Handler) Ticker(symbol string) (xtws.TickerData, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	t, ok := h.tickers[symbol]
+	return t, ok
+}
+
+// Book latest top of book of a watched symbol
+func (h *Handler) Book(symbol string) (Book, bool) {
+	h.mu.Lock()
+	d, ok := h.books[symbol]
+	h.mu.Unlock()
+	if !ok {
+		return Book{}, false
+	}
+
+	book := Book{Symbol: d.Symbol, Time: d.Time}
+	if l, ok := d.Bids.Best(); ok {
+		book.Bid = &Level{Price: l.Price, Quantity: l.Quantity}
+	}
+	if l, ok := d.Asks.Best(); ok {
+		book.Ask = &Level{Price: l.Price, Quantity: l.Quantity}
+	}
+	return book, true
+}
+
+// Trades up to limit most recent trades of a watched symbol, oldest first, limit <= 0 returns all kept
+func (h *Handler) Trades(symbol string, limit int) ([]xtws.TradeData, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	trades, ok := h.trades[symbol]
+	if !ok {
+		return nil, false
+	}
+	if limit > 0 && limit < len(trades) {
+		trades = trades[len(trades)-limit:]
+	}
+	res := make([]xtws.TradeData, len(trades))
+	copy(res, trades)
+	return res, true
+}
+
+// Dropped number of frames dropped because an SSE stream buffer was full
+func (h *Handler) Dropped() int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.dropped
+}
+
+// acquire hold channels upstream and run hold under h.mu once they are, hold records the holder.
+// h.mu must not be held.
+func (h *Handler) acquire(channels []string, hold func()) error {
+	h.mu.Lock()
+	h.watchTopics(channels)
+	h.mu.Unlock()
+
+	if err := h.ws.AcquireChannels(channels); err != nil {
+		h.mu.Lock()
+		h.releaseTopics()
+		h.mu.Unlock()
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	// a failed acquire meanwhile may have removed the callbacks
+	h.watchTopics(channels)
+	hold()
+	return nil
+}
+
+// release drop a hold on channels, the holder is already forgotten. h.mu must not be held.
+func (h *Handler) release(channels []string) error {
+	h.mu.Lock()
+	h.releaseTopics()
+	h.mu.Unlock()
+
+	return h.ws.ReleaseChannels(channels)
+}
+
+// watchTopics route upstream messages of the channels' topics, callbacks are registered by topic. h.mu must be held.
+func (h *Handler) watchTopics(channels []string) {
+	for _, channel := range channels {
+		topic, _, _ := strings.Cut(channel, "@")
+		if _, ok := h.topics[topic]; !ok {
+			h.topics[topic] = h.ws.AddCallBack(topic, h.route)
+		}
+	}
+}
+
+// releaseTopics remove the callbacks of topics no snapshot or stream needs anymore. h.mu must be held.
+func (h *Handler) releaseTopics() {
+	used := make(map[string]bool, len(h.topics))
+	for channel := range h.cached {
+		topic, _, _ := strings.Cut(channel, "@")
+		used[topic] = true
+	}
+	for channel := range h.streams {
+		topic, _, _ := strings.Cut(channel, "@")
+		used[topic] = true
+	}
+	for topic, remove := range h.topics {
+		if !used[topic] {
+			remove()
+			delete(h.topics, topic)
+		}
+	}
+}
+
+// route update the snapshots and fan out the frame to the streams of its event
+func (h *Handler) route(rawMsg []byte) {
+	topic, event, ok := xtws.ScanTopicEvent(rawMsg)
+	if !ok {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.cached[string(event)] {
+		h.cache(string(topic), rawMsg)
+	}
+
+	for s := range h.streams[string(event)] {
+		select {
+		case s.send <- frame{event: string(event), data: rawMsg}:
+		default:
+			h.dropped++
+		}
+	}
+}
+
+// cache h.mu must be held
+func (h *Handler) cache(topic string, rawMsg []byte) {
+	var err error
+	switch topic {
+	case xtws.ChannelSpotTicker:
+		var msg xtws.UpdateTickerMsg
+		if err = json.Unmarshal(rawMsg, &msg); err == nil {
+			h.tickers[msg.Data.Symbol] = msg.Data
+		}
+	case xtws.ChannelSpotDeep:
+		var msg xtws.UpdateDepthMsg
+		if err = json.Unmarshal(rawMsg, &msg); err == nil {
+			h.books[msg.Data.Symbol] = msg.Data
+		}
+	case xtws.ChannelSpotTrade:
+		var msg xtws.UpdateTradeMsg
+		if err = json.Unmarshal(rawMsg, &msg); err == nil {
+			trades := append(h.trades[msg.Data.Symbol], msg.Data)
+			if len(trades) > h.opts.TradeHistory {
+				trades = append(trades[:0:0], trades[len(trades)-h.opts.TradeHistory:]...)
+			}
+			h.trades[msg.Data.Symbol] = trades
+		}
+	}
+	if err != nil {
+		h.opts.Logger.Printf("decode %s err:%s", topic, err.Error())
+	}
+}
+
+type frame struct {
+	event string
+	data  []byte
+}
+
+type stream struct {
+	send chan frame
+}
+
+func (h *Handler) serveStream(w http.ResponseWriter, r *http.Request) {
+	channels := uniq(r.URL.Query()["channel"])
+	if len(channels) == 0 {
+		writeError(w, http.StatusBadRequest, "channel is required")
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming unsupported")
+		return
+	}
+
+	s := &stream{send: make(chan frame, h.opts.StreamBuffer)}
+
+	err := h.acquire(channels, func() {
+		for _, channel := range channels {
+			if h.streams[channel] == nil {
+				h.streams[channel] = make(map[*stream]struct{})
+			}
+			h.streams[channel][s] = struct{}{}
+		}
+	})
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	defer func() {
+		h.mu.Lock()
+		for _, channel := range channels {
+			delete(h.streams[channel], s)
+			if len(h.streams[channel]) == 0 {
+				delete(h.streams, channel)
+			}
+		}
+		h.mu.Unlock()
+
+		if err := h.release(channels); err != nil {
+			h.opts.Logger.Printf("unsubscribe %v err:%s", channels, err.Error())
+		}
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(h.opts.KeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			_, err = fmt.Fprint(w, ": keep-alive\n\n")
+		case f := <-s.send:
+			err = writeEvent(w, f.event, f.data)
+		}
+		if err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// writeEvent write one SSE event, every line of data gets its own data: field
+func writeEvent(w io.Writer, event string, data []byte) error {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "event: %s\n", event)
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	data = bytes.ReplaceAll(data, []byte("\r"), []byte("\n"))
+	for line := range bytes.SplitSeq(data, []byte("\n")) {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteByte('\n')
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+func (h *Handler) serveTicker(w http.ResponseWriter, r *http.Request) {
+	symbol := r.PathValue("symbol")
+	t, ok := h.Ticker(symbol)
+	if !ok {
+		writeError(w, http.StatusNotFound, "no ticker for "+symbol)
+		return
+	}
+	writeJSON(w, t)
+}
+
+func (h *Handler) serveBook(w http.ResponseWriter, r *http.Request) {
+	symbol := r.PathValue("symbol")
+	book, ok := h.Book(symbol)
+	if !ok {
+		writeError(w, http.StatusNotFound, "no book for "+symbol)
+		return
+	}
+	writeJSON(w, book)
+}
+
+func (h *Handler) serveTrades(w http.ResponseWriter, r *http.Request) {
+	symbol := r.PathValue("symbol")
+
+	limit := 0
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "invalid limit "+v)
+			return
+		}
+		limit = n
+	}
+
+	trades, ok := h.Trades(symbol, limit)
+	if !ok {
+		writeError(w, http.StatusNotFound, "no trades for "+symbol)
+		return
+	}
+	writeJSON(w, trades)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(errorResponse{Code: code, Msg: msg})
+}
+
+func uniq(channels []string) []string {
+	seen := make(map[string]bool, len(channels))
+	res := channels[:0:0]
+	for _, channel := range channels {
+		if channel != "" && !seen[channel] {
+			seen[channel] = true
+			res = append(res, channel)
+		}
+	}
+	return res
+}
@@ -0,0 +1,267 @@
+package httpfeed
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	xtws "github.com/liuhengloveyou/xtws-go"
+)
+
+// upstream fake XT endpoint recording subscribe frames, push sends a frame to the connection
+type upstream struct {
+	srv *httptest.Server
+
+	mu     sync.Mutex
+	conn   *websocket.Conn
+	frames []string // method + params of the received requests
+	got    chan struct{}
+}
+
+func newUpstream(t *testing.T) *upstream {
+	u := &upstream{got: make(chan struct{}, 100)}
+	upgrader := websocket.Upgrader{}
+	u.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		u.mu.Lock()
+		u.conn = c
+		u.mu.Unlock()
+		for {
+			_, msg, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			var req xtws.Request
+			if json.Unmarshal(msg, &req) != nil {
+				continue
+			}
+			u.mu.Lock()
+			u.frames = append(u.frames, req.Method+" "+strings.Join(req.Params, ","))
+			u.mu.Unlock()
+			u.got <- struct{}{}
+		}
+	}))
+	t.Cleanup(u.srv.Close)
+	return u
+}
+
+func (u *upstream) push(t *testing.T, frames ...string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for _, f := range frames {
+		if err := u.conn.WriteMessage(websocket.TextMessage, []byte(f)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// waitFrames wait until n requests arrived and return them
+func (u *upstream) waitFrames(t *testing.T, n int) []string {
+	t.Helper()
+	timeout := time.After(time.Second)
+	for {
+		u.mu.Lock()
+		frames := append([]string(nil), u.frames...)
+		u.mu.Unlock()
+		if len(frames) >= n {
+			return frames
+		}
+		select {
+		case <-u.got:
+		case <-timeout:
+			t.Fatalf("got %v, want %d upstream requests", frames, n)
+		}
+	}
+}
+
+func newTestFeed(t *testing.T) (*Handler, *upstream, *httptest.Server) {
+	up := newUpstream(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	url := "ws" + strings.TrimPrefix(up.srv.URL, "http")
+	ws, err := xtws.NewWsService(ctx, log.New(io.Discard, "", 0), xtws.NewConnConfFromOption(&xtws.ConfOptions{URL: url}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := New(ws, Options{Logger: log.New(io.Discard, "", 0)})
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return h, up, srv
+}
+
+func TestWriteEvent(t *testing.T) {
+	var b bytes.Buffer
+	if err := writeEvent(&b, "ticker@btc_usdt", []byte("{\n\"a\":1,\r\n\"b\":2\r}")); err != nil {
+		t.Fatal(err)
+	}
+	want := "event: ticker@btc_usdt\ndata: {\ndata: \"a\":1,\ndata: \"b\":2\ndata: }\n\n"
+	if b.String() != want {
+		t.Fatalf("got %q, want %q", b.String(), want)
+	}
+}
+
+func TestStream(t *testing.T) {
+	_, up, srv := newTestFeed(t)
+	const channel = "ticker@btc_usdt"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/stream?channel="+channel, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("content type %q", ct)
+	}
+	if frames := up.waitFrames(t, 1); frames[0] != "subscribe "+channel {
+		t.Fatalf("upstream got %v", frames)
+	}
+
+	frame := `{"topic":"ticker","event":"ticker@btc_usdt","data":{"s":"btc_usdt","c":"37499.60"}}`
+	up.push(t, frame)
+
+	r := bufio.NewReader(resp.Body)
+	var lines []string
+	for len(lines) < 3 {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, line)
+	}
+	if want := []string{"event: " + channel + "\n", "data: " + frame + "\n", "\n"}; strings.Join(lines, "") != strings.Join(want, "") {
+		t.Fatalf("got %q, want %q", lines, want)
+	}
+
+	// the last stream leaving unsubscribes upstream
+	cancel()
+	if frames := up.waitFrames(t, 2); frames[1] != "unsubscribe "+channel {
+		t.Fatalf("upstream got %v, want an unsubscribe", frames)
+	}
+}
+
+func TestStreamRequiresChannel(t *testing.T) {
+	_, _, srv := newTestFeed(t)
+	resp, err := http.Get(srv.URL + "/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+}
+
+func getJSON(t *testing.T, url string, v any) int {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if v != nil && resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestSnapshots(t *testing.T) {
+	h, up, srv := newTestFeed(t)
+
+	if err := h.Watch("btc_usdt"); err != nil {
+		t.Fatal(err)
+	}
+	if frames := up.waitFrames(t, 1); frames[0] != "subscribe ticker@btc_usdt,depth@btc_usdt,5,trade@btc_usdt" {
+		t.Fatalf("upstream got %v", frames)
+	}
+
+	up.push(t,
+		`{"topic":"ticker","event":"ticker@btc_usdt","data":{"s":"btc_usdt","t":1,"c":"37499.60"}}`,
+		`{"topic":"depth","event":"depth@btc_usdt,5","data":{"s":"btc_usdt","t":2,"a":[["37499.70","1.2"]],"b":[["37499.50","0.8"]]}}`,
+		`{"topic":"trade","event":"trade@btc_usdt","data":{"s":"btc_usdt","i":1,"t":3,"p":"37499.60","q":"0.1"}}`,
+		`{"topic":"trade","event":"trade@btc_usdt","data":{"s":"btc_usdt","i":2,"t":4,"p":"37499.70","q":"0.2"}}`,
+	)
+	deadline := time.Now().Add(time.Second)
+	for {
+		if trades, _ := h.Trades("btc_usdt", 0); len(trades) == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("snapshots not updated")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	var ticker xtws.TickerData
+	if code := getJSON(t, srv.URL+"/ticker/btc_usdt", &ticker); code != http.StatusOK || ticker.Close != "37499.60" {
+		t.Fatalf("ticker %d %+v", code, ticker)
+	}
+	var book struct {
+		Bid, Ask struct{ P, Q string }
+	}
+	if code := getJSON(t, srv.URL+"/book/btc_usdt", &book); code != http.StatusOK || book.Bid.P != "37499.50" || book.Ask.Q != "1.2" {
+		t.Fatalf("book %d %+v", code, book)
+	}
+	var trades []xtws.TradeData
+	if code := getJSON(t, srv.URL+"/trades/btc_usdt?limit=1", &trades); code != http.StatusOK || len(trades) != 1 || trades[0].ID != 2 {
+		t.Fatalf("trades %d %+v", code, trades)
+	}
+	if code := getJSON(t, srv.URL+"/trades/btc_usdt?limit=x", nil); code != http.StatusBadRequest {
+		t.Fatalf("invalid limit status %d", code)
+	}
+	if code := getJSON(t, srv.URL+"/ticker/eth_usdt", nil); code != http.StatusNotFound {
+		t.Fatalf("unwatched symbol status %d", code)
+	}
+
+	if err := h.Unwatch("btc_usdt"); err != nil {
+		t.Fatal(err)
+	}
+	if frames := up.waitFrames(t, 2); !strings.HasPrefix(frames[1], "unsubscribe ") {
+		t.Fatalf("upstream got %v, want an unsubscribe", frames)
+	}
+	if code := getJSON(t, srv.URL+"/ticker/btc_usdt", nil); code != http.StatusNotFound {
+		t.Fatalf("ticker after Unwatch status %d", code)
+	}
+}
+
+func TestWatchDuplicateSymbols(t *testing.T) {
+	h, up, _ := newTestFeed(t)
+
+	if err := h.Watch("btc_usdt", "btc_usdt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Watch("btc_usdt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Unwatch("btc_usdt"); err != nil {
+		t.Fatal(err)
+	}
+	frames := up.waitFrames(t, 2)
+	if len(frames) != 2 || frames[1] != "unsubscribe ticker@btc_usdt,depth@btc_usdt,5,trade@btc_usdt" {
+		t.Fatalf("upstream got %v, want one subscribe and one unsubscribe", frames)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.topics) != 0 {
+		t.Fatalf("%d topic callbacks left", len(h.topics))
+	}
+}
@@ -0,0 +1,462 @@
+package xtws
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// KlineFetcher loads historical klines with open time in [startTime, endTime], milliseconds, oldest first
+type KlineFetcher interface {
+	FetchKlines(ctx context.Context, symbol, interval string, startTime, endTime int64) ([]KlineData, error)
+}
+
+// KlineFetchFunc adapts a func to KlineFetcher
+type KlineFetchFunc func(ctx context.Context, symbol, interval string, startTime, endTime int64) ([]KlineData, error)
+
+func (f KlineFetchFunc) FetchKlines(ctx context.Context, symbol, interval string, startTime, endTime int64) ([]KlineData, error) {
+	return f(ctx, symbol, interval, startTime, endTime)
+}
+
+// restKlineLimit most klines the endpoint returns per request
+const restKlineLimit = 1000
+
+// RestKlineFetcher https://doc.xt.com/#market4kline, ranges longer than one page are fetched page by page
+type RestKlineFetcher struct {
+	BaseURL string // default RestBaseUrl
+	Client  *http.Client
+}
+
+type restKlineResp struct {
+	Rc     int         `json:"rc"`
+	Mc     string      `json:"mc"`
+	Result []KlineData `json:"result"`
+}
+
+func (f *RestKlineFetcher) FetchKlines(ctx context.Context, symbol, interval string, startTime, endTime int64) ([]KlineData, error) {
+	var res []KlineData
+	for startTime <= endTime {
+		page, err := f.fetchPage(ctx, symbol, interval, startTime, endTime)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, page...)
+		if len(page) < restKlineLimit {
+			break
+		}
+		// a full page may be cut at either end of the range, continue with the part not covered yet
+		if oldest := page[0].Time; oldest > startTime {
+			endTime = oldest - 1
+		} else {
+			startTime = page[len(page)-1].Time + 1
+		}
+	}
+
+	slices.SortFunc(res, func(a, b KlineData) int { return cmp.Compare(a.Time, b.Time) })
+	return slices.CompactFunc(res, func(a, b KlineData) bool { return a.Time == b.Time }), nil
+}
+
+// fetchPage one request, oldest first
+func (f *RestKlineFetcher) fetchPage(ctx context.Context, symbol, interval string, startTime, endTime int64) ([]KlineData, error) {
+	base := f.BaseURL
+	if base == "" {
+		base = RestBaseUrl
+	}
+	client := f.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	q := url.Values{}
+	q.Set("symbol", symbol)
+	q.Set("interval", interval)
+	q.Set("startTime", strconv.FormatInt(startTime, 10))
+	q.Set("endTime", strconv.FormatInt(endTime, 10))
+	q.Set("limit", strconv.Itoa(restKlineLimit))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+"/v4/public/kline?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch kline %s %s: http status %d", symbol, interval, resp.StatusCode)
+	}
+
+	var body restKlineResp
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	if body.Rc != 0 {
+		return nil, fmt.Errorf("fetch kline %s %s: %s", symbol, interval, body.Mc)
+	}
+
+	for i := range body.Result {
+		body.Result[i].Symbol = symbol
+		body.Result[i].Interval = interval
+	}
+	// the endpoint returns newest first
+	slices.SortFunc(body.Result, func(a, b KlineData) int { return cmp.Compare(a.Time, b.Time) })
+	return body.Result, nil
+}
+
+// MemoryKlineFetcher KlineFetcher backed by klines added with Add, for tests and replays
+type MemoryKlineFetcher struct {
+	mu     sync.Mutex
+	klines map[klineKey][]KlineData
+}
+
+func NewMemoryKlineFetcher() *MemoryKlineFetcher {
+	return &MemoryKlineFetcher{klines: make(map[klineKey][]KlineData)}
+}
+
+// Add store klines, Symbol and Interval must be set
+func (f *MemoryKlineFetcher) Add(klines ...KlineData) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, k := range klines {
+		key := klineKey{symbol: k.Symbol, interval: k.Interval}
+		list := f.klines[key]
+		i, found := slices.BinarySearchFunc(list, k.Time, func(e KlineData, t int64) int { return cmp.Compare(e.Time, t) })
+		if found {
+			list[i] = k
+		} else {
+			list = slices.Insert(list, i, k)
+		}
+		f.klines[key] = list
+	}
+}
+
+func (f *MemoryKlineFetcher) FetchKlines(_ context.Context, symbol, interval string, startTime, endTime int64) ([]KlineData, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var res []KlineData
+	for _, k := range f.klines[klineKey{symbol: symbol, interval: interval}] {
+		if k.Time >= startTime && k.Time <= endTime {
+			res = append(res, k)
+		}
+	}
+	return res, nil
+}
+
+// nextKlineTime open time of the bar following the one opened at t
+func nextKlineTime(t int64, interval string) (int64, error) {
+	open := time.UnixMilli(t).UTC()
+	switch interval {
+	case "1M":
+		return open.AddDate(0, 1, 0).UnixMilli(), nil
+	case "1w":
+		return open.AddDate(0, 0, 7).UnixMilli(), nil
+	case "3d":
+		return open.AddDate(0, 0, 3).UnixMilli(), nil
+	case "1d":
+		return open.AddDate(0, 0, 1).UnixMilli(), nil
+	}
+
+	du, err := time.ParseDuration(interval)
+	if err != nil || du <= 0 {
+		return 0, fmt.Errorf("invalid kline interval %q", interval)
+	}
+	return t + du.Milliseconds(), nil
+}
+
+type klineKey struct {
+	symbol   string
+	interval string
+}
+
+type klineSeries struct {
+	open        KlineData // bar currently being updated by the stream
+	hasOpen     bool
+	lastClosed  KlineData
+	hasClosed   bool
+	closedUntil int64       // bars opening before it are closed or queued in fills
+	fills       []klineFill // closes waiting for the fill goroutine, in order
+	filling     bool        // the fill goroutine of the series runs
+}
+
+// klineFill close the bars opening in [start, until), open is the stream value of the first one
+type klineFill struct {
+	ctx     context.Context
+	start   int64
+	until   int64
+	open    KlineData
+	hasOpen bool
+	fetch   bool          // bars the stream missed are fetched
+	done    chan struct{} // closed once applied, may be nil
+}
+
+// KlineManager turns kline@{symbol},{interval} pushes into a contiguous series of closed bars.
+// A bar is closed when a push for a later bar arrives, missing bars in between
+// (e.g. closed while the socket was reconnecting) are backfilled through the KlineFetcher.
+// Backfills run on a goroutine per series, without the manager lock, and bars closed by the
+// stream meanwhile are held back until the fetched ones are out.
+type KlineManager struct {
+	ws           *WsService
+	fetcher      KlineFetcher
+	onClosed     func(KlineData)
+	FetchTimeout time.Duration
+
+	ctx      context.Context // backfills, canceled by Close
+	cancel   context.CancelFunc
+	detach   func() // removes the kline callback
+	unhook   func() // removes the reconnect hook
+	mu       *sync.Mutex
+	series   map[klineKey]*klineSeries
+	channels []string // held with AcquireChannels by Subscribe, released by Close
+}
+
+// NewKlineManager onClosed receives closed bars in order for each (symbol, interval),
+// it is called with the manager locked and must not call back into it. Close the manager once done with it.
+func NewKlineManager(ws *WsService, fetcher KlineFetcher, onClosed func(KlineData)) *KlineManager {
+	if fetcher == nil {
+		fetcher = &RestKlineFetcher{}
+	}
+	ctx, cancel := context.WithCancel(ws.Ctx)
+	m := &KlineManager{
+		ws:           ws,
+		fetcher:      fetcher,
+		onClosed:     onClosed,
+		FetchTimeout: 10 * time.Second,
+		ctx:          ctx,
+		cancel:       cancel,
+		mu:           new(sync.Mutex),
+		series:       make(map[klineKey]*klineSeries),
+	}
+
+	m.detach = ws.AddCallBack(ChannelSpotKline, ws.NewKlineCallBack(func(msg *UpdateKlineMsg) {
+		m.Push(msg.Data)
+	}))
+	m.unhook = ws.OnReconnect(func() {
+		go m.Backfill(m.ctx)
+	})
+
+	return m
+}
+
+// Subscribe subscribe kline@{symbol},{interval} for symbols, the channels are held until Close
+func (m *KlineManager) Subscribe(symbols []string, interval string) error {
+	channels, err := m.ws.klineChannels(symbols, interval)
+	if err != nil {
+		return err
+	}
+	if err := m.ws.AcquireChannels(channels); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.channels = append(m.channels, channels...)
+	return nil
+}
+
+// Close stop following the klines: the callback and the reconnect hook are removed, running backfills
+// canceled and the subscribed channels released. Bars are no longer passed to onClosed.
+func (m *KlineManager) Close() error {
+	m.detach()
+	m.unhook()
+	m.cancel()
+
+	m.mu.Lock()
+	channels := m.channels
+	m.channels = nil
+	m.mu.Unlock()
+
+	if len(channels) == 0 {
+		return nil
+	}
+	return m.ws.ReleaseChannels(channels)
+}
+
+// Push apply a kline push, it never waits for a backfill
+func (m *KlineManager) Push(k KlineData) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := klineKey{symbol: k.Symbol, interval: k.Interval}
+	s, ok := m.series[key]
+	if !ok {
+		s = &klineSeries{}
+		m.series[key] = s
+	}
+
+	if k.Time < s.closedUntil {
+		// stale push of an already closed bar
+		return
+	}
+
+	if !s.hasOpen {
+		if s.closedUntil != 0 && s.closedUntil < k.Time {
+			// the open bar was closed by a backfill, bars in between were missed
+			m.schedule(key, s, klineFill{ctx: m.ctx, start: s.closedUntil, until: k.Time})
+		}
+		s.open, s.hasOpen = k, true
+		return
+	}
+
+	switch {
+	case k.Time == s.open.Time:
+		s.open = k
+	case k.Time > s.open.Time:
+		m.schedule(key, s, klineFill{ctx: m.ctx, start: s.open.Time, until: k.Time, open: s.open, hasOpen: true})
+		s.open = k
+	default:
+		// stale push of an already closed bar
+	}
+}
+
+// schedule close the bars of f, right away when nothing has to be fetched and no fill is queued,
+// on the fill goroutine otherwise. m.mu must be held.
+func (m *KlineManager) schedule(key klineKey, s *klineSeries, f klineFill) {
+	next, err := nextKlineTime(f.start, key.interval)
+	if err != nil {
+		m.ws.Logger.Printf("kline %s %s: %s", key.symbol, key.interval, err.Error())
+		if f.done != nil {
+			close(f.done)
+		}
+		return
+	}
+	s.closedUntil = max(s.closedUntil, f.until)
+	f.fetch = next < f.until || !f.hasOpen
+
+	if !f.fetch && !s.filling {
+		m.apply(key, s, f, nil)
+		return
+	}
+	s.fills = append(s.fills, f)
+	if !s.filling {
+		s.filling = true
+		go m.runFills(key, s)
+	}
+}
+
+// runFills apply the queued fills of the series in order, fetching without holding m.mu
+func (m *KlineManager) runFills(key klineKey, s *klineSeries) {
+	for {
+		m.mu.Lock()
+		if len(s.fills) == 0 {
+			s.filling = false
+			m.mu.Unlock()
+			return
+		}
+		f := s.fills[0]
+		s.fills = slices.Delete(s.fills, 0, 1)
+		m.mu.Unlock()
+
+		var fetched []KlineData
+		if f.fetch {
+			ctx, cancel := context.WithTimeout(f.ctx, m.FetchTimeout)
+			var err error
+			fetched, err = m.fetcher.FetchKlines(ctx, key.symbol, key.interval, f.start, f.until-1)
+			cancel()
+			if err != nil {
+				m.ws.Logger.Printf("backfill kline %s %s [%d, %d) err:%s", key.symbol, key.interval, f.start, f.until, err.Error())
+			}
+		}
+
+		m.mu.Lock()
+		m.apply(key, s, f, fetched)
+		m.mu.Unlock()
+	}
+}
+
+// apply close the bars of f, fetched bars replace the stream value of the open bar. m.mu must be held.
+func (m *KlineManager) apply(key klineKey, s *klineSeries, f klineFill, fetched []KlineData) {
+	if f.done != nil {
+		defer close(f.done)
+	}
+
+	if f.hasOpen && (len(fetched) == 0 || fetched[0].Time != f.open.Time) {
+		m.close(s, f.open)
+	}
+	for _, k := range fetched {
+		if k.Time < f.start || k.Time >= f.until || (s.hasClosed && k.Time <= s.lastClosed.Time) {
+			continue
+		}
+		k.Symbol, k.Interval = key.symbol, key.interval
+		m.close(s, k)
+	}
+
+	if !s.hasClosed {
+		return
+	}
+	if expected, err := nextKlineTime(s.lastClosed.Time, key.interval); err == nil && expected < f.until {
+		m.ws.Logger.Printf("kline %s %s still missing bars from %d to %d", key.symbol, key.interval, expected, f.until)
+	}
+}
+
+func (m *KlineManager) close(s *klineSeries, k KlineData) {
+	s.lastClosed, s.hasClosed = k, true
+	if m.onClosed != nil {
+		m.onClosed(k)
+	}
+}
+
+// Backfill close every bar that ended before now, called after reconnect so quiet symbols catch up too.
+// The fetches use ctx, Backfill returns when they are applied or ctx is done.
+func (m *KlineManager) Backfill(ctx context.Context) {
+	if ctx.Err() != nil {
+		return
+	}
+
+	m.mu.Lock()
+	var done []chan struct{}
+	now := time.Now().UnixMilli()
+	for key, s := range m.series {
+		if !s.hasOpen {
+			continue
+		}
+		next, err := nextKlineTime(s.open.Time, key.interval)
+		if err != nil || next > now {
+			continue
+		}
+		// close everything up to the bar containing now, the stream delivers that one
+		until := next
+		for {
+			n, err := nextKlineTime(until, key.interval)
+			if err != nil || n > now {
+				break
+			}
+			until = n
+		}
+
+		f := klineFill{ctx: ctx, start: s.open.Time, until: until, open: s.open, hasOpen: true, done: make(chan struct{})}
+		s.hasOpen = false
+		done = append(done, f.done)
+		m.schedule(key, s, f)
+	}
+	m.mu.Unlock()
+
+	for _, d := range done {
+		select {
+		case <-d:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// LastClosed last closed bar of symbol and interval
+func (m *KlineManager) LastClosed(symbol, interval string) (KlineData, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if s, ok := m.series[klineKey{symbol: symbol, interval: interval}]; ok && s.hasClosed {
+		return s.lastClosed, true
+	}
+	return KlineData{}, false
+}
@@ -0,0 +1,241 @@
+package xtws
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testMinute = int64(time.Minute / time.Millisecond)
+
+func testKline(t int64, close string) KlineData {
+	return KlineData{Symbol: "btc_usdt", Interval: "1m", Time: t, Close: close}
+}
+
+// klineRecorder collects closed bars, Wait blocks until n bars are closed
+type klineRecorder struct {
+	mu     sync.Mutex
+	closed []KlineData
+	notify chan struct{}
+}
+
+func newKlineRecorder() *klineRecorder {
+	return &klineRecorder{notify: make(chan struct{}, 100)}
+}
+
+func (r *klineRecorder) onClosed(k KlineData) {
+	r.mu.Lock()
+	r.closed = append(r.closed, k)
+	r.mu.Unlock()
+	r.notify <- struct{}{}
+}
+
+func (r *klineRecorder) wait(t *testing.T, n int) []string {
+	t.Helper()
+	timeout := time.After(time.Second)
+	for {
+		r.mu.Lock()
+		var res []string
+		for _, k := range r.closed {
+			res = append(res, strconv.FormatInt(k.Time/testMinute, 10)+":"+k.Close)
+		}
+		r.mu.Unlock()
+		if len(res) >= n {
+			return res
+		}
+		select {
+		case <-r.notify:
+		case <-timeout:
+			t.Fatalf("got %v, want %d closed bars", res, n)
+		}
+	}
+}
+
+func TestKlineManagerContiguous(t *testing.T) {
+	rec := newKlineRecorder()
+	m := NewKlineManager(newTestService(nil), KlineFetchFunc(func(context.Context, string, string, int64, int64) ([]KlineData, error) {
+		t.Error("fetch without a gap")
+		return nil, nil
+	}), rec.onClosed)
+
+	m.Push(testKline(0, "1"))
+	m.Push(testKline(0, "2"))
+	m.Push(testKline(testMinute, "3"))
+	m.Push(testKline(0, "stale"))
+	m.Push(testKline(2*testMinute, "4"))
+
+	if got := rec.wait(t, 2); !slices.Equal(got, []string{"0:2", "1:3"}) {
+		t.Fatalf("closed %v", got)
+	}
+}
+
+func TestKlineManagerGapFetch(t *testing.T) {
+	fetcher := NewMemoryKlineFetcher()
+	for i := range int64(4) {
+		fetcher.Add(testKline(i*testMinute, "rest"+strconv.FormatInt(i, 10)))
+	}
+
+	rec := newKlineRecorder()
+	m := NewKlineManager(newTestService(nil), fetcher, rec.onClosed)
+	m.Push(testKline(0, "ws0"))
+	m.Push(testKline(3*testMinute, "ws3"))
+	m.Push(testKline(4*testMinute, "ws4"))
+
+	// the fetched value of bar 0 replaces the stream one, bar 3 closed by the stream waits for the fill
+	want := []string{"0:rest0", "1:rest1", "2:rest2", "3:ws3"}
+	if got := rec.wait(t, 4); !slices.Equal(got, want) {
+		t.Fatalf("closed %v, want %v", got, want)
+	}
+	if k, ok := m.LastClosed("btc_usdt", "1m"); !ok || k.Time != 3*testMinute {
+		t.Fatalf("last closed %+v %v", k, ok)
+	}
+}
+
+func TestKlineManagerFetchWithoutLock(t *testing.T) {
+	fetcher := NewMemoryKlineFetcher()
+	fetcher.Add(testKline(testMinute, "rest1"))
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	rec := newKlineRecorder()
+	m := NewKlineManager(newTestService(nil), KlineFetchFunc(func(ctx context.Context, symbol, interval string, start, end int64) ([]KlineData, error) {
+		close(started)
+		<-release
+		return fetcher.FetchKlines(ctx, symbol, interval, start, end)
+	}), rec.onClosed)
+
+	m.Push(testKline(0, "ws0"))
+	m.Push(testKline(2*testMinute, "ws2"))
+	<-started
+
+	// the reader goroutine keeps going while the fetch is blocked
+	pushed := make(chan struct{})
+	go func() {
+		m.Push(testKline(3*testMinute, "ws3"))
+		m.LastClosed("btc_usdt", "1m")
+		close(pushed)
+	}()
+	select {
+	case <-pushed:
+	case <-time.After(time.Second):
+		t.Fatal("Push blocked by a running fetch")
+	}
+
+	close(release)
+	want := []string{"0:ws0", "1:rest1", "2:ws2"}
+	if got := rec.wait(t, 3); !slices.Equal(got, want) {
+		t.Fatalf("closed %v, want %v", got, want)
+	}
+}
+
+func TestKlineManagerBackfillContext(t *testing.T) {
+	type ctxKey struct{}
+	rec := newKlineRecorder()
+	m := NewKlineManager(newTestService(nil), KlineFetchFunc(func(ctx context.Context, _, _ string, start, _ int64) ([]KlineData, error) {
+		if ctx.Value(ctxKey{}) != "backfill" {
+			t.Error("fetch without the Backfill context")
+		}
+		return []KlineData{testKline(start, "rest")}, nil
+	}), rec.onClosed)
+
+	now := time.Now().UnixMilli()
+	open := now - now%testMinute - 5*testMinute
+	m.Push(testKline(open, "ws"))
+
+	m.Backfill(context.WithValue(context.Background(), ctxKey{}, "backfill"))
+	if got := rec.wait(t, 1); got[0] != strconv.FormatInt(open/testMinute, 10)+":rest" {
+		t.Fatalf("closed %v", got)
+	}
+	if _, ok := m.LastClosed("btc_usdt", "1m"); !ok {
+		t.Fatal("Backfill returned before the bars were closed")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	m.Backfill(ctx)
+}
+
+func TestRestKlineFetcherPages(t *testing.T) {
+	const total = 2500
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		start, _ := strconv.ParseInt(r.URL.Query().Get("startTime"), 10, 64)
+		end, _ := strconv.ParseInt(r.URL.Query().Get("endTime"), 10, 64)
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+
+		// newest first, cut to limit like the exchange
+		var result []KlineData
+		for i := int64(total - 1); i >= 0 && len(result) < limit; i-- {
+			if tm := i * testMinute; tm >= start && tm <= end {
+				result = append(result, KlineData{Time: tm, Close: strconv.FormatInt(i, 10)})
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"rc": 0, "result": result})
+	}))
+	defer srv.Close()
+
+	f := &RestKlineFetcher{BaseURL: srv.URL}
+	klines, err := f.FetchKlines(context.Background(), "btc_usdt", "1m", 0, (total-1)*testMinute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(klines) != total || requests != 3 {
+		t.Fatalf("got %d klines in %d requests, want %d in 3", len(klines), requests, total)
+	}
+	for i, k := range klines {
+		if k.Time != int64(i)*testMinute || k.Symbol != "btc_usdt" {
+			t.Fatalf("kline %d: %+v", i, k)
+		}
+	}
+}
+
+func TestKlineManagerClose(t *testing.T) {
+	srv := newTestServer(t, 0)
+	ws := srv.dial(t, nil)
+	rec := newKlineRecorder()
+	m := NewKlineManager(ws, NewMemoryKlineFetcher(), rec.onClosed)
+
+	if err := m.Subscribe([]string{"btc_usdt"}, "1m"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Subscribe([]string{"btc_usdt"}, "2m"); err == nil {
+		t.Fatal("invalid interval subscribed")
+	}
+	// another holder of the same channel
+	if err := ws.AcquireChannels([]string{"kline@btc_usdt,1m"}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the kline subscription", func() bool { return slices.Equal(srv.subscribed(), []string{"kline@btc_usdt,1m"}) })
+
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if m.ctx.Err() == nil {
+		t.Fatal("backfill context not canceled")
+	}
+	if v, ok := ws.listeners.Load(ChannelSpotKline); ok && len(v.([]listener)) != 0 {
+		t.Fatalf("%d kline listeners after Close", len(v.([]listener)))
+	}
+	ws.hookMu.Lock()
+	hooks := len(ws.onReconn)
+	ws.hookMu.Unlock()
+	if hooks != 0 {
+		t.Fatalf("%d reconnect hooks after Close", hooks)
+	}
+
+	// the other holder keeps the channel until it releases it
+	if !slices.Equal(srv.subscribed(), []string{"kline@btc_usdt,1m"}) {
+		t.Fatalf("subscribed %v after Close", srv.subscribed())
+	}
+	if err := ws.ReleaseChannels([]string{"kline@btc_usdt,1m"}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the kline unsubscribe", func() bool { return len(srv.subscribed()) == 0 })
+}
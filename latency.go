@@ -0,0 +1,169 @@
+package xtws
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// DefaultLatencyWindow number of samples kept for Latency and ClockOffset
+const DefaultLatencyWindow = 128
+
+// Metrics receives connection measurements, set it on ConnConf.Metrics
+type Metrics interface {
+	ObserveRTT(rtt time.Duration)            // every ping -> pong round trip
+	ObserveClockOffset(offset time.Duration) // offset estimate after every pong, see WsService.ClockOffset
+	PongTimeout(outstanding time.Duration)   // the watchdog is about to force a reconnect
+}
+
+// LatencyStats ping -> pong round trips over the last DefaultLatencyWindow pongs
+type LatencyStats struct {
+	Count int
+	Last  time.Duration
+	Min   time.Duration
+	Max   time.Duration
+	Mean  time.Duration
+	P50   time.Duration
+	P90   time.Duration
+	P99   time.Duration
+}
+
+// window rolling window of durations
+type window struct {
+	mu   *sync.Mutex
+	buf  []time.Duration
+	next int
+	last time.Duration
+}
+
+func newWindow(size int) *window {
+	return &window{mu: new(sync.Mutex), buf: make([]time.Duration, 0, size)}
+}
+
+func (w *window) add(d time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.last = d
+	if len(w.buf) < cap(w.buf) {
+		w.buf = append(w.buf, d)
+		return
+	}
+	w.buf[w.next] = d
+	w.next = (w.next + 1) % len(w.buf)
+}
+
+// sorted copy of the samples and the last one
+func (w *window) sorted() ([]time.Duration, time.Duration) {
+	w.mu.Lock()
+	samples := slices.Clone(w.buf)
+	last := w.last
+	w.mu.Unlock()
+
+	slices.Sort(samples)
+	return samples, last
+}
+
+// Latency ping -> pong round trip statistics, Count is 0 before the first pong
+func (ws *WsService) Latency() LatencyStats {
+	samples, last := ws.rtts.sorted()
+	if len(samples) == 0 {
+		return LatencyStats{}
+	}
+
+	var sum time.Duration
+	for _, d := range samples {
+		sum += d
+	}
+	quantile := func(q float64) time.Duration {
+		return samples[int(q*float64(len(samples)-1))]
+	}
+
+	return LatencyStats{
+		Count: len(samples),
+		Last:  last,
+		Min:   samples[0],
+		Max:   samples[len(samples)-1],
+		Mean:  sum / time.Duration(len(samples)),
+		P50:   quantile(0.5),
+		P90:   quantile(0.9),
+		P99:   quantile(0.99),
+	}
+}
+
+// ClockOffset estimate of exchange clock minus local clock, ok is false until a timestamped message arrived.
+// Each message gives t - receive time, that is the offset minus the one way delay; the least delayed
+// message of the window is taken and half of the minimum round trip is added back.
+func (ws *WsService) ClockOffset() (offset time.Duration, ok bool) {
+	samples, _ := ws.offsets.sorted()
+	if len(samples) == 0 {
+		return 0, false
+	}
+
+	offset = samples[len(samples)-1]
+	if rtts, _ := ws.rtts.sorted(); len(rtts) > 0 {
+		offset += rtts[0] / 2
+	}
+	return offset, true
+}
+
+// observePong a pong arrived, a pong without an outstanding ping is ignored
+func (ws *WsService) observePong(now time.Time) {
+	sent := ws.pingSent.Swap(0)
+	if sent == 0 {
+		return
+	}
+
+	rtt := now.Sub(time.Unix(0, sent))
+	ws.rtts.add(rtt)
+
+	if m := ws.conf.Metrics; m != nil {
+		m.ObserveRTT(rtt)
+		if offset, ok := ws.ClockOffset(); ok {
+			m.ObserveClockOffset(offset)
+		}
+	}
+}
+
+// observeTime t is the millisecond timestamp of a message received at now
+func (ws *WsService) observeTime(t int64, now time.Time) {
+	ws.offsets.add(time.UnixMilli(t).Sub(now))
+}
+
+// clockTopic topics whose data.t is the time the exchange produced the message, kline t is the bar open time
+func clockTopic(topic []byte) bool {
+	switch string(topic) {
+	case ChannelSpotDeep, ChannelSpotDepthUpdate, ChannelSpotTicker, ChannelSpotTrade,
+		ChannelFutureAggTicker, ChannelFutureMarkPrice, ChannelFutureIndexPrice:
+		return true
+	}
+	return false
+}
+
+// watchdog force a reconnect when the outstanding ping is older than PongTimeout,
+// returns true when the connection was closed
+func (ws *WsService) watchdog(now time.Time) bool {
+	if ws.conf.PongTimeout <= 0 {
+		return false
+	}
+	sent := ws.pingSent.Load()
+	if sent == 0 {
+		return false
+	}
+
+	outstanding := now.Sub(time.Unix(0, sent))
+	if outstanding < ws.conf.PongTimeout {
+		return false
+	}
+
+	ws.Logger.Printf("no pong for %s, reconnect", outstanding.Round(time.Millisecond))
+	if m := ws.conf.Metrics; m != nil {
+		m.PongTimeout(outstanding)
+	}
+	ws.pingSent.Store(0)
+	if d := ws.deadman.Load(); d != nil {
+		d.fire("pong timeout")
+	}
+	ws.dropConnection()
+	return true
+}
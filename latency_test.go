@@ -0,0 +1,145 @@
+package xtws
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// testMetrics records what the service observed
+type testMetrics struct {
+	mu       sync.Mutex
+	rtts     []time.Duration
+	offsets  []time.Duration
+	timeouts []time.Duration
+}
+
+func (m *testMetrics) ObserveRTT(rtt time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rtts = append(m.rtts, rtt)
+}
+
+func (m *testMetrics) ObserveClockOffset(offset time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.offsets = append(m.offsets, offset)
+}
+
+func (m *testMetrics) PongTimeout(outstanding time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.timeouts = append(m.timeouts, outstanding)
+}
+
+func (m *testMetrics) timeoutCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.timeouts)
+}
+
+func TestLatency(t *testing.T) {
+	ws := newTestService(nil)
+	ws.rtts = newWindow(4)
+	m := new(testMetrics)
+	ws.conf.Metrics = m
+
+	if stats := ws.Latency(); stats.Count != 0 {
+		t.Fatalf("stats %+v before the first pong", stats)
+	}
+
+	base := time.Unix(1700000000, 0)
+	for _, ms := range []time.Duration{40, 10, 30, 20, 50} {
+		ws.pingSent.Store(base.UnixNano())
+		ws.observePong(base.Add(ms * time.Millisecond))
+	}
+	// no ping outstanding
+	ws.observePong(base.Add(time.Second))
+
+	// the window keeps 10 30 20 50
+	want := LatencyStats{Count: 4, Last: 50 * time.Millisecond, Min: 10 * time.Millisecond, Max: 50 * time.Millisecond,
+		Mean: 27500 * time.Microsecond, P50: 20 * time.Millisecond, P90: 30 * time.Millisecond, P99: 30 * time.Millisecond}
+	if stats := ws.Latency(); stats != want {
+		t.Fatalf("stats %+v, want %+v", stats, want)
+	}
+	if len(m.rtts) != 5 || len(m.offsets) != 0 {
+		t.Fatalf("metrics got %d rtts %d offsets, want 5 and 0", len(m.rtts), len(m.offsets))
+	}
+}
+
+func TestClockOffset(t *testing.T) {
+	ws := newTestService(nil)
+	m := new(testMetrics)
+	ws.conf.Metrics = m
+
+	if _, ok := ws.ClockOffset(); ok {
+		t.Fatal("offset before any timestamped message")
+	}
+
+	// the exchange clock is 80ms ahead, messages take 20 to 180ms
+	local := time.UnixMilli(1700000000000)
+	ws.observeTime(local.Add(80*time.Millisecond).UnixMilli(), local.Add(180*time.Millisecond))
+	ws.observeTime(local.Add(180*time.Millisecond).UnixMilli(), local.Add(120*time.Millisecond))
+	offset, ok := ws.ClockOffset()
+	if !ok || offset != 60*time.Millisecond {
+		t.Fatalf("offset %s %v, want the least delayed message 60ms", offset, ok)
+	}
+
+	// half of the minimum round trip is added back
+	ws.pingSent.Store(local.UnixNano())
+	ws.observePong(local.Add(40 * time.Millisecond))
+	if offset, _ := ws.ClockOffset(); offset != 80*time.Millisecond {
+		t.Fatalf("offset %s, want 80ms", offset)
+	}
+	if len(m.offsets) != 1 || m.offsets[0] != 80*time.Millisecond {
+		t.Fatalf("metrics offsets %v", m.offsets)
+	}
+}
+
+func TestWatchdog(t *testing.T) {
+	ws := newTestService(nil)
+	m := new(testMetrics)
+	ws.conf.Metrics = m
+	base := time.Unix(1700000000, 0)
+
+	ws.pingSent.Store(base.UnixNano())
+	if ws.watchdog(base.Add(time.Hour)) {
+		t.Fatal("watchdog fired without PongTimeout")
+	}
+
+	ws.conf.PongTimeout = time.Second
+	if ws.watchdog(base.Add(999 * time.Millisecond)) {
+		t.Fatal("watchdog fired before the timeout")
+	}
+	if !ws.watchdog(base.Add(time.Second)) {
+		t.Fatal("watchdog did not fire at the timeout")
+	}
+	if ws.pingSent.Load() != 0 || len(m.timeouts) != 1 || m.timeouts[0] != time.Second {
+		t.Fatalf("ping %d timeouts %v after firing", ws.pingSent.Load(), m.timeouts)
+	}
+
+	// nothing outstanding anymore
+	if ws.watchdog(base.Add(time.Hour)) {
+		t.Fatal("watchdog fired twice for one ping")
+	}
+}
+
+func TestPongTimeoutReconnect(t *testing.T) {
+	srv := newTestServer(t, 0)
+	m := new(testMetrics)
+	ws := srv.dial(t, &ConfOptions{PingInterval: "10ms", PongTimeout: 30 * time.Millisecond, Metrics: m})
+	if err := ws.Subscribe([]string{"trade@btc_usdt"}); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.silent.Store(true)
+	waitFor(t, "the reconnect", func() bool { return srv.conns.Load() >= 2 })
+	if m.timeoutCount() == 0 {
+		t.Fatal("pong timeout not reported")
+	}
+
+	// pongs again on the new connection, the channels came back
+	srv.silent.Store(false)
+	waitFor(t, "the resubscribe", func() bool { return len(srv.subscribed()) == 1 })
+	waitFor(t, "a round trip", func() bool { return ws.Latency().Count > 0 })
+}
@@ -1,7 +1,6 @@
 package xtws
 
 import (
-	"encoding/json"
 	"fmt"
 )
 
@@ -17,35 +16,309 @@ type UpdateMsg struct {
 	Event string `json:"event"` //主题
 }
 
+// TickerData https://doc.xt.com/#websocket_public_cntickerRealTime
+type TickerData struct {
+	Symbol   string `json:"s"`  // symbol 交易对
+	Time     int64  `json:"t"`  // time 最后成交时间
+	PriceChg string `json:"cv"` // priceChangeValue 24⼩时价格变化
+	ChgRate  string `json:"cr"` // priceChangeRate 24⼩时价格变化(百分⽐)
+	Open     string `json:"o"`  // open 第⼀笔
+	Close    string `json:"c"`  // close 最后⼀笔
+	High     string `json:"h"`  // high 最⾼价
+	Low      string `json:"l"`  // low 最低价
+	Quantity string `json:"q"`  // quantity 成交量
+	Volume   string `json:"v"`  // volume 成交额
+}
+
+func (t *TickerData) OpenPrice() (Decimal, error)   { return ParseDecimal(t.Open) }
+func (t *TickerData) ClosePrice() (Decimal, error)  { return ParseDecimal(t.Close) }
+func (t *TickerData) HighPrice() (Decimal, error)   { return ParseDecimal(t.High) }
+func (t *TickerData) LowPrice() (Decimal, error)    { return ParseDecimal(t.Low) }
+func (t *TickerData) PriceChange() (Decimal, error) { return ParseDecimal(t.PriceChg) }
+func (t *TickerData) ChangeRate() (Decimal, error)  { return ParseDecimal(t.ChgRate) }
+func (t *TickerData) BaseVolume() (Decimal, error)  { return ParseDecimal(t.Quantity) }
+func (t *TickerData) QuoteVolume() (Decimal, error) { return ParseDecimal(t.Volume) }
+
 type UpdateTickerMsg struct {
 	Topic string `json:"topic"` //事件
 	Event string `json:"event"` //主题
 
-	Data struct {
-		Symbol   string `json:"s"`  // symbol 交易对
-		Time     int64  `json:"t"`  // time 最后成交时间
-		PriceChg string `json:"cv"` // priceChangeValue 24⼩时价格变化
-		ChgRate  string `json:"cr"` // priceChangeRate 24⼩时价格变化(百分⽐)
-		Open     string `json:"o"`  // open 第⼀笔
-		Close    string `json:"c"`  // close 最后⼀笔
-		High     string `json:"h"`  // high 最⾼价
-		Low      string `json:"l"`  // low 最低价
-		Quantity string `json:"q"`  // quantity 成交量
-		Volume   string `json:"v"`  // volume 成交额
-	} `json:"data"`
+	Data TickerData `json:"data"`
+}
+
+// UpdateTickersMsg https://doc.xt.com/#websocket_public_cnallTicker
+type UpdateTickersMsg struct {
+	Topic string `json:"topic"` //事件
+	Event string `json:"event"` //主题
+
+	Data []TickerData `json:"data"`
+}
+
+// MiniTickerData mini_ticker@{symbol}, the ticker without the change fields
+type MiniTickerData struct {
+	Symbol   string `json:"s"` // symbol 交易对
+	Time     int64  `json:"t"` // time 最后成交时间
+	Open     string `json:"o"` // open 第⼀笔
+	Close    string `json:"c"` // close 最后⼀笔
+	High     string `json:"h"` // high 最⾼价
+	Low      string `json:"l"` // low 最低价
+	Quantity string `json:"q"` // quantity 成交量
+	Volume   string `json:"v"` // volume 成交额
+}
+
+type UpdateMiniTickerMsg struct {
+	Topic string `json:"topic"` //事件
+	Event string `json:"event"` //主题
+
+	Data MiniTickerData `json:"data"`
+}
+
+// AggTickerData agg_ticker@{symbol}, the ticker with the best bid and ask
+type AggTickerData struct {
+	TickerData
+	BidPrice string `json:"bp"` // bid price 买一价
+	BidQty   string `json:"bq"` // bid quantity 买一量
+	AskPrice string `json:"ap"` // ask price 卖一价
+	AskQty   string `json:"aq"` // ask quantity 卖一量
+}
+
+type UpdateAggTickerMsg struct {
+	Topic string `json:"topic"` //事件
+	Event string `json:"event"` //主题
+
+	Data AggTickerData `json:"data"`
+}
+
+// DepthData https://doc.xt.com/#websocket_public_cnlimitDepth
+type DepthData struct {
+	Symbol   string      `json:"s"` // symbol 交易对
+	UpdateID int64       `json:"i"` // updateId
+	Time     int64       `json:"t"` // time 时间戳
+	Asks     PriceLevels `json:"a"` // asks 卖盘 [0]价格, [1]数量
+	Bids     PriceLevels `json:"b"` // bids 买盘
+}
+
+// PriceLevels order book side, each level is [price, quantity]
+type PriceLevels [][]string
+
+// PriceLevel a decoded order book level
+type PriceLevel struct {
+	Price    Decimal
+	Quantity Decimal
+}
+
+// Range calls f for each level in order until f returns false, malformed levels are skipped
+func (p PriceLevels) Range(f func(price, quantity Decimal) bool) {
+	for _, level := range p {
+		if len(level) < 2 {
+			continue
+		}
+		price, err := ParseDecimal(level[0])
+		if err != nil {
+			continue
+		}
+		quantity, err := ParseDecimal(level[1])
+		if err != nil {
+			continue
+		}
+		if !f(price, quantity) {
+			return
+		}
+	}
+}
+
+// Levels decode all levels
+func (p PriceLevels) Levels() []PriceLevel {
+	levels := make([]PriceLevel, 0, len(p))
+	p.Range(func(price, quantity Decimal) bool {
+		levels = append(levels, PriceLevel{Price: price, Quantity: quantity})
+		return true
+	})
+	return levels
+}
+
+// Best first level, ok is false when the side is empty
+func (p PriceLevels) Best() (level PriceLevel, ok bool) {
+	p.Range(func(price, quantity Decimal) bool {
+		level, ok = PriceLevel{Price: price, Quantity: quantity}, true
+		return false
+	})
+	return
 }
 
 type UpdateDepthMsg struct {
 	Topic string `json:"topic"` //事件
 	Event string `json:"event"` //主题
 
-	Data struct {
-		Symbol   string     `json:"s"` // symbol 交易对
-		UpdateID int64      `json:"i"` // updateId
-		Time     int64      `json:"t"` // time 时间戳
-		Asks     [][]string `json:"a"` // asks 卖盘 [0]价格, [1]数量
-		Bids     [][]string `json:"b"` // bids 买盘
-	} `json:"data"`
+	Data DepthData `json:"data"`
+}
+
+// DepthIncrData https://doc.xt.com/#websocket_public_cnincreDepth
+type DepthIncrData struct {
+	Symbol        string      `json:"s"`  // symbol 交易对
+	FirstUpdateID int64       `json:"fi"` // firstUpdateId = previous lastUpdateId + 1
+	LastUpdateID  int64       `json:"i"`  // lastUpdateId
+	Asks          PriceLevels `json:"a"`  // asks 卖盘 [0]价格, [1]数量, 数量为0时删除该价位
+	Bids          PriceLevels `json:"b"`  // bids 买盘
+}
+
+type UpdateDepthIncrMsg struct {
+	Topic string `json:"topic"` //事件
+	Event string `json:"event"` //主题
+
+	Data DepthIncrData `json:"data"`
+}
+
+// TradeData https://doc.xt.com/#websocket_public_cndealRecord
+type TradeData struct {
+	Symbol       string `json:"s"` // symbol 交易对
+	ID           int64  `json:"i"` // tradeId 成交ID
+	Time         int64  `json:"t"` // time 成交时间
+	Price        string `json:"p"` // price 成交价
+	Quantity     string `json:"q"` // quantity 成交量
+	IsBuyerMaker bool   `json:"b"` // isBuyerMaker 买方是否为挂单方, true表示主动卖出
+}
+
+func (t *TradeData) TradePrice() (Decimal, error)    { return ParseDecimal(t.Price) }
+func (t *TradeData) TradeQuantity() (Decimal, error) { return ParseDecimal(t.Quantity) }
+
+type UpdateTradeMsg struct {
+	Topic string `json:"topic"` //事件
+	Event string `json:"event"` //主题
+
+	Data TradeData `json:"data"`
+}
+
+// KlineData https://doc.xt.com/#websocket_public_cnsymbolKline
+type KlineData struct {
+	Symbol   string `json:"s"` // symbol 交易对
+	Time     int64  `json:"t"` // time 开盘时间
+	Interval string `json:"i"` // interval 周期
+	Open     string `json:"o"` // open 开盘价
+	Close    string `json:"c"` // close 收盘价
+	High     string `json:"h"` // high 最高价
+	Low      string `json:"l"` // low 最低价
+	Quantity string `json:"q"` // quantity 成交量
+	Volume   string `json:"v"` // volume 成交额
+}
+
+func (k *KlineData) OpenPrice() (Decimal, error)   { return ParseDecimal(k.Open) }
+func (k *KlineData) ClosePrice() (Decimal, error)  { return ParseDecimal(k.Close) }
+func (k *KlineData) HighPrice() (Decimal, error)   { return ParseDecimal(k.High) }
+func (k *KlineData) LowPrice() (Decimal, error)    { return ParseDecimal(k.Low) }
+func (k *KlineData) BaseVolume() (Decimal, error)  { return ParseDecimal(k.Quantity) }
+func (k *KlineData) QuoteVolume() (Decimal, error) { return ParseDecimal(k.Volume) }
+
+type UpdateKlineMsg struct {
+	Topic string `json:"topic"` //事件
+	Event string `json:"event"` //主题
+
+	Data KlineData `json:"data"`
+}
+
+// SpotBalanceData https://doc.xt.com/#websocket_private_cnbalanceChange
+type SpotBalanceData struct {
+	AccountID string `json:"a"` // accountId 账户ID
+	Time      int64  `json:"t"` // time 变动时间
+	Currency  string `json:"c"` // currency 币种
+	Balance   string `json:"b"` // balance 可用余额
+	Freeze    string `json:"f"` // freeze 冻结
+	BizType   string `json:"z"` // bizType SPOT, LEVER
+	Symbol    string `json:"s"` // symbol 杠杆交易对, bizType为LEVER时有值
+}
+
+func (b *SpotBalanceData) Available() (Decimal, error) { return ParseDecimal(b.Balance) }
+func (b *SpotBalanceData) Frozen() (Decimal, error)    { return optionalDecimal(b.Freeze) }
+func (b *SpotBalanceData) Total() (Decimal, error) {
+	available, err := b.Available()
+	if err != nil {
+		return Decimal{}, err
+	}
+	frozen, err := b.Frozen()
+	if err != nil {
+		return Decimal{}, err
+	}
+	return available.Add(frozen), nil
+}
+
+type UpdateSpotBalanceMsg struct {
+	Topic string `json:"topic"` //事件
+	Event string `json:"event"` //主题
+
+	Data SpotBalanceData `json:"data"`
+}
+
+// spot order states
+const (
+	OrderStateNew             = "NEW"
+	OrderStatePartiallyFilled = "PARTIALLY_FILLED"
+	OrderStateFilled          = "FILLED"
+	OrderStateCanceled        = "CANCELED"
+	OrderStateRejected        = "REJECTED"
+	OrderStateExpired         = "EXPIRED"
+)
+
+// SpotOrderData https://doc.xt.com/#websocket_private_cnorderChange
+type SpotOrderData struct {
+	Symbol        string `json:"s"`   // symbol 交易对
+	BaseCurrency  string `json:"bc"`  // baseCurrency 基础币种
+	Time          int64  `json:"t"`   // time 变动时间
+	CreateTime    int64  `json:"ct"`  // createTime 下单时间
+	OrderID       string `json:"i"`   // orderId 订单ID
+	ClientOrderID string `json:"ci"`  // clientOrderId 自定义订单ID
+	State         string `json:"st"`  // state NEW, PARTIALLY_FILLED, FILLED, CANCELED, REJECTED, EXPIRED
+	Side          string `json:"sd"`  // side BUY, SELL
+	Type          string `json:"tp"`  // type LIMIT, MARKET
+	OrigQty       string `json:"oq"`  // origQty 原始数量
+	OrigQuoteQty  string `json:"oqq"` // origQuoteQty 原始金额, 市价买单
+	ExecutedQty   string `json:"eq"`  // executedQty 已成交数量
+	LeavingQty    string `json:"lq"`  // leavingQty 待成交数量
+	Price         string `json:"p"`   // price 委托价格
+	AvgPrice      string `json:"ap"`  // avgPrice 成交均价
+	Fee           string `json:"f"`   // fee 手续费
+}
+
+func (o *SpotOrderData) OrderPrice() (Decimal, error)     { return optionalDecimal(o.Price) }
+func (o *SpotOrderData) OrderQuantity() (Decimal, error)  { return ParseDecimal(o.OrigQty) }
+func (o *SpotOrderData) FilledQuantity() (Decimal, error) { return optionalDecimal(o.ExecutedQty) }
+func (o *SpotOrderData) AveragePrice() (Decimal, error)   { return optionalDecimal(o.AvgPrice) }
+
+// Final the order can not change anymore
+func (o *SpotOrderData) Final() bool {
+	switch o.State {
+	case OrderStateFilled, OrderStateCanceled, OrderStateRejected, OrderStateExpired:
+		return true
+	}
+	return false
+}
+
+type UpdateSpotOrderMsg struct {
+	Topic string `json:"topic"` //事件
+	Event string `json:"event"` //主题
+
+	Data SpotOrderData `json:"data"`
+}
+
+// SpotUserTradeData https://doc.xt.com/#websocket_private_cnorderDeal
+type SpotUserTradeData struct {
+	Symbol        string `json:"s"`  // symbol 交易对
+	Time          int64  `json:"t"`  // time 成交时间
+	TradeID       string `json:"i"`  // tradeId 成交ID
+	OrderID       string `json:"oi"` // orderId 订单ID
+	ClientOrderID string `json:"ci"` // clientOrderId 自定义订单ID
+	Price         string `json:"p"`  // price 成交价
+	Quantity      string `json:"q"`  // quantity 成交量
+	QuoteQty      string `json:"v"`  // quoteQty 成交额
+}
+
+func (t *SpotUserTradeData) TradePrice() (Decimal, error)    { return ParseDecimal(t.Price) }
+func (t *SpotUserTradeData) TradeQuantity() (Decimal, error) { return ParseDecimal(t.Quantity) }
+
+type UpdateSpotUserTradeMsg struct {
+	Topic string `json:"topic"` //事件
+	Event string `json:"event"` //主题
+
+	Data SpotUserTradeData `json:"data"`
 }
 
 func (u *UpdateMsg) GetChannel() string {
@@ -65,6 +338,10 @@ func newAuthEmptyErr() error {
 	return fmt.Errorf("auth key or secret empty")
 }
 
+func newListenKeyEmptyErr() error {
+	return fmt.Errorf("listen key empty")
+}
+
 type WSEvent struct {
 	UpdateMsg
 }
@@ -79,15 +356,10 @@ type WebsocketRequest struct {
 }
 
 type Request struct {
-	Id     string   `json:"id,omitempty"`
-	Method string   `json:"method"`
-	Params []string `json:"params"`
-}
-
-type Auth struct {
-	Method string `json:"method"`
-	Key    string `json:"KEY"`
-	Secret string `json:"SIGN"`
+	Id        string   `json:"id,omitempty"`
+	Method    string   `json:"method"`
+	Params    []string `json:"params"`
+	ListenKey string   `json:"listenKey,omitempty"` // spot private topics
 }
 
 type requestHistory struct {
@@ -95,26 +367,3 @@ type requestHistory struct {
 	Method  string `json:"method"`
 	op      *SubscribeOptions
 }
-
-type APIReq struct {
-	ApiKey    string          `json:"api_key"`
-	Signature string          `json:"signature"`
-	Timestamp string          `json:"timestamp"`
-	ReqId     string          `json:"req_id"`
-	ReqHeader json.RawMessage `json:"req_header"`
-	ReqParam  json.RawMessage `json:"req_param"`
-}
-
-type APIResp struct {
-	ClientID   string `json:"client_id"`
-	ReqID      string `json:"req_id"`
-	RespTimeMs int64  `json:"resp_time_ms"`
-	Status     int    `json:"status"`
-	ReqHeader  struct {
-		XGateChannelID string `json:"x-gate-channel-id"`
-	} `json:"req_header"`
-	Data struct {
-		Error  any `json:"error"`
-		Result any `json:"result"`
-	} `json:"data"`
-}
@@ -0,0 +1,310 @@
+package xtws
+
+// https://doc.xt.com/#futures_market_websocket_v2base
+
+// FuturesTickerData ticker@{symbol}
+type FuturesTickerData struct {
+	Symbol  string `json:"s"` // symbol 交易对
+	Time    int64  `json:"t"` // time 时间戳
+	Open    string `json:"o"` // open 开盘价
+	Close   string `json:"c"` // close 最新价
+	High    string `json:"h"` // high 最高价
+	Low     string `json:"l"` // low 最低价
+	Amount  string `json:"a"` // amount 成交量(张)
+	Volume  string `json:"v"` // volume 成交额
+	ChgRate string `json:"r"` // rate 24小时涨跌幅
+}
+
+func (t *FuturesTickerData) OpenPrice() (Decimal, error)   { return ParseDecimal(t.Open) }
+func (t *FuturesTickerData) ClosePrice() (Decimal, error)  { return ParseDecimal(t.Close) }
+func (t *FuturesTickerData) HighPrice() (Decimal, error)   { return ParseDecimal(t.High) }
+func (t *FuturesTickerData) LowPrice() (Decimal, error)    { return ParseDecimal(t.Low) }
+func (t *FuturesTickerData) ChangeRate() (Decimal, error)  { return ParseDecimal(t.ChgRate) }
+func (t *FuturesTickerData) BaseVolume() (Decimal, error)  { return ParseDecimal(t.Amount) }
+func (t *FuturesTickerData) QuoteVolume() (Decimal, error) { return ParseDecimal(t.Volume) }
+
+type UpdateFuturesTickerMsg struct {
+	Topic string `json:"topic"` //事件
+	Event string `json:"event"` //主题
+
+	Data FuturesTickerData `json:"data"`
+}
+
+type UpdateFuturesTickersMsg struct {
+	Topic string `json:"topic"` //事件
+	Event string `json:"event"` //主题
+
+	Data []FuturesTickerData `json:"data"`
+}
+
+// FuturesAggTickerData agg_ticker@{symbol}
+type FuturesAggTickerData struct {
+	FuturesTickerData
+	IndexPrice string `json:"i"`  // index price 指数价格
+	MarkPrice  string `json:"m"`  // mark price 标记价格
+	BidPrice   string `json:"bp"` // bid price 买一价
+	AskPrice   string `json:"ap"` // ask price 卖一价
+}
+
+func (t *FuturesAggTickerData) IndexPriceValue() (Decimal, error) { return ParseDecimal(t.IndexPrice) }
+func (t *FuturesAggTickerData) MarkPriceValue() (Decimal, error)  { return ParseDecimal(t.MarkPrice) }
+func (t *FuturesAggTickerData) BestBid() (Decimal, error)         { return ParseDecimal(t.BidPrice) }
+func (t *FuturesAggTickerData) BestAsk() (Decimal, error)         { return ParseDecimal(t.AskPrice) }
+
+type UpdateFuturesAggTickerMsg struct {
+	Topic string `json:"topic"` //事件
+	Event string `json:"event"` //主题
+
+	Data FuturesAggTickerData `json:"data"`
+}
+
+type UpdateFuturesAggTickersMsg struct {
+	Topic string `json:"topic"` //事件
+	Event string `json:"event"` //主题
+
+	Data []FuturesAggTickerData `json:"data"`
+}
+
+// FuturesTradeData trade@{symbol}
+type FuturesTradeData struct {
+	Symbol    string `json:"s"` // symbol 交易对
+	Time      int64  `json:"t"` // time 成交时间
+	Price     string `json:"p"` // price 成交价
+	Quantity  string `json:"a"` // amount 成交量(张)
+	TakerSide string `json:"m"` // BID 主动买, ASK 主动卖
+}
+
+func (t *FuturesTradeData) TradePrice() (Decimal, error)    { return ParseDecimal(t.Price) }
+func (t *FuturesTradeData) TradeQuantity() (Decimal, error) { return ParseDecimal(t.Quantity) }
+
+type UpdateFuturesTradeMsg struct {
+	Topic string `json:"topic"` //事件
+	Event string `json:"event"` //主题
+
+	Data FuturesTradeData `json:"data"`
+}
+
+// FuturesDepthData depth@{symbol},{levels}
+type FuturesDepthData struct {
+	Symbol   string      `json:"s"`  // symbol 交易对
+	UpdateID int64       `json:"id"` // updateId
+	Time     int64       `json:"t"`  // time 时间戳
+	Asks     PriceLevels `json:"a"`  // asks 卖盘 [0]价格, [1]数量
+	Bids     PriceLevels `json:"b"`  // bids 买盘
+}
+
+type UpdateFuturesDepthMsg struct {
+	Topic string `json:"topic"` //事件
+	Event string `json:"event"` //主题
+
+	Data FuturesDepthData `json:"data"`
+}
+
+// FuturesDepthUpdateData depth_update@{symbol},{interval}
+type FuturesDepthUpdateData struct {
+	Symbol        string      `json:"s"`  // symbol 交易对
+	FirstUpdateID int64       `json:"fu"` // firstUpdateId
+	PrevUpdateID  int64       `json:"pu"` // lastUpdateId of previous push
+	LastUpdateID  int64       `json:"u"`  // lastUpdateId
+	Time          int64       `json:"t"`  // time 时间戳
+	Asks          PriceLevels `json:"a"`  // asks 卖盘 [0]价格, [1]数量, 数量为0时删除该价位
+	Bids          PriceLevels `json:"b"`  // bids 买盘
+}
+
+type UpdateFuturesDepthUpdateMsg struct {
+	Topic string `json:"topic"` //事件
+	Event string `json:"event"` //主题
+
+	Data FuturesDepthUpdateData `json:"data"`
+}
+
+// FuturesKlineData kline@{symbol},{interval}
+type FuturesKlineData struct {
+	Symbol   string `json:"s"` // symbol 交易对
+	Time     int64  `json:"t"` // time 开盘时间
+	Interval string `json:"i"` // interval 周期
+	Open     string `json:"o"` // open 开盘价
+	Close    string `json:"c"` // close 收盘价
+	High     string `json:"h"` // high 最高价
+	Low      string `json:"l"` // low 最低价
+	Amount   string `json:"a"` // amount 成交量(张)
+	Volume   string `json:"v"` // volume 成交额
+}
+
+func (k *FuturesKlineData) OpenPrice() (Decimal, error)   { return ParseDecimal(k.Open) }
+func (k *FuturesKlineData) ClosePrice() (Decimal, error)  { return ParseDecimal(k.Close) }
+func (k *FuturesKlineData) HighPrice() (Decimal, error)   { return ParseDecimal(k.High) }
+func (k *FuturesKlineData) LowPrice() (Decimal, error)    { return ParseDecimal(k.Low) }
+func (k *FuturesKlineData) BaseVolume() (Decimal, error)  { return ParseDecimal(k.Amount) }
+func (k *FuturesKlineData) QuoteVolume() (Decimal, error) { return ParseDecimal(k.Volume) }
+
+type UpdateFuturesKlineMsg struct {
+	Topic string `json:"topic"` //事件
+	Event string `json:"event"` //主题
+
+	Data FuturesKlineData `json:"data"`
+}
+
+// FuturesPriceData mark_price@{symbol} and index_price@{symbol}
+type FuturesPriceData struct {
+	Symbol string `json:"s"` // symbol 交易对
+	Price  string `json:"p"` // price 价格
+	Time   int64  `json:"t"` // time 时间戳
+}
+
+func (p *FuturesPriceData) Value() (Decimal, error) { return ParseDecimal(p.Price) }
+
+type UpdateFuturesMarkPriceMsg struct {
+	Topic string `json:"topic"` //事件
+	Event string `json:"event"` //主题
+
+	Data FuturesPriceData `json:"data"`
+}
+
+type UpdateFuturesIndexPriceMsg struct {
+	Topic string `json:"topic"` //事件
+	Event string `json:"event"` //主题
+
+	Data FuturesPriceData `json:"data"`
+}
+
+// FuturesFundingRateData funding_rate@{symbol}
+type FuturesFundingRateData struct {
+	Symbol string `json:"s"` // symbol 交易对
+	Rate   string `json:"r"` // rate 资金费率
+	Time   int64  `json:"t"` // time 时间戳
+}
+
+func (f *FuturesFundingRateData) FundingRate() (Decimal, error) { return ParseDecimal(f.Rate) }
+
+type UpdateFuturesFundingRateMsg struct {
+	Topic string `json:"topic"` //事件
+	Event string `json:"event"` //主题
+
+	Data FuturesFundingRateData `json:"data"`
+}
+
+// FuturesBalanceData balance@{listenKey}
+type FuturesBalanceData struct {
+	Coin                  string `json:"coin"`                  // 币种
+	UnderlyingType        int    `json:"underlyingType"`        // 1:币本位 2:U本位
+	WalletBalance         string `json:"walletBalance"`         // 钱包余额
+	OpenOrderMarginFrozen string `json:"openOrderMarginFrozen"` // 订单冻结
+	IsolatedMargin        string `json:"isolatedMargin"`        // 逐仓保证金
+	CrossedMargin         string `json:"crossedMargin"`         // 全仓保证金
+	AvailableBalance      string `json:"availableBalance"`      // 可用余额
+	Bonus                 string `json:"bonus"`                 // 体验金
+	Coupon                string `json:"coupon"`                // 抵扣金
+}
+
+func (b *FuturesBalanceData) Wallet() (Decimal, error)    { return ParseDecimal(b.WalletBalance) }
+func (b *FuturesBalanceData) Available() (Decimal, error) { return ParseDecimal(b.AvailableBalance) }
+func (b *FuturesBalanceData) Frozen() (Decimal, error) {
+	return optionalDecimal(b.OpenOrderMarginFrozen)
+}
+
+type UpdateFuturesBalanceMsg struct {
+	Topic string `json:"topic"` //事件
+	Event string `json:"event"` //主题
+
+	Data FuturesBalanceData `json:"data"`
+}
+
+// FuturesPositionData position@{listenKey}
+type FuturesPositionData struct {
+	Symbol                string `json:"symbol"`                // 交易对
+	ContractType          string `json:"contractType"`          // PERPETUAL, PREDICT
+	PositionType          string `json:"positionType"`          // CROSSED 全仓, ISOLATED 逐仓
+	PositionSide          string `json:"positionSide"`          // LONG, SHORT
+	PositionSize          string `json:"positionSize"`          // 持仓数量(张)
+	CloseOrderSize        string `json:"closeOrderSize"`        // 平仓挂单数量(张)
+	AvailableCloseSize    string `json:"availableCloseSize"`    // 可平仓数量(张)
+	RealizedProfit        string `json:"realizedProfit"`        // 已实现盈亏
+	EntryPrice            string `json:"entryPrice"`            // 开仓均价
+	OpenOrderSize         string `json:"openOrderSize"`         // 开仓挂单数量(张)
+	IsolatedMargin        string `json:"isolatedMargin"`        // 逐仓保证金
+	OpenOrderMarginFrozen string `json:"openOrderMarginFrozen"` // 开仓订单冻结保证金
+	UnderlyingType        string `json:"underlyingType"`        // COIN_BASED, U_BASED
+	Leverage              int    `json:"leverage"`              // 杠杆倍数
+}
+
+func (p *FuturesPositionData) Size() (Decimal, error)     { return ParseDecimal(p.PositionSize) }
+func (p *FuturesPositionData) Entry() (Decimal, error)    { return ParseDecimal(p.EntryPrice) }
+func (p *FuturesPositionData) Realized() (Decimal, error) { return optionalDecimal(p.RealizedProfit) }
+
+type UpdateFuturesPositionMsg struct {
+	Topic string `json:"topic"` //事件
+	Event string `json:"event"` //主题
+
+	Data FuturesPositionData `json:"data"`
+}
+
+// FuturesOrderData order@{listenKey}
+type FuturesOrderData struct {
+	Symbol        string `json:"symbol"`        // 交易对
+	OrderID       string `json:"orderId"`       // 订单ID
+	ClientOrderID string `json:"clientOrderId"` // 自定义订单ID
+	OrigQty       string `json:"origQty"`       // 原始数量(张)
+	AvgPrice      string `json:"avgPrice"`      // 成交均价
+	Price         string `json:"price"`         // 委托价格
+	ExecutedQty   string `json:"executedQty"`   // 已成交数量(张)
+	OrderSide     string `json:"orderSide"`     // BUY, SELL
+	PositionSide  string `json:"positionSide"`  // LONG, SHORT
+	MarginFrozen  string `json:"marginFrozen"`  // 冻结保证金
+	SourceType    string `json:"sourceType"`    // 来源
+	Type          string `json:"type"`          // LIMIT, MARKET
+	State         string `json:"state"`         // NEW, PARTIALLY_FILLED, FILLED, CANCELED, REJECTED, EXPIRED
+	CreatedTime   int64  `json:"createdTime"`   // 创建时间
+}
+
+func (o *FuturesOrderData) OrderPrice() (Decimal, error)     { return optionalDecimal(o.Price) }
+func (o *FuturesOrderData) OrderQuantity() (Decimal, error)  { return ParseDecimal(o.OrigQty) }
+func (o *FuturesOrderData) FilledQuantity() (Decimal, error) { return optionalDecimal(o.ExecutedQty) }
+func (o *FuturesOrderData) AveragePrice() (Decimal, error)   { return optionalDecimal(o.AvgPrice) }
+
+type UpdateFuturesOrderMsg struct {
+	Topic string `json:"topic"` //事件
+	Event string `json:"event"` //主题
+
+	Data FuturesOrderData `json:"data"`
+}
+
+// FuturesUserTradeData trade@{listenKey}
+type FuturesUserTradeData struct {
+	Symbol         string `json:"symbol"`         // 交易对
+	OrderID        string `json:"orderId"`        // 订单ID
+	ClientOrderID  string `json:"clientOrderId"`  // 自定义订单ID
+	Price          string `json:"price"`          // 成交价
+	Quantity       string `json:"quantity"`       // 成交数量(张)
+	MarginUnfrozen string `json:"marginUnfrozen"` // 解冻保证金
+	Timestamp      int64  `json:"timestamp"`      // 成交时间
+	OrderSide      string `json:"orderSide"`      // BUY, SELL
+	PositionSide   string `json:"positionSide"`   // LONG, SHORT
+	IsMaker        bool   `json:"isMaker"`        // 是否为挂单方
+	Fee            string `json:"fee"`            // 手续费
+}
+
+func (t *FuturesUserTradeData) TradePrice() (Decimal, error)    { return ParseDecimal(t.Price) }
+func (t *FuturesUserTradeData) TradeQuantity() (Decimal, error) { return ParseDecimal(t.Quantity) }
+func (t *FuturesUserTradeData) TradeFee() (Decimal, error)      { return optionalDecimal(t.Fee) }
+
+type UpdateFuturesUserTradeMsg struct {
+	Topic string `json:"topic"` //事件
+	Event string `json:"event"` //主题
+
+	Data FuturesUserTradeData `json:"data"`
+}
+
+// FuturesNotifyData notify@{listenKey}
+type FuturesNotifyData struct {
+	Title      string `json:"title"`      // 标题
+	Content    string `json:"content"`    // 内容
+	NoticeType string `json:"noticeType"` // 通知类型
+}
+
+type UpdateFuturesNotifyMsg struct {
+	Topic string `json:"topic"` //事件
+	Event string `json:"event"` //主题
+
+	Data FuturesNotifyData `json:"data"`
+}
@@ -0,0 +1,191 @@
+package xtws
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// OrderAck exchange acknowledgement of a placed or amended order
+type OrderAck struct {
+	OrderID       string
+	ClientOrderID string
+	ModifyID      string // set for amendments
+}
+
+// OrderRejectError order refused by the exchange
+type OrderRejectError struct {
+	Symbol string
+	Code   string // mc of the response, e.g. ORDER_PRICE_INVALID
+}
+
+func (e *OrderRejectError) Error() string {
+	return fmt.Sprintf("order %s rejected: %s", e.Symbol, e.Code)
+}
+
+// RestOrderData order of the REST api, https://doc.xt.com/#orderorderGet
+type RestOrderData struct {
+	Symbol        string      `json:"symbol"`        // 交易对
+	OrderID       json.Number `json:"orderId"`       // 订单ID
+	ClientOrderID string      `json:"clientOrderId"` // 自定义订单ID
+	BaseCurrency  string      `json:"baseCurrency"`  // 基础币种
+	QuoteCurrency string      `json:"quoteCurrency"` // 报价币种
+	Side          string      `json:"side"`          // BUY, SELL
+	Type          string      `json:"type"`          // LIMIT, MARKET
+	TimeInForce   string      `json:"timeInForce"`   // GTC, IOC, FOK, GTX
+	Price         string      `json:"price"`         // 委托价格
+	OrigQty       string      `json:"origQty"`       // 原始数量
+	OrigQuoteQty  string      `json:"origQuoteQty"`  // 原始金额
+	ExecutedQty   string      `json:"executedQty"`   // 已成交数量
+	LeavingQty    string      `json:"leavingQty"`    // 待成交数量
+	TradeBase     string      `json:"tradeBase"`     // 成交数量
+	TradeQuote    string      `json:"tradeQuote"`    // 成交金额
+	AvgPrice      string      `json:"avgPrice"`      // 成交均价
+	Fee           string      `json:"fee"`           // 手续费
+	FeeCurrency   string      `json:"feeCurrency"`   // 手续费币种
+	Closed        bool        `json:"closed"`        // 是否已结束
+	State         string      `json:"state"`         // NEW, PARTIALLY_FILLED, FILLED, CANCELED, REJECTED, EXPIRED
+	Time          int64       `json:"time"`          // 下单时间
+	UpdatedTime   int64       `json:"updatedTime"`   // 更新时间
+}
+
+// OrderSender sends orders checked by the WsService risk checks
+type OrderSender interface {
+	PlaceOrder(ctx context.Context, o *OrderIntent) (OrderAck, error)
+	AmendOrder(ctx context.Context, o *OrderIntent) (OrderAck, error)
+}
+
+// RestOrderSender spot order entry, https://doc.xt.com/#orderorderPost and https://doc.xt.com/#orderorderPut
+type RestOrderSender struct {
+	BaseURL    string // default RestBaseUrl
+	Key        string
+	Secret     string
+	BizType    string        // default SPOT
+	RecvWindow time.Duration // default 5s
+	Client     *http.Client
+}
+
+type restOrderResp struct {
+	Rc     int             `json:"rc"`
+	Mc     string          `json:"mc"`
+	Result restOrderResult `json:"result"`
+}
+
+type restOrderResult struct {
+	OrderID  json.Number `json:"orderId"`
+	ModifyID json.Number `json:"modifyId"`
+}
+
+// PlaceOrder a limit order with a price, else a market order. Market buys need QuoteQty.
+// Type, timeInForce and the other optional fields can be given in Params.
+func (s *RestOrderSender) PlaceOrder(ctx context.Context, o *OrderIntent) (OrderAck, error) {
+	params := map[string]any{
+		"symbol":  o.Symbol,
+		"side":    strings.ToUpper(o.Side),
+		"bizType": cmp.Or(s.BizType, "SPOT"),
+	}
+	if o.Price.IsZero() {
+		params["type"] = "MARKET"
+		params["timeInForce"] = "IOC"
+	} else {
+		params["type"] = "LIMIT"
+		params["timeInForce"] = "GTC"
+		params["price"] = o.Price.String()
+	}
+	if !o.QuoteQty.IsZero() {
+		params["quoteQty"] = o.QuoteQty.String()
+	} else {
+		params["quantity"] = o.Quantity.String()
+	}
+	if o.ClientOrderID != "" {
+		params["clientOrderId"] = o.ClientOrderID
+	}
+	maps.Copy(params, o.Params)
+
+	res, err := s.do(ctx, http.MethodPost, "/v4/order", o.Symbol, params)
+	if err != nil {
+		return OrderAck{}, err
+	}
+	return OrderAck{OrderID: res.OrderID.String(), ClientOrderID: o.ClientOrderID}, nil
+}
+
+// AmendOrder change the price and quantity of the order o.OrderID
+func (s *RestOrderSender) AmendOrder(ctx context.Context, o *OrderIntent) (OrderAck, error) {
+	if o.OrderID == "" {
+		return OrderAck{}, fmt.Errorf("amend order: order id empty")
+	}
+	params := map[string]any{
+		"price":    o.Price.String(),
+		"quantity": o.Quantity.String(),
+	}
+	maps.Copy(params, o.Params)
+
+	res, err := s.do(ctx, http.MethodPut, "/v4/order/"+o.OrderID, o.Symbol, params)
+	if err != nil {
+		return OrderAck{}, err
+	}
+	return OrderAck{OrderID: cmp.Or(res.OrderID.String(), o.OrderID), ClientOrderID: o.ClientOrderID, ModifyID: res.ModifyID.String()}, nil
+}
+
+func (s *RestOrderSender) do(ctx context.Context, method, path, symbol string, params map[string]any) (*restOrderResult, error) {
+	if s.Key == "" || s.Secret == "" {
+		return nil, newAuthEmptyErr()
+	}
+	base := s.BaseURL
+	if base == "" {
+		base = RestBaseUrl
+	}
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	recvWindow := s.RecvWindow
+	if recvWindow <= 0 {
+		recvWindow = 5 * time.Second
+	}
+
+	body, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, base+path, strings.NewReader(string(body)))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range SignRestHeaders(s.Key, s.Secret, method, path, "", string(body), recvWindow, time.Now()) {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// rejects come with a 4xx status and an rc/mc body
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var res restOrderResp
+	if err := json.Unmarshal(b, &res); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("order %s: http status %d", symbol, resp.StatusCode)
+		}
+		return nil, err
+	}
+	if res.Rc != 0 {
+		return nil, &OrderRejectError{Symbol: symbol, Code: res.Mc}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("order %s: http status %d", symbol, resp.StatusCode)
+	}
+	return &res.Result, nil
+}
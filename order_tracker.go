@@ -0,0 +1,452 @@
+package xtws
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+	"time"
+)
+
+// OrderStatePending submitted, not acknowledged by the exchange yet
+const OrderStatePending = "PENDING"
+
+// TrackedOrder order state rebuilt from private pushes and api responses
+type TrackedOrder struct {
+	Account       string
+	Symbol        string
+	OrderID       string // exchange id, empty while pending
+	ClientOrderID string // ci of private pushes, clientOrderId of api orders
+	Side          string
+	Type          string
+	State         string // OrderStatePending, OrderStateNew, ... see SpotOrderData.State
+	Reason        string // rejection reason
+	Price         Decimal
+	Quantity      Decimal
+	Filled        Decimal // cumulative filled quantity
+	FilledQuote   Decimal // cumulative filled quote amount, from user trades
+	AvgPrice      Decimal
+	Fee           Decimal
+	CreateTime    int64 // milliseconds
+	UpdateTime    int64 // milliseconds, time of the latest applied order update
+
+	trades      map[string]bool // applied trade ids
+	tradeFilled Decimal         // quantity of the applied trades
+	orderFilled Decimal         // highest executed quantity of the order updates
+	orderAvg    Decimal         // average price of that update
+}
+
+// Final the order can not change anymore
+func (o *TrackedOrder) Final() bool {
+	return orderStateRank(o.State) >= orderStateRank(OrderStateFilled)
+}
+
+// Remaining quantity left to fill
+func (o *TrackedOrder) Remaining() Decimal {
+	return MaxDecimal(o.Quantity.Sub(o.Filled), Decimal{})
+}
+
+func orderStateRank(state string) int {
+	switch state {
+	case OrderStatePending:
+		return 1
+	case OrderStateNew:
+		return 2
+	case OrderStatePartiallyFilled:
+		return 3
+	case OrderStateFilled, OrderStateCanceled, OrderStateRejected, OrderStateExpired:
+		return 4
+	}
+	return 0
+}
+
+type orderKey struct {
+	account string
+	id      string
+}
+
+// OrderTracker maintains order lifecycles out of private order updates, user trades and api responses.
+// Events may arrive in any order: an update older than the applied one or moving the state backwards
+// only fills in missing fields, trades are counted once by trade id.
+// Orders are keyed per account, use "" as account with a single connection.
+type OrderTracker struct {
+	mu        *sync.Mutex
+	byID      map[orderKey]*TrackedOrder
+	byClient  map[orderKey]*TrackedOrder
+	onChange  []orderHandler
+	handlerID uint64
+}
+
+type orderHandler struct {
+	id uint64
+	f  func(TrackedOrder)
+}
+
+func NewOrderTracker() *OrderTracker {
+	return &OrderTracker{
+		mu:       new(sync.Mutex),
+		byID:     make(map[orderKey]*TrackedOrder),
+		byClient: make(map[orderKey]*TrackedOrder),
+	}
+}
+
+// OnChange f is called with a copy of the order after every change, under the tracker lock.
+// The returned func removes f.
+func (t *OrderTracker) OnChange(f func(o TrackedOrder)) (remove func()) {
+	if f == nil {
+		return func() {}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.handlerID++
+	id := t.handlerID
+	t.onChange = append(slices.Clip(t.onChange), orderHandler{id: id, f: f})
+
+	return func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.onChange = slices.DeleteFunc(slices.Clone(t.onChange), func(h orderHandler) bool { return h.id == id })
+	}
+}
+
+// Attach feed the private events of every account of m, malformed events are logged on the manager logger
+func (t *OrderTracker) Attach(m *AccountManager) (remove func()) {
+	return m.OnEvent(func(ev *AccountEvent) {
+		if err := t.Handle(ev); err != nil {
+			m.conf.Logger.Printf("order tracker account %s skip %s err:%s", ev.Account, ev.Topic, err.Error())
+		}
+	})
+}
+
+// AttachService feed the private order and trade pushes of a single connection, tracked with account ""
+func (t *OrderTracker) AttachService(ws *WsService) (remove func()) {
+	removeOrder := ws.AddCallBack(ChannelSpotOrder, ws.NewSpotOrderCallBack(func(msg *UpdateSpotOrderMsg) {
+		if err := t.ApplyOrder("", &msg.Data); err != nil {
+			ws.Logger.Printf("order tracker skip order err:%s", err.Error())
+		}
+	}))
+	removeTrade := ws.AddCallBack(ChannelSpotUserTrade, ws.NewSpotUserTradeCallBack(func(msg *UpdateSpotUserTradeMsg) {
+		if err := t.ApplyTrade("", &msg.Data); err != nil {
+			ws.Logger.Printf("order tracker skip trade err:%s", err.Error())
+		}
+	}))
+	return func() {
+		removeOrder()
+		removeTrade()
+	}
+}
+
+// Handle apply an account event
+func (t *OrderTracker) Handle(ev *AccountEvent) error {
+	switch {
+	case ev.Order != nil:
+		return t.ApplyOrder(ev.Account, ev.Order)
+	case ev.Trade != nil:
+		return t.ApplyTrade(ev.Account, ev.Trade)
+	}
+	return nil
+}
+
+// Submitted track an order sent but not acknowledged yet, it is found by ClientOrderID
+func (t *OrderTracker) Submitted(account string, o TrackedOrder) {
+	if o.ClientOrderID == "" {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := orderKey{account: account, id: o.ClientOrderID}
+	if _, ok := t.byClient[key]; ok {
+		return
+	}
+	o.Account = account
+	o.State = OrderStatePending
+	if o.CreateTime == 0 {
+		o.CreateTime = time.Now().UnixMilli()
+	}
+	o.trades = nil
+	t.byClient[key] = &o
+	t.changed(&o)
+}
+
+// Rejected the exchange refused a submitted order
+func (t *OrderTracker) Rejected(account, clientOrderID, reason string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	o, ok := t.byClient[orderKey{account: account, id: clientOrderID}]
+	if !ok || o.Final() {
+		return
+	}
+	o.State = OrderStateRejected
+	o.Reason = reason
+	o.UpdateTime = time.Now().UnixMilli()
+	t.changed(o)
+}
+
+// ApplyOrder apply a private order update, an update with a malformed number is rejected
+func (t *OrderTracker) ApplyOrder(account string, d *SpotOrderData) error {
+	if d.OrderID == "" {
+		return nil
+	}
+	price, err := d.OrderPrice()
+	if err != nil {
+		return err
+	}
+	qty, err := d.OrderQuantity()
+	if err != nil {
+		return err
+	}
+	filled, err := d.FilledQuantity()
+	if err != nil {
+		return err
+	}
+	avg, err := d.AveragePrice()
+	if err != nil {
+		return err
+	}
+	fee, err := optionalDecimal(d.Fee)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	o := t.lookup(account, d.OrderID, d.ClientOrderID)
+	fillEmpty(&o.Symbol, d.Symbol)
+	fillEmpty(&o.Side, d.Side)
+	fillEmpty(&o.Type, d.Type)
+	if o.Price.IsZero() {
+		o.Price = price
+	}
+	if o.Quantity.IsZero() {
+		o.Quantity = qty
+	}
+	if o.CreateTime == 0 {
+		o.CreateTime = d.CreateTime
+	}
+
+	// the state only moves forward, updates of the same state apply in time order
+	switch rank, cur := orderStateRank(d.State), orderStateRank(o.State); {
+	case o.Final():
+	case rank > cur, rank == cur && d.Time >= o.UpdateTime:
+		o.State = d.State
+		o.UpdateTime = max(o.UpdateTime, d.Time)
+		o.Fee = MaxDecimal(o.Fee, fee)
+	}
+	if filled.GreaterThan(o.orderFilled) {
+		o.orderFilled = filled
+		o.orderAvg = avg
+	}
+	o.fills()
+	t.changed(o)
+	return nil
+}
+
+// ApplyTrade apply a private user trade, a trade arriving before its order creates the order.
+// A trade with a malformed number is rejected.
+func (t *OrderTracker) ApplyTrade(account string, d *SpotUserTradeData) error {
+	if d.OrderID == "" {
+		return nil
+	}
+	price, err := d.TradePrice()
+	if err != nil {
+		return err
+	}
+	qty, err := d.TradeQuantity()
+	if err != nil {
+		return err
+	}
+	quote, err := optionalDecimal(d.QuoteQty)
+	if err != nil {
+		return err
+	}
+	if quote.IsZero() {
+		quote = qty.Mul(price)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	o := t.lookup(account, d.OrderID, d.ClientOrderID)
+	if d.TradeID != "" {
+		if o.trades[d.TradeID] {
+			return nil
+		}
+		if o.trades == nil {
+			o.trades = make(map[string]bool)
+		}
+		o.trades[d.TradeID] = true
+	}
+	fillEmpty(&o.Symbol, d.Symbol)
+
+	o.tradeFilled = o.tradeFilled.Add(qty)
+	o.FilledQuote = o.FilledQuote.Add(quote)
+	o.fills()
+
+	switch {
+	case o.Final():
+	case !o.Quantity.IsZero() && !o.Filled.LessThan(o.Quantity):
+		o.State = OrderStateFilled
+	case orderStateRank(o.State) < orderStateRank(OrderStatePartiallyFilled):
+		o.State = OrderStatePartiallyFilled
+	}
+	t.changed(o)
+	return nil
+}
+
+// ApplyAPIOrder apply an order returned by the REST api, e.g. GET /v4/order
+func (t *OrderTracker) ApplyAPIOrder(account string, a *RestOrderData) error {
+	if a.OrderID == "" {
+		return nil
+	}
+	return t.ApplyOrder(account, &SpotOrderData{
+		Symbol:        a.Symbol,
+		BaseCurrency:  a.BaseCurrency,
+		Time:          a.UpdatedTime,
+		CreateTime:    a.Time,
+		OrderID:       a.OrderID.String(),
+		ClientOrderID: a.ClientOrderID,
+		State:         a.State,
+		Side:          a.Side,
+		Type:          a.Type,
+		OrigQty:       a.OrigQty,
+		OrigQuoteQty:  a.OrigQuoteQty,
+		ExecutedQty:   a.ExecutedQty,
+		LeavingQty:    a.LeavingQty,
+		Price:         a.Price,
+		AvgPrice:      a.AvgPrice,
+		Fee:           a.Fee,
+	})
+}
+
+// fills Filled is the larger of the order updates and the trades, the average price comes from
+// the trades once they cover the fills, from the order update otherwise
+func (o *TrackedOrder) fills() {
+	o.Filled = MaxDecimal(o.orderFilled, o.tradeFilled)
+	switch {
+	case !o.tradeFilled.IsZero() && !o.tradeFilled.LessThan(o.Filled):
+		o.AvgPrice = o.FilledQuote.Div(o.tradeFilled, 12).Normalize()
+	case !o.orderAvg.IsZero():
+		o.AvgPrice = o.orderAvg
+	}
+}
+
+// lookup the order by exchange id, linking a pending order by client id, creating it when unknown. t.mu must be held.
+func (t *OrderTracker) lookup(account, orderID, clientOrderID string) *TrackedOrder {
+	idKey := orderKey{account: account, id: orderID}
+	if o, ok := t.byID[idKey]; ok {
+		if clientOrderID != "" && o.ClientOrderID == "" {
+			o.ClientOrderID = clientOrderID
+			t.byClient[orderKey{account: account, id: clientOrderID}] = o
+		}
+		return o
+	}
+
+	var o *TrackedOrder
+	if clientOrderID != "" {
+		o = t.byClient[orderKey{account: account, id: clientOrderID}]
+	}
+	if o == nil {
+		o = &TrackedOrder{Account: account, ClientOrderID: clientOrderID}
+		if clientOrderID != "" {
+			t.byClient[orderKey{account: account, id: clientOrderID}] = o
+		}
+	}
+	o.OrderID = orderID
+	t.byID[idKey] = o
+	return o
+}
+
+func fillEmpty(dst *string, v string) {
+	if *dst == "" {
+		*dst = v
+	}
+}
+
+// changed t.mu must be held
+func (t *OrderTracker) changed(o *TrackedOrder) {
+	for _, h := range t.onChange {
+		h.f(o.copy())
+	}
+}
+
+func (o *TrackedOrder) copy() TrackedOrder {
+	c := *o
+	c.trades = nil
+	return c
+}
+
+// ByOrderID order by exchange id
+func (t *OrderTracker) ByOrderID(account, orderID string) (TrackedOrder, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	o, ok := t.byID[orderKey{account: account, id: orderID}]
+	if !ok {
+		return TrackedOrder{}, false
+	}
+	return o.copy(), true
+}
+
+// ByClientOrderID order by client order id, the clientOrderId of api orders or ci of private pushes
+func (t *OrderTracker) ByClientOrderID(account, clientOrderID string) (TrackedOrder, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	o, ok := t.byClient[orderKey{account: account, id: clientOrderID}]
+	if !ok {
+		return TrackedOrder{}, false
+	}
+	return o.copy(), true
+}
+
+// Open orders not final yet of every account, oldest first
+func (t *OrderTracker) Open() []TrackedOrder {
+	t.mu.Lock()
+	var res []TrackedOrder
+	for _, o := range t.all() {
+		if !o.Final() {
+			res = append(res, o.copy())
+		}
+	}
+	t.mu.Unlock()
+
+	slices.SortFunc(res, func(a, b TrackedOrder) int {
+		return cmp.Or(cmp.Compare(a.CreateTime, b.CreateTime), cmp.Compare(a.OrderID, b.OrderID))
+	})
+	return res
+}
+
+// Prune forget final orders last updated before, returns the number of orders removed
+func (t *OrderTracker) Prune(before time.Time) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	n := 0
+	for _, o := range t.all() {
+		if !o.Final() || o.UpdateTime >= before.UnixMilli() {
+			continue
+		}
+		delete(t.byID, orderKey{account: o.Account, id: o.OrderID})
+		delete(t.byClient, orderKey{account: o.Account, id: o.ClientOrderID})
+		n++
+	}
+	return n
+}
+
+// all distinct orders, pending ones are only in byClient. t.mu must be held.
+func (t *OrderTracker) all() []*TrackedOrder {
+	seen := make(map[*TrackedOrder]bool, len(t.byClient)+len(t.byID))
+	var res []*TrackedOrder
+	for _, m := range []map[orderKey]*TrackedOrder{t.byID, t.byClient} {
+		for _, o := range m {
+			if !seen[o] {
+				seen[o] = true
+				res = append(res, o)
+			}
+		}
+	}
+	return res
+}
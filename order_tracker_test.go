@@ -0,0 +1,198 @@
+package xtws
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func orderUpdate(state string, t int64, executed, avg string) *SpotOrderData {
+	return &SpotOrderData{Symbol: "btc_usdt", OrderID: "1", ClientOrderID: "t-1", State: state, Side: "BUY", Type: "LIMIT",
+		OrigQty: "1", ExecutedQty: executed, Price: "30000", AvgPrice: avg, Time: t, CreateTime: 1}
+}
+
+func userTrade(id, qty, price string) *SpotUserTradeData {
+	return &SpotUserTradeData{Symbol: "btc_usdt", TradeID: id, OrderID: "1", ClientOrderID: "t-1", Price: price, Quantity: qty}
+}
+
+func mustApplyOrder(t *testing.T, tr *OrderTracker, d *SpotOrderData) TrackedOrder {
+	t.Helper()
+	if err := tr.ApplyOrder("", d); err != nil {
+		t.Fatal(err)
+	}
+	o, _ := tr.ByOrderID("", d.OrderID)
+	return o
+}
+
+func TestOrderTrackerLifecycle(t *testing.T) {
+	for _, final := range []string{OrderStateFilled, OrderStateCanceled, OrderStateRejected} {
+		t.Run(final, func(t *testing.T) {
+			tr := NewOrderTracker()
+			var states []string
+			tr.OnChange(func(o TrackedOrder) { states = append(states, o.State) })
+
+			tr.Submitted("", TrackedOrder{Symbol: "btc_usdt", ClientOrderID: "t-1"})
+			if o, ok := tr.ByClientOrderID("", "t-1"); !ok || o.State != OrderStatePending {
+				t.Fatalf("pending order %+v %v", o, ok)
+			}
+			if _, ok := tr.ByOrderID("", "1"); ok {
+				t.Fatal("pending order found by exchange id")
+			}
+
+			mustApplyOrder(t, tr, orderUpdate(OrderStateNew, 1, "0", ""))
+			o := mustApplyOrder(t, tr, orderUpdate(OrderStatePartiallyFilled, 2, "0.4", "30000"))
+			if !o.Filled.Equal(MustParseDecimal("0.4")) || !o.Remaining().Equal(MustParseDecimal("0.6")) {
+				t.Fatalf("filled %s remaining %s", o.Filled, o.Remaining())
+			}
+			o = mustApplyOrder(t, tr, orderUpdate(final, 3, "0.4", "30000"))
+			if !o.Final() || o.State != final || o.UpdateTime != 3 {
+				t.Fatalf("order %s at %d, want %s at 3", o.State, o.UpdateTime, final)
+			}
+
+			want := []string{OrderStatePending, OrderStateNew, OrderStatePartiallyFilled, final}
+			if len(states) != len(want) {
+				t.Fatalf("changes %v, want %v", states, want)
+			}
+			for i := range want {
+				if states[i] != want[i] {
+					t.Fatalf("changes %v, want %v", states, want)
+				}
+			}
+			if len(tr.Open()) != 0 {
+				t.Fatalf("open %v", tr.Open())
+			}
+		})
+	}
+}
+
+func TestOrderTrackerRejected(t *testing.T) {
+	tr := NewOrderTracker()
+	tr.Submitted("", TrackedOrder{Symbol: "btc_usdt", ClientOrderID: "t-1"})
+	tr.Rejected("", "t-1", "ORDER_PRICE_INVALID")
+
+	o, _ := tr.ByClientOrderID("", "t-1")
+	if o.State != OrderStateRejected || o.Reason != "ORDER_PRICE_INVALID" || o.UpdateTime == 0 {
+		t.Fatalf("order %+v", o)
+	}
+	if n := tr.Prune(time.Now().Add(-time.Minute)); n != 0 {
+		t.Fatalf("pruned %d orders rejected just now", n)
+	}
+	if n := tr.Prune(time.Now().Add(time.Minute)); n != 1 {
+		t.Fatalf("pruned %d orders", n)
+	}
+}
+
+func TestOrderTrackerOutOfOrder(t *testing.T) {
+	tr := NewOrderTracker()
+
+	// the state never moves backwards
+	mustApplyOrder(t, tr, orderUpdate(OrderStateFilled, 3, "1", "30000"))
+	o := mustApplyOrder(t, tr, orderUpdate(OrderStatePartiallyFilled, 2, "0.4", "30000"))
+	o = mustApplyOrder(t, tr, orderUpdate(OrderStateNew, 1, "0", ""))
+	if o.State != OrderStateFilled || o.UpdateTime != 3 || !o.Filled.Equal(MustParseDecimal("1")) {
+		t.Fatalf("order %s at %d filled %s", o.State, o.UpdateTime, o.Filled)
+	}
+
+	// updates of the same state apply in time order, the executed quantity only grows
+	tr = NewOrderTracker()
+	mustApplyOrder(t, tr, orderUpdate(OrderStatePartiallyFilled, 5, "0.5", "30000"))
+	o = mustApplyOrder(t, tr, orderUpdate(OrderStatePartiallyFilled, 4, "0.3", "29000"))
+	if o.UpdateTime != 5 || !o.Filled.Equal(MustParseDecimal("0.5")) || !o.AvgPrice.Equal(MustParseDecimal("30000")) {
+		t.Fatalf("order at %d filled %s avg %s", o.UpdateTime, o.Filled, o.AvgPrice)
+	}
+
+	if err := tr.ApplyOrder("", orderUpdate(OrderStateNew, 6, "x", "")); err == nil {
+		t.Fatal("malformed executed quantity applied")
+	}
+}
+
+func TestOrderTrackerTrades(t *testing.T) {
+	tr := NewOrderTracker()
+
+	// a trade before its order creates it, found by both ids
+	if err := tr.ApplyTrade("", userTrade("10", "0.1", "30000")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.ApplyTrade("", userTrade("10", "0.1", "30000")); err != nil {
+		t.Fatal(err)
+	}
+	byID, ok := tr.ByOrderID("", "1")
+	if !ok || byID.State != OrderStatePartiallyFilled || !byID.Filled.Equal(MustParseDecimal("0.1")) {
+		t.Fatalf("order %+v after a duplicate trade", byID)
+	}
+	if byClient, ok := tr.ByClientOrderID("", "t-1"); !ok || byClient.OrderID != "1" {
+		t.Fatalf("order by client id %+v", byClient)
+	}
+
+	// the trades cover the fills: average from the trades
+	tr.ApplyTrade("", userTrade("11", "0.1", "31000"))
+	o := mustApplyOrder(t, tr, orderUpdate(OrderStatePartiallyFilled, 2, "0.2", "30400"))
+	if !o.AvgPrice.Equal(MustParseDecimal("30500")) || !o.FilledQuote.Equal(MustParseDecimal("6100")) {
+		t.Fatalf("avg %s quote %s, want the trade average", o.AvgPrice, o.FilledQuote)
+	}
+
+	// trades missing: average from the order update
+	o = mustApplyOrder(t, tr, orderUpdate(OrderStatePartiallyFilled, 3, "0.3", "30400"))
+	if !o.Filled.Equal(MustParseDecimal("0.3")) || !o.AvgPrice.Equal(MustParseDecimal("30400")) {
+		t.Fatalf("filled %s avg %s, want the order update average", o.Filled, o.AvgPrice)
+	}
+
+	// trades completing the quantity fill the order
+	tr.ApplyTrade("", userTrade("12", "0.8", "30000"))
+	if o, _ := tr.ByOrderID("", "1"); o.State != OrderStateFilled {
+		t.Fatalf("state %s after trades of the full quantity", o.State)
+	}
+}
+
+func TestOrderTrackerAPIOrder(t *testing.T) {
+	var a RestOrderData
+	err := json.Unmarshal([]byte(`{"symbol":"btc_usdt","orderId":"6216559590087220004","clientOrderId":"t-7","side":"BUY","type":"LIMIT",
+		"timeInForce":"GTC","price":"40000","origQty":"2","executedQty":"1.2","leavingQty":"0.8","avgPrice":"40000","fee":"0.1",
+		"closed":false,"state":"PARTIALLY_FILLED","time":1655958915583,"updatedTime":1655958915600}`), &a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tr := NewOrderTracker()
+	tr.Submitted("acc", TrackedOrder{Symbol: "btc_usdt", ClientOrderID: "t-7"})
+	if err := tr.ApplyAPIOrder("acc", &a); err != nil {
+		t.Fatal(err)
+	}
+	o, ok := tr.ByOrderID("acc", "6216559590087220004")
+	if !ok || o.ClientOrderID != "t-7" || o.State != OrderStatePartiallyFilled || o.UpdateTime != 1655958915600 ||
+		!o.Filled.Equal(MustParseDecimal("1.2")) || !o.Quantity.Equal(MustParseDecimal("2")) {
+		t.Fatalf("order %+v", o)
+	}
+	if _, ok := tr.ByOrderID("", "6216559590087220004"); ok {
+		t.Fatal("order found under another account")
+	}
+}
+
+func TestOrderTrackerPrune(t *testing.T) {
+	tr := NewOrderTracker()
+	now := time.Now().UnixMilli()
+
+	old := orderUpdate(OrderStateFilled, now-60_000, "1", "30000")
+	recent := orderUpdate(OrderStateCanceled, now, "0", "")
+	recent.OrderID, recent.ClientOrderID = "2", "t-2"
+	open := orderUpdate(OrderStateNew, now-60_000, "0", "")
+	open.OrderID, open.ClientOrderID = "3", "t-3"
+	for _, d := range []*SpotOrderData{old, recent, open} {
+		mustApplyOrder(t, tr, d)
+	}
+
+	if n := tr.Prune(time.UnixMilli(now - 1000)); n != 1 {
+		t.Fatalf("pruned %d orders, want 1", n)
+	}
+	if _, ok := tr.ByOrderID("", "1"); ok {
+		t.Fatal("pruned order still found by exchange id")
+	}
+	if _, ok := tr.ByClientOrderID("", "t-1"); ok {
+		t.Fatal("pruned order still found by client id")
+	}
+	for _, id := range []string{"2", "3"} {
+		if _, ok := tr.ByOrderID("", id); !ok {
+			t.Fatalf("order %s pruned", id)
+		}
+	}
+}
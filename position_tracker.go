@@ -0,0 +1,624 @@
+package xtws
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	PositionSideLong  = "LONG"
+	PositionSideShort = "SHORT"
+
+	UnderlyingCoinBased = "COIN_BASED"
+	UnderlyingUBased    = "U_BASED"
+)
+
+// alert kinds of PositionAlert
+const (
+	AlertLiqDistance = "liq_distance" // mark price within PositionLimits.LiqDistance of the liquidation price
+	AlertMaxLoss     = "max_loss"     // unrealized loss reached PositionLimits.MaxLoss
+	AlertMaxProfit   = "max_profit"   // unrealized profit reached PositionLimits.MaxProfit
+	AlertLiquidated  = "liquidated"
+)
+
+// pnlPlaces decimal places of the unrealized PnL of coin based contracts
+const pnlPlaces = 12
+
+// FuturesPosition position of one contract and side, marked to the latest mark price
+type FuturesPosition struct {
+	Symbol        string
+	Side          string  // PositionSideLong, PositionSideShort
+	Type          string  // CROSSED, ISOLATED
+	Underlying    string  // UnderlyingUBased, UnderlyingCoinBased
+	Size          Decimal // contracts, always >= 0
+	EntryPrice    Decimal
+	Leverage      Decimal
+	LiqPrice      Decimal // 0 when unknown
+	Margin        Decimal
+	RealizedPnl   Decimal
+	MarkPrice     Decimal // 0 before the first mark price
+	UnrealizedPnl Decimal
+	Liquidated    bool
+	UpdateTime    int64 // milliseconds
+}
+
+// LiqDistance relative distance of the mark price to the liquidation price, |mark - liq| / mark.
+// ok is false when either price is unknown.
+func (p *FuturesPosition) LiqDistance() (d Decimal, ok bool) {
+	if p.MarkPrice.IsZero() || p.LiqPrice.IsZero() {
+		return Decimal{}, false
+	}
+	diff := p.MarkPrice.Sub(p.LiqPrice)
+	if p.Side == PositionSideShort {
+		diff = diff.Neg()
+	}
+	// past the liquidation price
+	if diff.Sign() <= 0 {
+		return Decimal{}, true
+	}
+	return diff.Div(p.MarkPrice, pnlPlaces).Normalize(), true
+}
+
+// PositionLimits alert thresholds, a zero value disables the check
+type PositionLimits struct {
+	LiqDistance Decimal // e.g. 0.05 alerts when the mark price is within 5% of the liquidation price
+	MaxLoss     Decimal // positive amount, alerts when the unrealized PnL <= -MaxLoss
+	MaxProfit   Decimal // alerts when the unrealized PnL >= MaxProfit
+}
+
+// PositionAlert fired once when a threshold is crossed, it is re-armed after the position recovers
+type PositionAlert struct {
+	Kind     string // AlertLiqDistance, AlertMaxLoss, AlertMaxProfit, AlertLiquidated
+	Position FuturesPosition
+	Value    Decimal // distance for AlertLiqDistance, unrealized PnL for the PnL alerts
+}
+
+type PositionTrackerConf struct {
+	ContractSize func(symbol string) Decimal // contract multiplier, required, no PnL is computed for symbols it returns 0 for
+	Limits       PositionLimits              // default limits
+	SymbolLimits map[string]PositionLimits   // per symbol limits, replace Limits
+	LiqPrices    LiqPriceProvider            // liquidation prices, the position pushes do not carry them
+	LiqRefresh   time.Duration               // Run reloads LiqPrices this often, default 5s
+	Logger       *log.Logger
+}
+
+// PositionLiqPrice liquidation price of the position of symbol and side
+type PositionLiqPrice struct {
+	Symbol   string
+	Side     string  // PositionSideLong, PositionSideShort
+	LiqPrice Decimal // 0 when unknown
+}
+
+// LiqPriceProvider loads the liquidation prices of the open positions
+type LiqPriceProvider interface {
+	LiqPrices(ctx context.Context) ([]PositionLiqPrice, error)
+}
+
+// LiqPriceFunc adapts a func to LiqPriceProvider
+type LiqPriceFunc func(ctx context.Context) ([]PositionLiqPrice, error)
+
+func (f LiqPriceFunc) LiqPrices(ctx context.Context) ([]PositionLiqPrice, error) { return f(ctx) }
+
+// RestLiqPriceProvider liquidation prices of the futures positions, https://doc.xt.com/#futures_usergetPosition
+type RestLiqPriceProvider struct {
+	BaseURL string // default FuturesRestBaseUrl, CoinFuturesRestBaseUrl for COIN-M
+	Key     string
+	Secret  string
+	Client  *http.Client
+}
+
+type restFuturesPositionResp struct {
+	ReturnCode int    `json:"returnCode"`
+	MsgInfo    string `json:"msgInfo"`
+	Result     []struct {
+		Symbol           string      `json:"symbol"`
+		PositionSide     string      `json:"positionSide"`
+		LiquidationPrice json.Number `json:"liquidationPrice"`
+	} `json:"result"`
+}
+
+func (p *RestLiqPriceProvider) LiqPrices(ctx context.Context) ([]PositionLiqPrice, error) {
+	if p.Key == "" || p.Secret == "" {
+		return nil, newAuthEmptyErr()
+	}
+	base := p.BaseURL
+	if base == "" {
+		base = FuturesRestBaseUrl
+	}
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	const path = "/future/user/v1/position"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range SignFuturesHeaders(p.Key, p.Secret, path, "", "", time.Now()) {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch positions: http status %d", resp.StatusCode)
+	}
+
+	var body restFuturesPositionResp
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	if body.ReturnCode != 0 {
+		return nil, fmt.Errorf("fetch positions: %s", body.MsgInfo)
+	}
+
+	res := make([]PositionLiqPrice, 0, len(body.Result))
+	for _, r := range body.Result {
+		liq, err := optionalDecimal(r.LiquidationPrice.String())
+		if err != nil {
+			return nil, fmt.Errorf("fetch positions %s: %w", r.Symbol, err)
+		}
+		res = append(res, PositionLiqPrice{Symbol: r.Symbol, Side: r.PositionSide, LiqPrice: liq})
+	}
+	return res, nil
+}
+
+// PositionTracker futures positions from the private position, close and liquidation events,
+// marked to market on every mark_price push. Liquidation prices are loaded by Run.
+type PositionTracker struct {
+	conf    PositionTrackerConf
+	refresh chan struct{} // wakes Run after a position push
+
+	pubMu     *sync.Mutex // serializes apply and publish, handlers see the changes in the order they were applied
+	mu        *sync.Mutex
+	positions map[positionKey]*trackedPosition
+	marks     map[string]markPrice // symbol -> latest mark price
+
+	handlerMu  *sync.Mutex
+	onChange   []positionHandler // copy on write
+	onAlert    []alertHandler    // copy on write
+	handlerSeq uint64
+}
+
+type markPrice struct {
+	price Decimal
+	time  int64
+}
+
+type positionKey struct {
+	symbol string
+	side   string
+}
+
+type trackedPosition struct {
+	FuturesPosition
+	active map[string]bool // alerts fired and not re-armed yet
+}
+
+type positionHandler struct {
+	id uint64
+	f  func(FuturesPosition)
+}
+
+type alertHandler struct {
+	id uint64
+	f  func(PositionAlert)
+}
+
+func NewPositionTracker(conf PositionTrackerConf) (*PositionTracker, error) {
+	if conf.ContractSize == nil {
+		return nil, fmt.Errorf("position tracker needs ContractSize")
+	}
+	if conf.LiqRefresh <= 0 {
+		conf.LiqRefresh = 5 * time.Second
+	}
+	if conf.Logger == nil {
+		conf.Logger = log.New(os.Stdout, "", log.LstdFlags|log.Lshortfile)
+	}
+
+	return &PositionTracker{
+		conf:      conf,
+		refresh:   make(chan struct{}, 1),
+		pubMu:     new(sync.Mutex),
+		mu:        new(sync.Mutex),
+		positions: make(map[positionKey]*trackedPosition),
+		marks:     make(map[string]markPrice),
+		handlerMu: new(sync.Mutex),
+	}, nil
+}
+
+// Run reload the liquidation prices from conf.LiqPrices every conf.LiqRefresh and after position pushes,
+// until ctx is done. It returns at once without a provider.
+func (t *PositionTracker) Run(ctx context.Context) {
+	if t.conf.LiqPrices == nil {
+		return
+	}
+
+	ticker := time.NewTicker(t.conf.LiqRefresh)
+	defer ticker.Stop()
+	for {
+		if err := t.RefreshLiqPrices(ctx); err != nil && ctx.Err() == nil {
+			t.conf.Logger.Printf("position tracker refresh liquidation prices err:%s", err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-t.refresh:
+		}
+	}
+}
+
+// RefreshLiqPrices load the liquidation prices once and apply them to the tracked positions
+func (t *PositionTracker) RefreshLiqPrices(ctx context.Context) error {
+	if t.conf.LiqPrices == nil {
+		return fmt.Errorf("position tracker has no liquidation price provider")
+	}
+	prices, err := t.conf.LiqPrices.LiqPrices(ctx)
+	if err != nil {
+		return err
+	}
+	for _, p := range prices {
+		t.ApplyLiqPrice(p.Symbol, p.Side, p.LiqPrice)
+	}
+	return nil
+}
+
+// ApplyLiqPrice set the liquidation price of a tracked position, unknown positions are ignored
+func (t *PositionTracker) ApplyLiqPrice(symbol, side string, price Decimal) {
+	t.pubMu.Lock()
+	defer t.pubMu.Unlock()
+
+	t.mu.Lock()
+	p, ok := t.positions[positionKey{symbol, side}]
+	if !ok || p.LiqPrice.Equal(price) {
+		t.mu.Unlock()
+		return
+	}
+	p.LiqPrice = price
+	alerts := t.check(p)
+	pos := p.FuturesPosition
+	t.mu.Unlock()
+
+	t.publish([]FuturesPosition{pos}, alerts)
+}
+
+// OnChange f is called after a position changed or was marked, in the order the changes were applied.
+// f must not apply changes to the tracker. The returned func removes f.
+func (t *PositionTracker) OnChange(f func(p FuturesPosition)) (remove func()) {
+	if f == nil {
+		return func() {}
+	}
+
+	t.handlerMu.Lock()
+	t.handlerSeq++
+	id := t.handlerSeq
+	t.onChange = append(slices.Clip(t.onChange), positionHandler{id: id, f: f})
+	t.handlerMu.Unlock()
+
+	return func() {
+		t.handlerMu.Lock()
+		defer t.handlerMu.Unlock()
+		t.onChange = slices.DeleteFunc(slices.Clone(t.onChange), func(h positionHandler) bool { return h.id == id })
+	}
+}
+
+// OnAlert f is called when a threshold is crossed, f must not apply changes to the tracker.
+// The returned func removes f.
+func (t *PositionTracker) OnAlert(f func(a PositionAlert)) (remove func()) {
+	if f == nil {
+		return func() {}
+	}
+
+	t.handlerMu.Lock()
+	t.handlerSeq++
+	id := t.handlerSeq
+	t.onAlert = append(slices.Clip(t.onAlert), alertHandler{id: id, f: f})
+	t.handlerMu.Unlock()
+
+	return func() {
+		t.handlerMu.Lock()
+		defer t.handlerMu.Unlock()
+		t.onAlert = slices.DeleteFunc(slices.Clone(t.onAlert), func(h alertHandler) bool { return h.id == id })
+	}
+}
+
+// AttachService feed the ChannelFuturePositions pushes of a private connection
+func (t *PositionTracker) AttachService(ws *WsService) (remove func()) {
+	return ws.AddCallBack(ChannelFuturePositions, ws.NewFuturesPositionCallBack(func(msg *UpdateFuturesPositionMsg) {
+		// the push has no timestamp, it is stamped when received
+		if err := t.ApplyPosition(&msg.Data, time.Now().UnixMilli()); err != nil {
+			ws.Logger.Printf("position tracker skip position err:%s", err.Error())
+		}
+	}))
+}
+
+// AttachMarkPrice feed the ChannelFutureMarkPrice pushes of a market connection, subscribe the
+// symbols with SubscribeFuturesMarkPrice
+func (t *PositionTracker) AttachMarkPrice(ws *WsService) (remove func()) {
+	return ws.AddCallBack(ChannelFutureMarkPrice, ws.NewFuturesMarkPriceCallBack(func(msg *UpdateFuturesMarkPriceMsg) {
+		if err := t.ApplyMarkPrice(&msg.Data); err != nil {
+			ws.Logger.Printf("position tracker skip mark price err:%s", err.Error())
+		}
+	}))
+}
+
+// Position of symbol and side
+func (t *PositionTracker) Position(symbol, side string) (FuturesPosition, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.positions[positionKey{symbol, side}]
+	if !ok {
+		return FuturesPosition{}, false
+	}
+	return p.FuturesPosition, true
+}
+
+// Positions all positions including closed ones, sorted by symbol and side
+func (t *PositionTracker) Positions() []FuturesPosition {
+	return t.list(func(*FuturesPosition) bool { return true })
+}
+
+// Open positions with a non zero size
+func (t *PositionTracker) Open() []FuturesPosition {
+	return t.list(func(p *FuturesPosition) bool { return !p.Size.IsZero() })
+}
+
+// UnrealizedPnl sum of the unrealized PnL of the positions of underlying
+func (t *PositionTracker) UnrealizedPnl(underlying string) Decimal {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var sum Decimal
+	for _, p := range t.positions {
+		if p.Underlying == underlying {
+			sum = sum.Add(p.UnrealizedPnl)
+		}
+	}
+	return sum
+}
+
+// ApplyPosition apply a position@{listenKey} push received at updateTime (milliseconds), older than the
+// position it is ignored. A push with a malformed number is rejected.
+func (t *PositionTracker) ApplyPosition(d *FuturesPositionData, updateTime int64) error {
+	size, err := d.Size()
+	if err != nil {
+		return err
+	}
+	entry, err := d.Entry()
+	if err != nil {
+		return err
+	}
+	margin, err := optionalDecimal(d.IsolatedMargin)
+	if err != nil {
+		return err
+	}
+	realized, err := d.Realized()
+	if err != nil {
+		return err
+	}
+
+	t.update(d.Symbol, d.PositionSide, updateTime, func(p *FuturesPosition) {
+		p.Type = d.PositionType
+		p.Underlying = cmp.Or(d.UnderlyingType, p.Underlying)
+		p.Size = size.Abs()
+		p.EntryPrice = entry
+		p.Leverage = NewDecimalFromInt(int64(d.Leverage))
+		p.Margin = margin
+		p.RealizedPnl = realized
+		if !p.Size.IsZero() {
+			p.Liquidated = false
+		}
+	})
+
+	// the liquidation price moves with the position
+	select {
+	case t.refresh <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// ApplyLiquidation close the position of symbol and side at updateTime (milliseconds) and fire AlertLiquidated.
+// The position pushes carry no liquidation flag, call it from a notify@{listenKey} handler or after
+// checking the REST history. An empty side liquidates the open sides of the symbol.
+func (t *PositionTracker) ApplyLiquidation(symbol, side string, updateTime int64) {
+	sides := []string{side}
+	if side == "" {
+		sides = nil
+		t.mu.Lock()
+		for _, s := range []string{PositionSideLong, PositionSideShort} {
+			if p, ok := t.positions[positionKey{symbol, s}]; ok && !p.Size.IsZero() {
+				sides = append(sides, s)
+			}
+		}
+		t.mu.Unlock()
+	}
+
+	for _, side := range sides {
+		t.update(symbol, side, updateTime, func(p *FuturesPosition) {
+			p.Size = Decimal{}
+			p.Liquidated = true
+		})
+	}
+}
+
+// ApplyMarkPrice mark the positions of the symbol, older prices are ignored
+func (t *PositionTracker) ApplyMarkPrice(d *FuturesPriceData) error {
+	mark, err := d.Value()
+	if err != nil {
+		return err
+	}
+	if mark.IsZero() {
+		return nil
+	}
+
+	t.pubMu.Lock()
+	defer t.pubMu.Unlock()
+
+	t.mu.Lock()
+	if last, ok := t.marks[d.Symbol]; ok && d.Time < last.time {
+		t.mu.Unlock()
+		return nil
+	}
+	t.marks[d.Symbol] = markPrice{price: mark, time: d.Time}
+
+	var changed []FuturesPosition
+	var alerts []PositionAlert
+	for key, p := range t.positions {
+		if key.symbol != d.Symbol {
+			continue
+		}
+		p.MarkPrice = mark
+		t.mark(p)
+		changed = append(changed, p.FuturesPosition)
+		alerts = append(alerts, t.check(p)...)
+	}
+	t.mu.Unlock()
+
+	t.publish(changed, alerts)
+	return nil
+}
+
+// update apply f to the position of symbol and side, creating it, then mark it to the latest mark price
+func (t *PositionTracker) update(symbol, side string, updateTime int64, f func(p *FuturesPosition)) {
+	if symbol == "" || (side != PositionSideLong && side != PositionSideShort) {
+		return
+	}
+
+	t.pubMu.Lock()
+	defer t.pubMu.Unlock()
+
+	t.mu.Lock()
+	key := positionKey{symbol, side}
+	p, ok := t.positions[key]
+	if !ok {
+		p = &trackedPosition{
+			FuturesPosition: FuturesPosition{Symbol: symbol, Side: side, Underlying: UnderlyingUBased},
+			active:          make(map[string]bool),
+		}
+		t.positions[key] = p
+	}
+	if updateTime != 0 && updateTime < p.UpdateTime {
+		t.mu.Unlock()
+		return
+	}
+
+	f(&p.FuturesPosition)
+	p.UpdateTime = max(p.UpdateTime, updateTime)
+	if m, ok := t.marks[symbol]; ok && !p.Liquidated {
+		p.MarkPrice = m.price
+	}
+	t.mark(p)
+	alerts := t.check(p)
+	pos := p.FuturesPosition
+	t.mu.Unlock()
+
+	t.publish([]FuturesPosition{pos}, alerts)
+}
+
+// mark recompute the unrealized PnL from the mark price
+func (t *PositionTracker) mark(p *trackedPosition) {
+	if p.Size.IsZero() || p.MarkPrice.IsZero() || p.EntryPrice.IsZero() {
+		p.UnrealizedPnl = Decimal{}
+		return
+	}
+
+	contractSize := t.conf.ContractSize(p.Symbol)
+	if contractSize.IsZero() {
+		p.UnrealizedPnl = Decimal{}
+		return
+	}
+	qty := p.Size.Mul(contractSize)
+	diff := p.MarkPrice.Sub(p.EntryPrice)
+	if p.Side == PositionSideShort {
+		diff = diff.Neg()
+	}
+
+	if p.Underlying == UnderlyingCoinBased {
+		// inverse contracts settle in the coin: qty * (1/entry - 1/mark)
+		p.UnrealizedPnl = qty.Mul(diff).Div(p.EntryPrice.Mul(p.MarkPrice), pnlPlaces).Normalize()
+		return
+	}
+	p.UnrealizedPnl = qty.Mul(diff).Normalize()
+}
+
+// check returns the alerts whose threshold was crossed since the last check, must hold t.mu
+func (t *PositionTracker) check(p *trackedPosition) []PositionAlert {
+	limits := t.conf.Limits
+	if l, ok := t.conf.SymbolLimits[p.Symbol]; ok {
+		limits = l
+	}
+
+	var alerts []PositionAlert
+	fire := func(kind string, hit bool, value Decimal) {
+		if !hit {
+			delete(p.active, kind)
+			return
+		}
+		if p.active[kind] {
+			return
+		}
+		p.active[kind] = true
+		alerts = append(alerts, PositionAlert{Kind: kind, Position: p.FuturesPosition, Value: value})
+	}
+
+	fire(AlertLiquidated, p.Liquidated, Decimal{})
+
+	open := !p.Size.IsZero()
+	dist, ok := p.LiqDistance()
+	fire(AlertLiqDistance, open && ok && !limits.LiqDistance.IsZero() && dist.Cmp(limits.LiqDistance) <= 0, dist)
+
+	pnl := p.UnrealizedPnl
+	fire(AlertMaxLoss, open && !limits.MaxLoss.IsZero() && pnl.Cmp(limits.MaxLoss.Neg()) <= 0, pnl)
+	fire(AlertMaxProfit, open && !limits.MaxProfit.IsZero() && pnl.Cmp(limits.MaxProfit) >= 0, pnl)
+	return alerts
+}
+
+func (t *PositionTracker) list(keep func(*FuturesPosition) bool) []FuturesPosition {
+	t.mu.Lock()
+	var res []FuturesPosition
+	for _, p := range t.positions {
+		if keep(&p.FuturesPosition) {
+			res = append(res, p.FuturesPosition)
+		}
+	}
+	t.mu.Unlock()
+
+	slices.SortFunc(res, func(a, b FuturesPosition) int {
+		return cmp.Or(cmp.Compare(a.Symbol, b.Symbol), cmp.Compare(a.Side, b.Side))
+	})
+	return res
+}
+
+func (t *PositionTracker) publish(changed []FuturesPosition, alerts []PositionAlert) {
+	t.handlerMu.Lock()
+	onChange, onAlert := t.onChange, t.onAlert
+	t.handlerMu.Unlock()
+
+	for _, p := range changed {
+		for _, h := range onChange {
+			h.f(p)
+		}
+	}
+	for _, a := range alerts {
+		for _, h := range onAlert {
+			h.f(a)
+		}
+	}
+}
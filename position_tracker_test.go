@@ -0,0 +1,192 @@
+package xtws
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestTracker(t *testing.T, liq LiqPriceProvider) *PositionTracker {
+	tr, err := NewPositionTracker(PositionTrackerConf{
+		ContractSize: func(symbol string) Decimal {
+			if symbol == "btc_usdt" {
+				return MustParseDecimal("0.0001")
+			}
+			return Decimal{}
+		},
+		Limits:    PositionLimits{LiqDistance: MustParseDecimal("0.05")},
+		LiqPrices: liq,
+		Logger:    log.New(io.Discard, "", 0),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tr
+}
+
+func testPosition(symbol, size string) *FuturesPositionData {
+	return &FuturesPositionData{Symbol: symbol, PositionType: "CROSSED", PositionSide: PositionSideLong,
+		PositionSize: size, EntryPrice: "30000", Leverage: 10, UnderlyingType: UnderlyingUBased}
+}
+
+func TestPositionTrackerRequiresContractSize(t *testing.T) {
+	if _, err := NewPositionTracker(PositionTrackerConf{}); err == nil {
+		t.Fatal("tracker without ContractSize")
+	}
+}
+
+func TestPositionTrackerPnl(t *testing.T) {
+	tr := newTestTracker(t, nil)
+	if err := tr.ApplyPosition(testPosition("btc_usdt", "100"), 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.ApplyPosition(testPosition("eth_usdt", "100"), 1); err != nil {
+		t.Fatal(err)
+	}
+	tr.ApplyMarkPrice(&FuturesPriceData{Symbol: "btc_usdt", Price: "31000", Time: 1})
+	tr.ApplyMarkPrice(&FuturesPriceData{Symbol: "eth_usdt", Price: "31000", Time: 1})
+
+	// 100 contracts of 0.0001 btc up 1000
+	if p, _ := tr.Position("btc_usdt", PositionSideLong); !p.UnrealizedPnl.Equal(MustParseDecimal("10")) {
+		t.Fatalf("btc pnl %s", p.UnrealizedPnl)
+	}
+	if p, _ := tr.Position("eth_usdt", PositionSideLong); !p.UnrealizedPnl.IsZero() {
+		t.Fatalf("eth pnl %s without a contract size", p.UnrealizedPnl)
+	}
+}
+
+func TestPositionTrackerPushOrder(t *testing.T) {
+	tr := newTestTracker(t, nil)
+	tr.ApplyPosition(testPosition("btc_usdt", "200"), 200)
+	tr.ApplyPosition(testPosition("btc_usdt", "100"), 100)
+
+	if p, _ := tr.Position("btc_usdt", PositionSideLong); !p.Size.Equal(MustParseDecimal("200")) || p.UpdateTime != 200 {
+		t.Fatalf("position %+v, want the older push ignored", p)
+	}
+}
+
+func TestPositionTrackerLiqAlert(t *testing.T) {
+	tr := newTestTracker(t, LiqPriceFunc(func(context.Context) ([]PositionLiqPrice, error) {
+		return []PositionLiqPrice{
+			{Symbol: "btc_usdt", Side: PositionSideLong, LiqPrice: MustParseDecimal("29000")},
+			{Symbol: "eth_usdt", Side: PositionSideLong, LiqPrice: MustParseDecimal("1000")},
+		}, nil
+	}))
+	var alerts []PositionAlert
+	tr.OnAlert(func(a PositionAlert) { alerts = append(alerts, a) })
+
+	tr.ApplyPosition(testPosition("btc_usdt", "100"), 1)
+	tr.ApplyMarkPrice(&FuturesPriceData{Symbol: "btc_usdt", Price: "30000", Time: 1})
+	if err := tr.RefreshLiqPrices(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(alerts) != 1 || alerts[0].Kind != AlertLiqDistance || alerts[0].Position.LiqPrice.String() != "29000" {
+		t.Fatalf("alerts %+v", alerts)
+	}
+	if _, ok := tr.Position("eth_usdt", PositionSideLong); ok {
+		t.Fatal("liquidation price created an untracked position")
+	}
+}
+
+func TestPositionTrackerLiquidation(t *testing.T) {
+	tr := newTestTracker(t, nil)
+	var alerts []PositionAlert
+	tr.OnAlert(func(a PositionAlert) { alerts = append(alerts, a) })
+
+	tr.ApplyPosition(testPosition("btc_usdt", "100"), 1)
+	tr.ApplyLiquidation("btc_usdt", "", 2)
+	p, _ := tr.Position("btc_usdt", PositionSideLong)
+	if !p.Liquidated || !p.Size.IsZero() || p.UpdateTime != 2 {
+		t.Fatalf("position %+v after the liquidation", p)
+	}
+	if len(alerts) != 1 || alerts[0].Kind != AlertLiquidated {
+		t.Fatalf("alerts %+v", alerts)
+	}
+
+	// a new position re-arms the alert
+	tr.ApplyPosition(testPosition("btc_usdt", "50"), 3)
+	if p, _ := tr.Position("btc_usdt", PositionSideLong); p.Liquidated {
+		t.Fatal("reopened position still liquidated")
+	}
+}
+
+func TestPositionTrackerPublishOrder(t *testing.T) {
+	tr := newTestTracker(t, nil)
+	var times []int64
+	tr.OnChange(func(p FuturesPosition) { times = append(times, p.UpdateTime) })
+
+	// concurrent pushes, the handlers see them in the order they were applied
+	var wg sync.WaitGroup
+	for i := range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tr.ApplyPosition(testPosition("btc_usdt", "100"), int64(i+1))
+			tr.ApplyMarkPrice(&FuturesPriceData{Symbol: "btc_usdt", Price: "31000", Time: int64(i + 1)})
+		}()
+	}
+	wg.Wait()
+
+	for i := 1; i < len(times); i++ {
+		if times[i] < times[i-1] {
+			t.Fatalf("change at %d published after %d", times[i], times[i-1])
+		}
+	}
+	if p, _ := tr.Position("btc_usdt", PositionSideLong); times[len(times)-1] != p.UpdateTime {
+		t.Fatalf("last change at %d, position at %d", times[len(times)-1], p.UpdateTime)
+	}
+}
+
+func TestPositionTrackerRun(t *testing.T) {
+	loaded := make(chan struct{}, 10)
+	tr := newTestTracker(t, LiqPriceFunc(func(context.Context) ([]PositionLiqPrice, error) {
+		loaded <- struct{}{}
+		return nil, nil
+	}))
+	tr.conf.LiqRefresh = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go tr.Run(ctx)
+
+	// once at start, once after the push
+	for i := range 2 {
+		if i == 1 {
+			tr.ApplyPosition(testPosition("btc_usdt", "1"), 1)
+		}
+		select {
+		case <-loaded:
+		case <-time.After(time.Second):
+			t.Fatalf("liquidation prices loaded %d times", i)
+		}
+	}
+}
+
+func TestRestLiqPriceProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/future/user/v1/position" || r.Header.Get("validate-appkey") != "key" || r.Header.Get("validate-signature") == "" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"returnCode": 0, "msgInfo": "success", "result": []map[string]any{
+			{"symbol": "btc_usdt", "positionSide": "LONG", "positionSize": "100", "liquidationPrice": "29000.5"},
+			{"symbol": "eth_usdt", "positionSide": "SHORT", "positionSize": 0, "liquidationPrice": 0},
+		}})
+	}))
+	defer srv.Close()
+
+	p := &RestLiqPriceProvider{BaseURL: srv.URL, Key: "key", Secret: "secret"}
+	prices, err := p.LiqPrices(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prices) != 2 || prices[0].LiqPrice.String() != "29000.5" || prices[1].Side != PositionSideShort || !prices[1].LiqPrice.IsZero() {
+		t.Fatalf("prices %+v", prices)
+	}
+}
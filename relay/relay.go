@@ -0,0 +1,353 @@
+// Package relay re-broadcasts one upstream XT connection to many local websocket clients.
+//
+// Clients speak the XT subscribe protocol, {"id":"1","method":"subscribe","params":["depth@btc_usdt,5"]}.
+// Upstream channels are held with WsService.AcquireChannels: the first holder subscribing a channel
+// subscribes it upstream, the last one leaving unsubscribes it, other holders of the service included.
+package relay
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	xtws "github.com/liuhengloveyou/xtws-go"
+)
+
+type Options struct {
+	ClientBuffer   int           // messages queued per client, default 1024
+	DisconnectSlow bool          // close clients whose buffer is full instead of dropping their messages
+	WriteTimeout   time.Duration // default 10s
+	CheckOrigin    func(r *http.Request) bool
+	Logger         *log.Logger
+}
+
+type Server struct {
+	ws       *xtws.WsService
+	opts     Options
+	upgrader websocket.Upgrader
+
+	// mu is never held while writing upstream, the service counts the holders of upstream channels
+	mu      *sync.Mutex
+	subs    map[string]map[*client]struct{} // channel (frame event) -> clients
+	topics  map[string]func()               // topic -> remove upstream callback
+	clients map[*client]struct{}
+	dropped int64
+}
+
+type response struct {
+	ID   string `json:"id"`
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+}
+
+type request struct {
+	ID     string   `json:"id"`
+	Method string   `json:"method"`
+	Params []string `json:"params"`
+}
+
+func New(ws *xtws.WsService, opts Options) *Server {
+	if opts.ClientBuffer <= 0 {
+		opts.ClientBuffer = 1024
+	}
+	if opts.WriteTimeout <= 0 {
+		opts.WriteTimeout = 10 * time.Second
+	}
+	if opts.Logger == nil {
+		opts.Logger = log.New(os.Stderr, "relay ", log.LstdFlags)
+	}
+
+	return &Server{
+		ws:       ws,
+		opts:     opts,
+		upgrader: websocket.Upgrader{CheckOrigin: opts.CheckOrigin},
+		mu:       new(sync.Mutex),
+		subs:     make(map[string]map[*client]struct{}),
+		topics:   make(map[string]func()),
+		clients:  make(map[*client]struct{}),
+	}
+}
+
+// ServeHTTP upgrade the request and serve one downstream client
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		s.opts.Logger.Printf("upgrade %s err:%s", r.RemoteAddr, err.Error())
+		return
+	}
+
+	c := &client{
+		srv:      s,
+		conn:     conn,
+		send:     make(chan []byte, s.opts.ClientBuffer),
+		done:     make(chan struct{}),
+		channels: make(map[string]bool),
+	}
+
+	s.mu.Lock()
+	s.clients[c] = struct{}{}
+	s.mu.Unlock()
+
+	go c.writeLoop()
+	c.readLoop()
+}
+
+// Clients number of connected clients
+func (s *Server) Clients() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.clients)
+}
+
+// Channels upstream channels with their number of subscribed clients
+func (s *Server) Channels() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := make(map[string]int, len(s.subs))
+	for channel, clients := range s.subs {
+		res[channel] = len(clients)
+	}
+	return res
+}
+
+// Dropped number of messages dropped because a client buffer was full
+func (s *Server) Dropped() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+// Close disconnect every client, upstream channels are unsubscribed as clients leave
+func (s *Server) Close() {
+	s.mu.Lock()
+	clients := make([]*client, 0, len(s.clients))
+	for c := range s.clients {
+		clients = append(clients, c)
+	}
+	s.mu.Unlock()
+
+	for _, c := range clients {
+		c.close()
+	}
+}
+
+func (s *Server) subscribe(c *client, channels []string) error {
+	s.mu.Lock()
+	var fresh []string
+	for _, channel := range channels {
+		if !c.channels[channel] && !slices.Contains(fresh, channel) {
+			fresh = append(fresh, channel)
+			s.watchTopic(channel)
+		}
+	}
+	s.mu.Unlock()
+
+	if len(fresh) == 0 {
+		return nil
+	}
+	// the service subscribes what no other holder has subscribed yet
+	if err := s.ws.AcquireChannels(fresh); err != nil {
+		s.mu.Lock()
+		s.releaseTopics()
+		s.mu.Unlock()
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, channel := range fresh {
+		// a failed subscribe of another client may have removed the callback meanwhile
+		s.watchTopic(channel)
+		c.channels[channel] = true
+		if s.subs[channel] == nil {
+			s.subs[channel] = make(map[*client]struct{})
+		}
+		s.subs[channel][c] = struct{}{}
+	}
+	return nil
+}
+
+// watchTopic route upstream messages of the channel's topic, callbacks are registered by topic. s.mu must be held.
+func (s *Server) watchTopic(channel string) {
+	topic, _, _ := strings.Cut(channel, "@")
+	if _, ok := s.topics[topic]; ok {
+		return
+	}
+	s.topics[topic] = s.ws.AddCallBack(topic, s.route)
+}
+
+// releaseTopics remove the callbacks of topics no subscribed channel needs anymore. s.mu must be held.
+func (s *Server) releaseTopics() {
+	used := make(map[string]bool, len(s.topics))
+	for channel := range s.subs {
+		topic, _, _ := strings.Cut(channel, "@")
+		used[topic] = true
+	}
+	for topic, remove := range s.topics {
+		if !used[topic] {
+			remove()
+			delete(s.topics, topic)
+		}
+	}
+}
+
+func (s *Server) unsubscribe(c *client, channels []string) error {
+	s.mu.Lock()
+	var held []string
+	for _, channel := range channels {
+		if !c.channels[channel] {
+			continue
+		}
+		delete(c.channels, channel)
+		delete(s.subs[channel], c)
+		if len(s.subs[channel]) == 0 {
+			delete(s.subs, channel)
+		}
+		held = append(held, channel)
+	}
+	if len(held) > 0 {
+		s.releaseTopics()
+	}
+	s.mu.Unlock()
+
+	if len(held) == 0 {
+		return nil
+	}
+	return s.ws.ReleaseChannels(held)
+}
+
+func (s *Server) remove(c *client) {
+	s.mu.Lock()
+	channels := make([]string, 0, len(c.channels))
+	for channel := range c.channels {
+		channels = append(channels, channel)
+	}
+	s.mu.Unlock()
+
+	if err := s.unsubscribe(c, channels); err != nil {
+		s.opts.Logger.Printf("unsubscribe %v err:%s", channels, err.Error())
+	}
+
+	s.mu.Lock()
+	delete(s.clients, c)
+	s.mu.Unlock()
+}
+
+// route fan out an upstream frame to the clients subscribed to its event
+func (s *Server) route(rawMsg []byte) {
+	_, event, ok := xtws.ScanTopicEvent(rawMsg)
+	if !ok {
+		return
+	}
+
+	var slow []*client
+
+	s.mu.Lock()
+	for c := range s.subs[string(event)] {
+		select {
+		case c.send <- rawMsg:
+		default:
+			s.dropped++
+			if s.opts.DisconnectSlow {
+				slow = append(slow, c)
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	for _, c := range slow {
+		s.opts.Logger.Printf("client %s too slow, disconnect", c.conn.RemoteAddr())
+		c.close()
+	}
+}
+
+type client struct {
+	srv      *Server
+	conn     *websocket.Conn
+	send     chan []byte
+	done     chan struct{}
+	once     sync.Once
+	channels map[string]bool // guarded by srv.mu
+}
+
+func (c *client) close() {
+	c.once.Do(func() {
+		close(c.done)
+		c.conn.Close()
+	})
+}
+
+func (c *client) readLoop() {
+	defer func() {
+		c.close()
+		c.srv.remove(c)
+	}()
+
+	for {
+		_, msg, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if string(msg) == "ping" {
+			c.reply([]byte("pong"))
+			continue
+		}
+
+		var req request
+		if err := json.Unmarshal(msg, &req); err != nil {
+			c.replyJSON(response{Code: 1, Msg: "invalid request"})
+			continue
+		}
+
+		switch strings.ToLower(req.Method) {
+		case xtws.Subscribe:
+			err = c.srv.subscribe(c, req.Params)
+		case xtws.UnSubscribe:
+			err = c.srv.unsubscribe(c, req.Params)
+		default:
+			c.replyJSON(response{ID: req.ID, Code: 1, Msg: "unsupported method " + req.Method})
+			continue
+		}
+
+		if err != nil {
+			c.replyJSON(response{ID: req.ID, Code: 1, Msg: err.Error()})
+			continue
+		}
+		c.replyJSON(response{ID: req.ID, Code: 0, Msg: "success"})
+	}
+}
+
+func (c *client) replyJSON(resp response) {
+	b, _ := json.Marshal(resp)
+	c.reply(b)
+}
+
+// reply queue a control frame, they are never dropped silently
+func (c *client) reply(b []byte) {
+	select {
+	case c.send <- b:
+	case <-c.done:
+	}
+}
+
+func (c *client) writeLoop() {
+	for {
+		select {
+		case <-c.done:
+			return
+		case msg := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(c.srv.opts.WriteTimeout))
+			if err := c.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				c.close()
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package relay
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	xtws "github.com/liuhengloveyou/xtws-go"
+)
+
+// upstream fake XT endpoint recording subscribe frames, push sends a frame to the connection
+type upstream struct {
+	srv *httptest.Server
+
+	mu     sync.Mutex
+	conn   *websocket.Conn
+	frames []string // method + params of the received requests
+	got    chan struct{}
+}
+
+func newUpstream(t *testing.T) *upstream {
+	u := &upstream{got: make(chan struct{}, 100)}
+	upgrader := websocket.Upgrader{}
+	u.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		u.mu.Lock()
+		u.conn = c
+		u.mu.Unlock()
+		for {
+			_, msg, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			var req xtws.Request
+			if json.Unmarshal(msg, &req) != nil {
+				continue
+			}
+			u.mu.Lock()
+			u.frames = append(u.frames, req.Method+" "+strings.Join(req.Params, ","))
+			u.mu.Unlock()
+			u.got <- struct{}{}
+		}
+	}))
+	t.Cleanup(u.srv.Close)
+	return u
+}
+
+func (u *upstream) url() string { return "ws" + strings.TrimPrefix(u.srv.URL, "http") }
+
+func (u *upstream) push(t *testing.T, frame string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if err := u.conn.WriteMessage(websocket.TextMessage, []byte(frame)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// waitFrames wait until n requests arrived and return them
+func (u *upstream) waitFrames(t *testing.T, n int) []string {
+	t.Helper()
+	timeout := time.After(time.Second)
+	for {
+		u.mu.Lock()
+		frames := append([]string(nil), u.frames...)
+		u.mu.Unlock()
+		if len(frames) >= n {
+			return frames
+		}
+		select {
+		case <-u.got:
+		case <-timeout:
+			t.Fatalf("got %v, want %d upstream requests", frames, n)
+		}
+	}
+}
+
+func newTestRelay(t *testing.T) (*Server, *upstream, string, context.CancelFunc) {
+	up := newUpstream(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	ws, err := xtws.NewWsService(ctx, log.New(io.Discard, "", 0), xtws.NewConnConfFromOption(&xtws.ConfOptions{URL: up.url()}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := New(ws, Options{Logger: log.New(io.Discard, "", 0)})
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	return s, up, "ws" + strings.TrimPrefix(srv.URL, "http"), cancel
+}
+
+func dialClient(t *testing.T, url string) *websocket.Conn {
+	c, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func call(t *testing.T, c *websocket.Conn, method string, params ...string) response {
+	t.Helper()
+	if err := c.WriteJSON(map[string]any{"id": "1", "method": method, "params": params}); err != nil {
+		t.Fatal(err)
+	}
+	var resp response
+	c.SetReadDeadline(time.Now().Add(time.Second))
+	if err := c.ReadJSON(&resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func (s *Server) topicCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.topics)
+}
+
+func TestRelayRefCount(t *testing.T) {
+	s, up, url, _ := newTestRelay(t)
+	const channel = "depth@btc_usdt,5"
+
+	a, b := dialClient(t, url), dialClient(t, url)
+	if resp := call(t, a, xtws.Subscribe, channel); resp.Code != 0 {
+		t.Fatalf("subscribe %+v", resp)
+	}
+	if resp := call(t, b, xtws.Subscribe, channel); resp.Code != 0 {
+		t.Fatalf("subscribe %+v", resp)
+	}
+	if frames := up.waitFrames(t, 1); len(frames) != 1 || frames[0] != "subscribe "+channel {
+		t.Fatalf("upstream got %v, want one subscribe", frames)
+	}
+
+	frame := `{"topic":"depth","event":"depth@btc_usdt,5","data":{"s":"btc_usdt"}}`
+	up.push(t, frame)
+	for _, c := range []*websocket.Conn{a, b} {
+		c.SetReadDeadline(time.Now().Add(time.Second))
+		if _, msg, err := c.ReadMessage(); err != nil || string(msg) != frame {
+			t.Fatalf("client got %q %v", msg, err)
+		}
+	}
+
+	call(t, a, xtws.UnSubscribe, channel)
+	if n := s.Channels()[channel]; n != 1 || s.topicCount() != 1 {
+		t.Fatalf("refs %d topics %d after the first unsubscribe", n, s.topicCount())
+	}
+	b.Close()
+	if frames := up.waitFrames(t, 2); frames[1] != "unsubscribe "+channel {
+		t.Fatalf("upstream got %v, want an unsubscribe", frames)
+	}
+	if len(s.Channels()) != 0 || s.topicCount() != 0 {
+		t.Fatalf("channels %v topics %d, want none after the last client left", s.Channels(), s.topicCount())
+	}
+}
+
+func TestRelaySubscribeRollback(t *testing.T) {
+	s, _, url, cancel := newTestRelay(t)
+	// the upstream connection is gone, the subscribe write fails
+	cancel()
+
+	c := dialClient(t, url)
+	if resp := call(t, c, xtws.Subscribe, "depth@btc_usdt,5"); resp.Code == 0 {
+		t.Fatalf("subscribe succeeded without upstream: %+v", resp)
+	}
+	if len(s.Channels()) != 0 || s.topicCount() != 0 {
+		t.Fatalf("channels %v topics %d left after a failed subscribe", s.Channels(), s.topicCount())
+	}
+}
+
+func TestRelaySharesServiceChannels(t *testing.T) {
+	s, up, url, _ := newTestRelay(t)
+	const channel = "trade@btc_usdt"
+
+	sub, err := xtws.SubscribeChan[xtws.UpdateTradeMsg](context.Background(), s.ws, xtws.ChannelSpotTrade, []string{"btc_usdt"}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := dialClient(t, url)
+	if resp := call(t, c, xtws.Subscribe, channel); resp.Code != 0 {
+		t.Fatalf("subscribe %+v", resp)
+	}
+	c.Close()
+	for deadline := time.Now().Add(time.Second); s.Clients() > 0; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("client not removed")
+		}
+	}
+
+	// the channel was subscribed once and is unsubscribed when the last holder lets go
+	sub.Unsubscribe()
+	if frames := up.waitFrames(t, 2); len(frames) != 2 || frames[0] != "subscribe "+channel || frames[1] != "unsubscribe "+channel {
+		t.Fatalf("upstream got %v", frames)
+	}
+}
@@ -0,0 +1,381 @@
+package xtws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rules of RiskError
+const (
+	RiskInvalid     = "invalid"
+	RiskKillSwitch  = "kill_switch"
+	RiskMaxNotional = "max_notional"
+	RiskMaxPosition = "max_position"
+	RiskPriceBand   = "price_band"
+	RiskRateLimit   = "rate_limit"
+)
+
+// RiskError order rejected before it was sent, use errors.As to tell it apart from connection errors
+type RiskError struct {
+	Rule   string // RiskKillSwitch, RiskMaxNotional, ...
+	Symbol string
+	Reason string
+}
+
+func (e *RiskError) Error() string {
+	return fmt.Sprintf("risk %s %s: %s", e.Rule, e.Symbol, e.Reason)
+}
+
+// OrderIntent order or amendment checked before it is sent
+type OrderIntent struct {
+	Symbol        string
+	Side          string  // buy or sell, any case
+	Price         Decimal // 0 for market orders, the reference price is used instead
+	Quantity      Decimal // base quantity
+	QuoteQty      Decimal // quote amount of a market buy, instead of Quantity
+	ClientOrderID string
+	OrderID       string         // amended order
+	Amend         bool           // set by AmendOrder
+	Params        map[string]any // extra request parameters, e.g. timeInForce, the checked fields can not be set here
+}
+
+func (o *OrderIntent) buy() bool { return strings.EqualFold(o.Side, "buy") }
+
+// checkedParams request fields of OrderIntent the risk checks see, Params may not replace them
+var checkedParams = []string{"symbol", "side", "price", "quantity", "quoteQty", "clientOrderId", "orderId"}
+
+// RiskChecker returns a *RiskError to reject the order
+type RiskChecker interface {
+	CheckOrder(o *OrderIntent) error
+}
+
+// RiskCheckerFunc adapts a func to RiskChecker
+type RiskCheckerFunc func(o *OrderIntent) error
+
+func (f RiskCheckerFunc) CheckOrder(o *OrderIntent) error { return f(o) }
+
+// RiskSettler optional interface of a RiskChecker, OrderSettled is called for every order the checker passed.
+// sent is false when a later check rejected the order, true once it was sent, whatever the exchange answered.
+type RiskSettler interface {
+	OrderSettled(o *OrderIntent, sent bool)
+}
+
+// settleRisk tell the settlers among checks the outcome of o
+func settleRisk(checks []RiskChecker, o *OrderIntent, sent bool) {
+	for _, c := range checks {
+		if s, ok := c.(RiskSettler); ok {
+			s.OrderSettled(o, sent)
+		}
+	}
+}
+
+// UseRisk add checks run in order by PlaceOrder and AmendOrder, the first error rejects the order
+func (ws *WsService) UseRisk(checks ...RiskChecker) {
+	ws.hookMu.Lock()
+	defer ws.hookMu.Unlock()
+	ws.risk = append(ws.risk, checks...)
+}
+
+// UseOrderSender send the checked orders with sender, default a RestOrderSender with the connection credentials
+func (ws *WsService) UseOrderSender(sender OrderSender) {
+	ws.hookMu.Lock()
+	defer ws.hookMu.Unlock()
+	ws.sender = sender
+}
+
+// PlaceOrder check the order against the risk checks and send it, the ack carries the exchange order id.
+// A *RiskError is returned before anything is sent, an *OrderRejectError when the exchange refuses the order.
+func (ws *WsService) PlaceOrder(ctx context.Context, o *OrderIntent) (OrderAck, error) {
+	o.Amend = false
+	return ws.sendOrder(ctx, o)
+}
+
+// AmendOrder check the new price and quantity of the order o.OrderID against the risk checks and send the amendment
+func (ws *WsService) AmendOrder(ctx context.Context, o *OrderIntent) (OrderAck, error) {
+	if o.OrderID == "" {
+		return OrderAck{}, fmt.Errorf("amend order: order id empty")
+	}
+	o.Amend = true
+	return ws.sendOrder(ctx, o)
+}
+
+func (ws *WsService) sendOrder(ctx context.Context, o *OrderIntent) (OrderAck, error) {
+	ws.hookMu.Lock()
+	checks, sender := ws.risk, ws.sender
+	ws.hookMu.Unlock()
+
+	if sender == nil {
+		if ws.conf.isFutures() {
+			return OrderAck{}, fmt.Errorf("no order sender for futures, see UseOrderSender")
+		}
+		key, secret := ws.credentials()
+		sender = &RestOrderSender{Key: key, Secret: secret}
+	}
+
+	if !o.Amend {
+		if err := ws.beginSubmit(o); err != nil {
+			return OrderAck{}, err
+		}
+	}
+
+	for i, c := range checks {
+		if err := c.CheckOrder(o); err != nil {
+			settleRisk(checks[:i], o, false)
+			if !o.Amend {
+				ws.OrderAcked(o.ClientOrderID)
+			}
+			return OrderAck{}, err
+		}
+	}
+
+	if o.Amend {
+		ack, err := sender.AmendOrder(ctx, o)
+		settleRisk(checks, o, true)
+		return ack, err
+	}
+	ack, err := sender.PlaceOrder(ctx, o)
+	settleRisk(checks, o, true)
+	// an ack or a reject settles the submission, after any other error the order may still be placed
+	// and the id stays pending
+	var reject *OrderRejectError
+	if err == nil || errors.As(err, &reject) {
+		ws.OrderAcked(o.ClientOrderID)
+	}
+	if err != nil {
+		return OrderAck{}, err
+	}
+	if d := ws.deadman.Load(); d != nil {
+		d.track(o.Symbol, o.ClientOrderID)
+	}
+	return ack, nil
+}
+
+// RiskLimits a zero value disables the rule
+type RiskLimits struct {
+	MaxNotional Decimal // price * quantity of one order
+	MaxPosition Decimal // absolute position after the order is fully filled, needs RiskConf.Position
+	PriceBand   Decimal // max relative distance of the price to the reference price, e.g. 0.05
+}
+
+type RiskConf struct {
+	Limits       RiskLimits
+	SymbolLimits map[string]RiskLimits // per symbol limits, replace Limits
+	MaxOrders    int                   // orders and amendments per Per, 0 disables the rate limit
+	Per          time.Duration         // default 1s
+
+	// Position signed position of the symbol, e.g. from a PositionTracker or BalanceLedger
+	Position func(symbol string) Decimal
+	// RefPrice reference price of the symbol, default the prices given to SetRefPrice
+	RefPrice func(symbol string) (Decimal, bool)
+}
+
+// RiskManager built-in pre-trade checks: kill switch, max notional, max position, price band and rate limit.
+// Orders whose notional or price band can not be checked because the reference price is unknown are rejected.
+type RiskManager struct {
+	conf RiskConf
+
+	mu         *sync.Mutex
+	killed     bool
+	killReason string
+	refPrices  map[string]Decimal
+	sent       []time.Time // reserved and sent times within the rate limit window, oldest first
+}
+
+// NewRiskManager a MaxPosition limit needs conf.Position
+func NewRiskManager(conf RiskConf) (*RiskManager, error) {
+	if conf.Position == nil {
+		if !conf.Limits.MaxPosition.IsZero() {
+			return nil, fmt.Errorf("risk MaxPosition needs RiskConf.Position")
+		}
+		for symbol, l := range conf.SymbolLimits {
+			if !l.MaxPosition.IsZero() {
+				return nil, fmt.Errorf("risk MaxPosition of %s needs RiskConf.Position", symbol)
+			}
+		}
+	}
+	if conf.Per <= 0 {
+		conf.Per = time.Second
+	}
+	return &RiskManager{
+		conf:      conf,
+		mu:        new(sync.Mutex),
+		refPrices: make(map[string]Decimal),
+	}, nil
+}
+
+// Kill reject every order until Resume
+func (r *RiskManager) Kill(reason string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.killed, r.killReason = true, reason
+}
+
+func (r *RiskManager) Resume() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.killed, r.killReason = false, ""
+}
+
+func (r *RiskManager) Killed() (killed bool, reason string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.killed, r.killReason
+}
+
+// SetRefPrice reference price of the price band and of market orders
+func (r *RiskManager) SetRefPrice(symbol string, price Decimal) {
+	if price.IsZero() {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.refPrices[symbol] = price
+}
+
+// AttachTicker use the last price of the ChannelSpotTicker pushes as reference price
+func (r *RiskManager) AttachTicker(ws *WsService) (remove func()) {
+	return ws.AddCallBack(ChannelSpotTicker, ws.NewTickerCallBack(func(msg *UpdateTickerMsg) {
+		price, err := msg.Data.ClosePrice()
+		if err != nil {
+			ws.Logger.Printf("risk skip ticker %s err:%s", msg.Data.Symbol, err.Error())
+			return
+		}
+		r.SetRefPrice(msg.Data.Symbol, price)
+	}))
+}
+
+// AttachMarkPrice use the ChannelFutureMarkPrice pushes as reference price
+func (r *RiskManager) AttachMarkPrice(ws *WsService) (remove func()) {
+	return ws.AddCallBack(ChannelFutureMarkPrice, ws.NewFuturesMarkPriceCallBack(func(msg *UpdateFuturesMarkPriceMsg) {
+		price, err := msg.Data.Value()
+		if err != nil {
+			ws.Logger.Printf("risk skip mark price %s err:%s", msg.Data.Symbol, err.Error())
+			return
+		}
+		r.SetRefPrice(msg.Data.Symbol, price)
+	}))
+}
+
+func (r *RiskManager) refPrice(symbol string) (Decimal, bool) {
+	if r.conf.RefPrice != nil {
+		return r.conf.RefPrice(symbol)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.refPrices[symbol]
+	return p, ok
+}
+
+// CheckOrder the rate limit slot is reserved by orders passing every other rule of r, it is given back
+// by OrderSettled when a later check rejects the order. Concurrent orders can not overrun the limit.
+func (r *RiskManager) CheckOrder(o *OrderIntent) error {
+	reject := func(rule, format string, args ...any) error {
+		return &RiskError{Rule: rule, Symbol: o.Symbol, Reason: fmt.Sprintf(format, args...)}
+	}
+
+	if killed, reason := r.Killed(); killed {
+		return reject(RiskKillSwitch, "trading halted: %s", reason)
+	}
+	for _, k := range checkedParams {
+		if _, ok := o.Params[k]; ok {
+			return reject(RiskInvalid, "%s can not be set in Params", k)
+		}
+	}
+	if o.Price.Sign() < 0 {
+		return reject(RiskInvalid, "price %s negative", o.Price)
+	}
+
+	limits := r.conf.Limits
+	if l, ok := r.conf.SymbolLimits[o.Symbol]; ok {
+		limits = l
+	}
+
+	ref, hasRef := r.refPrice(o.Symbol)
+	price := o.Price
+	if price.IsZero() {
+		price = ref
+	}
+
+	// base quantity, derived from the reference price for a quote amount
+	qty := o.Quantity
+	if !o.QuoteQty.IsZero() {
+		if !o.buy() || !o.Price.IsZero() || !o.Quantity.IsZero() {
+			return reject(RiskInvalid, "quote quantity is only for market buys without quantity")
+		}
+		if o.QuoteQty.Sign() < 0 {
+			return reject(RiskInvalid, "quote quantity %s negative", o.QuoteQty)
+		}
+		if price.IsZero() {
+			return reject(RiskInvalid, "no reference price for a quote quantity")
+		}
+		qty = o.QuoteQty.Div(price, 18)
+	}
+	if qty.Sign() <= 0 {
+		return reject(RiskInvalid, "quantity %s not positive", qty)
+	}
+
+	if !limits.MaxNotional.IsZero() {
+		if price.IsZero() {
+			return reject(RiskMaxNotional, "no reference price for a market order")
+		}
+		notional := price.Mul(qty)
+		if !o.QuoteQty.IsZero() {
+			notional = o.QuoteQty
+		}
+		if notional.GreaterThan(limits.MaxNotional) {
+			return reject(RiskMaxNotional, "notional %s above %s", notional, limits.MaxNotional)
+		}
+	}
+
+	if !limits.MaxPosition.IsZero() {
+		if !o.buy() {
+			qty = qty.Neg()
+		}
+		if after := r.conf.Position(o.Symbol).Add(qty); after.Abs().GreaterThan(limits.MaxPosition) {
+			return reject(RiskMaxPosition, "position %s above %s", after, limits.MaxPosition)
+		}
+	}
+
+	if !limits.PriceBand.IsZero() && !o.Price.IsZero() {
+		if !hasRef || ref.IsZero() {
+			return reject(RiskPriceBand, "no reference price")
+		}
+		if dist := o.Price.Sub(ref).Abs().Div(ref, 8); dist.GreaterThan(limits.PriceBand) {
+			return reject(RiskPriceBand, "price %s is %s from reference %s", o.Price, dist.Normalize(), ref)
+		}
+	}
+
+	if r.conf.MaxOrders > 0 {
+		now := time.Now()
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		i := 0
+		for i < len(r.sent) && now.Sub(r.sent[i]) >= r.conf.Per {
+			i++
+		}
+		r.sent = r.sent[i:]
+		if len(r.sent) >= r.conf.MaxOrders {
+			return reject(RiskRateLimit, "%d orders within %s", len(r.sent), r.conf.Per)
+		}
+		r.sent = append(r.sent, now)
+	}
+	return nil
+}
+
+// OrderSettled give back the rate limit slot of an order that was not sent, see RiskSettler
+func (r *RiskManager) OrderSettled(_ *OrderIntent, sent bool) {
+	if sent || r.conf.MaxOrders <= 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// the slots are interchangeable, the latest is the one reserved last
+	if len(r.sent) > 0 {
+		r.sent = r.sent[:len(r.sent)-1]
+	}
+}
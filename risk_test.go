@@ -0,0 +1,260 @@
+package xtws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// orderServer fake spot order endpoint, reject answers every request with that mc
+type orderServer struct {
+	srv    *httptest.Server
+	reject string
+
+	mu       sync.Mutex
+	requests []*http.Request
+	bodies   []map[string]any
+}
+
+func newOrderServer(t *testing.T) *orderServer {
+	s := &orderServer{}
+	s.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		var body map[string]any
+		json.Unmarshal(b, &body)
+
+		ts, _ := strconv.ParseInt(r.Header.Get("validate-timestamp"), 10, 64)
+		want := SignRestHeaders("key", "secret", r.Method, r.URL.Path, "", string(b), 5*time.Second, time.UnixMilli(ts))
+		if r.Header.Get("validate-signature") != want["validate-signature"] {
+			t.Errorf("%s %s: bad signature", r.Method, r.URL.Path)
+		}
+
+		s.mu.Lock()
+		s.requests = append(s.requests, r)
+		s.bodies = append(s.bodies, body)
+		s.mu.Unlock()
+
+		if s.reject != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]any{"rc": 1, "mc": s.reject, "result": nil})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"rc": 0, "mc": "SUCCESS", "result": map[string]any{"orderId": "6216559590087220004", "modifyId": 1}})
+	}))
+	t.Cleanup(s.srv.Close)
+	return s
+}
+
+func (s *orderServer) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.requests)
+}
+
+func newOrderService(t *testing.T, s *orderServer, conf RiskConf) (*WsService, *RiskManager) {
+	r, err := NewRiskManager(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws := newTestService(nil)
+	ws.UseOrderSender(&RestOrderSender{BaseURL: s.srv.URL, Key: "key", Secret: "secret"})
+	ws.UseRisk(r)
+	return ws, r
+}
+
+func limitOrder(side, price, qty string) *OrderIntent {
+	return &OrderIntent{Symbol: "btc_usdt", Side: side, Price: MustParseDecimal(price), Quantity: MustParseDecimal(qty)}
+}
+
+func TestRiskRules(t *testing.T) {
+	tests := []struct {
+		rule  string
+		conf  RiskConf
+		setup func(ws *WsService, r *RiskManager)
+		order *OrderIntent
+	}{
+		{
+			rule:  RiskMaxNotional,
+			conf:  RiskConf{Limits: RiskLimits{MaxNotional: MustParseDecimal("1000")}},
+			order: limitOrder("buy", "30000", "0.1"),
+		},
+		{
+			rule: RiskMaxPosition,
+			conf: RiskConf{
+				Limits:   RiskLimits{MaxPosition: MustParseDecimal("1")},
+				Position: func(string) Decimal { return MustParseDecimal("-0.5") },
+			},
+			order: limitOrder("sell", "30000", "0.6"),
+		},
+		{
+			rule:  RiskPriceBand,
+			conf:  RiskConf{Limits: RiskLimits{PriceBand: MustParseDecimal("0.05")}},
+			setup: func(_ *WsService, r *RiskManager) { r.SetRefPrice("btc_usdt", MustParseDecimal("30000")) },
+			order: limitOrder("buy", "28000", "0.1"),
+		},
+		{
+			rule: RiskRateLimit,
+			conf: RiskConf{MaxOrders: 1, Per: time.Hour},
+			setup: func(ws *WsService, _ *RiskManager) {
+				if _, err := ws.PlaceOrder(context.Background(), limitOrder("buy", "30000", "0.1")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			order: limitOrder("buy", "30000", "0.1"),
+		},
+		{
+			rule:  RiskKillSwitch,
+			setup: func(_ *WsService, r *RiskManager) { r.Kill("test") },
+			order: limitOrder("buy", "30000", "0.1"),
+		},
+		{
+			rule:  RiskInvalid,
+			order: &OrderIntent{Symbol: "btc_usdt", Side: "buy", Quantity: MustParseDecimal("1"), Params: map[string]any{"price": "3e0x"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			s := newOrderServer(t)
+			ws, r := newOrderService(t, s, tt.conf)
+			if tt.setup != nil {
+				tt.setup(ws, r)
+			}
+			sent := s.count()
+
+			_, err := ws.PlaceOrder(context.Background(), tt.order)
+			var riskErr *RiskError
+			if !errors.As(err, &riskErr) || riskErr.Rule != tt.rule {
+				t.Fatalf("got %v, want a %s RiskError", err, tt.rule)
+			}
+			if s.count() != sent {
+				t.Fatalf("%d requests sent for a rejected order", s.count()-sent)
+			}
+		})
+	}
+}
+
+func TestNewRiskManagerPositionRequired(t *testing.T) {
+	if _, err := NewRiskManager(RiskConf{Limits: RiskLimits{MaxPosition: MustParseDecimal("1")}}); err == nil {
+		t.Fatal("MaxPosition accepted without Position")
+	}
+	conf := RiskConf{SymbolLimits: map[string]RiskLimits{"btc_usdt": {MaxPosition: MustParseDecimal("1")}}}
+	if _, err := NewRiskManager(conf); err == nil {
+		t.Fatal("symbol MaxPosition accepted without Position")
+	}
+}
+
+func TestPlaceOrder(t *testing.T) {
+	s := newOrderServer(t)
+	ws, _ := newOrderService(t, s, RiskConf{})
+
+	o := limitOrder("buy", "30000.5", "0.1")
+	o.ClientOrderID = "t-1"
+	o.Params = map[string]any{"timeInForce": "IOC"}
+	ack, err := ws.PlaceOrder(context.Background(), o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ack.OrderID != "6216559590087220004" || ack.ClientOrderID != "t-1" {
+		t.Fatalf("ack %+v", ack)
+	}
+
+	r, body := s.requests[0], s.bodies[0]
+	if r.Method != http.MethodPost || r.URL.Path != "/v4/order" {
+		t.Fatalf("request %s %s", r.Method, r.URL.Path)
+	}
+	want := map[string]any{"symbol": "btc_usdt", "side": "BUY", "type": "LIMIT", "timeInForce": "IOC", "bizType": "SPOT",
+		"price": "30000.5", "quantity": "0.1", "clientOrderId": "t-1"}
+	for k, v := range want {
+		if body[k] != v {
+			t.Errorf("%s = %v, want %v", k, body[k], v)
+		}
+	}
+
+	// a market buy by quote amount needs a reference price
+	if _, err := ws.PlaceOrder(context.Background(), &OrderIntent{Symbol: "btc_usdt", Side: "buy", QuoteQty: MustParseDecimal("100")}); err == nil {
+		t.Fatal("quote quantity without a reference price")
+	}
+}
+
+func TestPlaceOrderRejected(t *testing.T) {
+	s := newOrderServer(t)
+	s.reject = "ORDER_PRICE_INVALID"
+	ws, _ := newOrderService(t, s, RiskConf{})
+
+	o := limitOrder("buy", "30000", "0.1")
+	o.ClientOrderID = "t-2"
+	_, err := ws.PlaceOrder(context.Background(), o)
+	var reject *OrderRejectError
+	if !errors.As(err, &reject) || reject.Code != "ORDER_PRICE_INVALID" {
+		t.Fatalf("got %v, want the exchange reject", err)
+	}
+	if len(ws.Pending()) != 0 {
+		t.Fatalf("pending %v after a reject", ws.Pending())
+	}
+}
+
+func TestAmendOrder(t *testing.T) {
+	s := newOrderServer(t)
+	ws, _ := newOrderService(t, s, RiskConf{})
+
+	o := limitOrder("buy", "30001", "0.2")
+	o.OrderID = "6216559590087220004"
+	ack, err := ws.AmendOrder(context.Background(), o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := s.requests[0]; r.Method != http.MethodPut || r.URL.Path != "/v4/order/6216559590087220004" {
+		t.Fatalf("request %s %s", r.Method, r.URL.Path)
+	}
+	if s.bodies[0]["price"] != "30001" || s.bodies[0]["quantity"] != "0.2" || ack.ModifyID != "1" {
+		t.Fatalf("body %v ack %+v", s.bodies[0], ack)
+	}
+}
+
+func TestRiskRateLimitSlot(t *testing.T) {
+	s := newOrderServer(t)
+	ws, _ := newOrderService(t, s, RiskConf{MaxOrders: 2, Per: time.Hour})
+	// runs after the rate limit
+	ws.UseRisk(RiskCheckerFunc(func(o *OrderIntent) error {
+		if o.Price.Equal(MustParseDecimal("1")) {
+			return &RiskError{Rule: "test", Symbol: o.Symbol, Reason: "price 1"}
+		}
+		return nil
+	}))
+	place := func(price string) error {
+		_, err := ws.PlaceOrder(context.Background(), limitOrder("buy", price, "0.1"))
+		return err
+	}
+
+	// rejected by the later check, the slot is given back
+	for range 3 {
+		if err := place("1"); err == nil {
+			t.Fatal("order passed the later check")
+		}
+	}
+	if err := place("30000"); err != nil {
+		t.Fatal(err)
+	}
+
+	// an exchange reject was sent and keeps its slot
+	s.reject = "ORDER_PRICE_INVALID"
+	var reject *OrderRejectError
+	if err := place("30000"); !errors.As(err, &reject) {
+		t.Fatalf("got %v, want the exchange reject", err)
+	}
+	var riskErr *RiskError
+	if err := place("30000"); !errors.As(err, &riskErr) || riskErr.Rule != RiskRateLimit {
+		t.Fatalf("got %v, want %s", err, RiskRateLimit)
+	}
+	if s.count() != 2 {
+		t.Fatalf("%d orders sent, want 2", s.count())
+	}
+}
@@ -0,0 +1,318 @@
+package xtws
+
+import (
+	"cmp"
+	"context"
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+// StatsConfig window and publish settings of MarketStats
+type StatsConfig struct {
+	Window          time.Duration // trade window for VWAP, volatility and trade flow, default 1m
+	BookLevels      int           // levels per side for order book imbalance, default 5
+	PublishInterval time.Duration // period of OnPublish, 0 disables publishing
+	OnPublish       func([]StatsSnapshot)
+	Now             func() time.Time // clock the window ends at, default time.Now, e.g. replay time
+}
+
+// StatsSnapshot rolling statistics of one symbol, float64 is precise enough for analytics
+type StatsSnapshot struct {
+	Symbol string
+	Time   int64 // last trade or book update, milliseconds
+
+	Trades     int
+	Volume     float64 // base quantity in window
+	Notional   float64 // quote amount in window
+	VWAP       float64
+	Volatility float64 // realized volatility, sqrt of the sum of squared log returns between trades in window
+
+	BuyVolume          float64 // taker buy base quantity in window
+	SellVolume         float64
+	TradeFlowImbalance float64 // (buy - sell) / (buy + sell), in [-1, 1]
+
+	BestBid       float64
+	BestAsk       float64
+	Mid           float64
+	Spread        float64
+	SpreadBps     float64
+	BookImbalance float64 // (bid qty - ask qty) / (bid qty + ask qty) over top BookLevels, in [-1, 1]
+}
+
+type statsTrade struct {
+	time    int64
+	price   float64
+	qty     float64
+	buy     bool
+	logRet2 float64 // squared log return from the previous trade in window
+}
+
+type symbolStats struct {
+	trades    []statsTrade
+	volume    float64
+	notional  float64
+	buyVolume float64
+	sumRet2   float64
+	lastTrade int64
+
+	bidPrice, askPrice float64
+	bidQty, askQty     float64
+	lastBook           int64
+}
+
+// MarketStats computes rolling statistics from trade@{symbol} and depth@{symbol},{levels}
+type MarketStats struct {
+	conf StatsConfig
+
+	mu      *sync.Mutex
+	symbols map[string]*symbolStats
+}
+
+func NewMarketStats(conf StatsConfig) *MarketStats {
+	if conf.Window <= 0 {
+		conf.Window = time.Minute
+	}
+	if conf.BookLevels <= 0 {
+		conf.BookLevels = 5
+	}
+	if conf.Now == nil {
+		conf.Now = time.Now
+	}
+	return &MarketStats{
+		conf:    conf,
+		mu:      new(sync.Mutex),
+		symbols: make(map[string]*symbolStats),
+	}
+}
+
+// Attach consume ChannelSpotTrade and ChannelSpotDeep of ws, the returned func detaches it
+func (m *MarketStats) Attach(ws *WsService) (detach func()) {
+	removeTrade := ws.AddCallBack(ChannelSpotTrade, ws.NewTradeCallBack(func(msg *UpdateTradeMsg) {
+		if err := m.AddTrade(msg.Data); err != nil {
+			ws.Logger.Printf("market stats skip trade err:%s", err.Error())
+		}
+	}))
+	removeDepth := ws.AddCallBack(ChannelSpotDeep, ws.NewDepthCallBack(func(msg *UpdateDepthMsg) {
+		m.UpdateBook(msg.Data)
+	}))
+	return func() {
+		removeTrade()
+		removeDepth()
+	}
+}
+
+func (m *MarketStats) get(symbol string) *symbolStats {
+	st, ok := m.symbols[symbol]
+	if !ok {
+		st = &symbolStats{}
+		m.symbols[symbol] = st
+	}
+	return st
+}
+
+// AddTrade add a trade to the window of its symbol, trades arriving out of order are inserted in time order.
+// A trade with a malformed price or quantity is rejected.
+func (m *MarketStats) AddTrade(trade TradeData) error {
+	p, err := trade.TradePrice()
+	if err != nil {
+		return err
+	}
+	q, err := trade.TradeQuantity()
+	if err != nil {
+		return err
+	}
+	price, qty := p.Float64(), q.Float64()
+	if price <= 0 {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	st := m.get(trade.Symbol)
+	st.lastTrade = max(st.lastTrade, trade.Time)
+	limit := m.windowStart()
+	if trade.Time < limit {
+		m.evict(st, limit)
+		return nil
+	}
+
+	t := statsTrade{time: trade.Time, price: price, qty: qty, buy: !trade.IsBuyerMaker}
+	// after the trades of the same time, usually the end
+	i := len(st.trades)
+	for i > 0 && st.trades[i-1].time > t.time {
+		i--
+	}
+	st.trades = slices.Insert(st.trades, i, t)
+
+	if i == len(st.trades)-1 {
+		st.trades[i].logRet2 = st.logRet2(i)
+		st.volume += qty
+		st.notional += price * qty
+		st.sumRet2 += st.trades[i].logRet2
+		if t.buy {
+			st.buyVolume += qty
+		}
+	} else {
+		st.trades[i].logRet2 = st.logRet2(i)
+		st.trades[i+1].logRet2 = st.logRet2(i + 1)
+		st.sum()
+	}
+
+	m.evict(st, limit)
+	return nil
+}
+
+// logRet2 squared log return of trade i from the previous trade in window
+func (st *symbolStats) logRet2(i int) float64 {
+	if i == 0 {
+		return 0
+	}
+	r := math.Log(st.trades[i].price / st.trades[i-1].price)
+	return r * r
+}
+
+// windowStart trades before it are out of the window
+func (m *MarketStats) windowStart() int64 {
+	return m.conf.Now().UnixMilli() - m.conf.Window.Milliseconds()
+}
+
+// evict drop trades older than limit, the window start by the clock
+func (m *MarketStats) evict(st *symbolStats, limit int64) {
+	n := 0
+	for n < len(st.trades) && st.trades[n].time < limit {
+		n++
+	}
+	if n == 0 {
+		return
+	}
+	st.trades = slices.Delete(st.trades, 0, n)
+	if len(st.trades) > 0 {
+		// the first trade in window has no previous trade in window
+		st.trades[0].logRet2 = 0
+	}
+	st.sum()
+}
+
+// sum recompute sums instead of subtracting, avoids float drift
+func (st *symbolStats) sum() {
+	st.volume, st.notional, st.buyVolume, st.sumRet2 = 0, 0, 0, 0
+	for _, t := range st.trades {
+		st.volume += t.qty
+		st.notional += t.price * t.qty
+		st.sumRet2 += t.logRet2
+		if t.buy {
+			st.buyVolume += t.qty
+		}
+	}
+}
+
+// UpdateBook apply a limited depth snapshot
+func (m *MarketStats) UpdateBook(depth DepthData) {
+	var bidQty, askQty float64
+	var bidPrice, askPrice float64
+
+	n := 0
+	depth.Bids.Range(func(price, quantity Decimal) bool {
+		if n == 0 {
+			bidPrice = price.Float64()
+		}
+		bidQty += quantity.Float64()
+		n++
+		return n < m.conf.BookLevels
+	})
+	n = 0
+	depth.Asks.Range(func(price, quantity Decimal) bool {
+		if n == 0 {
+			askPrice = price.Float64()
+		}
+		askQty += quantity.Float64()
+		n++
+		return n < m.conf.BookLevels
+	})
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	st := m.get(depth.Symbol)
+	st.bidPrice, st.askPrice = bidPrice, askPrice
+	st.bidQty, st.askQty = bidQty, askQty
+	st.lastBook = depth.Time
+}
+
+func (st *symbolStats) snapshot(symbol string) StatsSnapshot {
+	s := StatsSnapshot{
+		Symbol:     symbol,
+		Time:       max(st.lastTrade, st.lastBook),
+		Trades:     len(st.trades),
+		Volume:     st.volume,
+		Notional:   st.notional,
+		Volatility: math.Sqrt(st.sumRet2),
+		BuyVolume:  st.buyVolume,
+		SellVolume: st.volume - st.buyVolume,
+		BestBid:    st.bidPrice,
+		BestAsk:    st.askPrice,
+	}
+	if st.volume > 0 {
+		s.VWAP = st.notional / st.volume
+		s.TradeFlowImbalance = (s.BuyVolume - s.SellVolume) / st.volume
+	}
+	if st.bidPrice > 0 && st.askPrice > 0 {
+		s.Mid = (st.bidPrice + st.askPrice) / 2
+		s.Spread = st.askPrice - st.bidPrice
+		s.SpreadBps = s.Spread / s.Mid * 10000
+	}
+	if total := st.bidQty + st.askQty; total > 0 {
+		s.BookImbalance = (st.bidQty - st.askQty) / total
+	}
+	return s
+}
+
+// Snapshot statistics of symbol
+func (m *MarketStats) Snapshot(symbol string) (StatsSnapshot, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	st, ok := m.symbols[symbol]
+	if !ok {
+		return StatsSnapshot{}, false
+	}
+	m.evict(st, m.windowStart())
+	return st.snapshot(symbol), true
+}
+
+// Snapshots statistics of every symbol, sorted by symbol
+func (m *MarketStats) Snapshots() []StatsSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	limit := m.windowStart()
+	res := make([]StatsSnapshot, 0, len(m.symbols))
+	for symbol, st := range m.symbols {
+		m.evict(st, limit)
+		res = append(res, st.snapshot(symbol))
+	}
+	slices.SortFunc(res, func(a, b StatsSnapshot) int { return cmp.Compare(a.Symbol, b.Symbol) })
+	return res
+}
+
+// Run call OnPublish every PublishInterval until ctx is done
+func (m *MarketStats) Run(ctx context.Context) {
+	if m.conf.PublishInterval <= 0 || m.conf.OnPublish == nil {
+		return
+	}
+
+	ticker := time.NewTicker(m.conf.PublishInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.conf.OnPublish(m.Snapshots())
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package xtws
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestMarketStatsWindowByClock(t *testing.T) {
+	now := time.UnixMilli(100_000)
+	m := NewMarketStats(StatsConfig{Window: 10 * time.Second, Now: func() time.Time { return now }})
+
+	for _, tr := range []TradeData{
+		{Symbol: "btc_usdt", Time: 95_000, Price: "100", Quantity: "1"},
+		{Symbol: "btc_usdt", Time: 99_000, Price: "110", Quantity: "2", IsBuyerMaker: true},
+		{Symbol: "btc_usdt", Time: 80_000, Price: "90", Quantity: "5"}, // already out of the window
+	} {
+		if err := m.AddTrade(tr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s, _ := m.Snapshot("btc_usdt")
+	if s.Trades != 2 || s.Volume != 3 {
+		t.Fatalf("snapshot %+v, want 2 trades volume 3", s)
+	}
+
+	// no trade arrives, the window still moves on
+	now = now.Add(6 * time.Second)
+	s, _ = m.Snapshot("btc_usdt")
+	if s.Trades != 1 || s.Volume != 2 || s.Volatility != 0 {
+		t.Fatalf("snapshot %+v, want only the trade at 99000", s)
+	}
+	now = now.Add(time.Minute)
+	if s := m.Snapshots(); len(s) != 1 || s[0].Trades != 0 || s[0].VWAP != 0 {
+		t.Fatalf("snapshots %+v, want an empty window", s)
+	}
+}
+
+func TestMarketStatsOutOfOrder(t *testing.T) {
+	now := time.UnixMilli(100_000)
+	ordered := NewMarketStats(StatsConfig{Window: time.Minute, Now: func() time.Time { return now }})
+	shuffled := NewMarketStats(StatsConfig{Window: time.Minute, Now: func() time.Time { return now }})
+
+	trades := []TradeData{
+		{Symbol: "btc_usdt", Time: 91_000, Price: "100", Quantity: "1"},
+		{Symbol: "btc_usdt", Time: 92_000, Price: "104", Quantity: "1"},
+		{Symbol: "btc_usdt", Time: 93_000, Price: "101", Quantity: "1"},
+		{Symbol: "btc_usdt", Time: 94_000, Price: "103", Quantity: "1"},
+	}
+	for _, tr := range trades {
+		ordered.AddTrade(tr)
+	}
+	for _, i := range []int{1, 3, 0, 2} {
+		shuffled.AddTrade(trades[i])
+	}
+
+	want, _ := ordered.Snapshot("btc_usdt")
+	got, _ := shuffled.Snapshot("btc_usdt")
+	if math.Abs(got.Volatility-want.Volatility) > 1e-12 || got.VWAP != want.VWAP || got.Time != want.Time {
+		t.Fatalf("out of order %+v, in order %+v", got, want)
+	}
+}
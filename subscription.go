@@ -0,0 +1,241 @@
+package xtws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// Subscription delivers decoded messages of one topic through a channel
+type Subscription[T any] struct {
+	C <-chan T
+
+	ws       *WsService
+	topic    string
+	channels []string
+	events   map[string]bool // channels as frame events, nil accepts every frame of topic
+	remove   func()
+	c        chan T
+	mu       *sync.Mutex
+	closed   bool
+	err      error
+	cancel   context.CancelFunc
+	once     *sync.Once
+}
+
+// SubscribeChan subscribe topic for symbols, messages are decoded into T and sent to Subscription.C.
+// Channels are built as topic@symbol, e.g. SubscribeChan[UpdateDepthMsg](ctx, ws, ChannelSpotDeep, []string{"btc_usdt,5"}, 100).
+// Without symbols the topic itself is subscribed.
+// The subscription ends when ctx is done or Unsubscribe is called, then C is closed.
+func SubscribeChan[T any](ctx context.Context, ws *WsService, topic string, symbols []string, bufSize int) (*Subscription[T], error) {
+	if ws == nil {
+		return nil, fmt.Errorf("ws service is nil")
+	}
+	if topic == "" {
+		return nil, fmt.Errorf("topic is empty")
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if bufSize < 0 {
+		bufSize = 0
+	}
+
+	channels := make([]string, 0, len(symbols))
+	for _, symbol := range symbols {
+		channels = append(channels, fmt.Sprintf("%s@%s", topic, symbol))
+	}
+	if len(channels) == 0 {
+		channels = append(channels, topic)
+	}
+
+	c := make(chan T, bufSize)
+	subCtx, cancel := context.WithCancel(ctx)
+	sub := &Subscription[T]{
+		C:        c,
+		ws:       ws,
+		topic:    topic,
+		channels: channels,
+		c:        c,
+		mu:       new(sync.Mutex),
+		cancel:   cancel,
+		once:     new(sync.Once),
+	}
+	if len(symbols) > 0 {
+		sub.events = make(map[string]bool, len(channels))
+		for _, channel := range channels {
+			sub.events[channel] = true
+		}
+	}
+
+	// a listener next to the other callbacks of topic, SetCallBack would replace them
+	sub.remove = ws.AddCallBack(topic, sub.deliver)
+
+	if err := ws.AcquireChannels(channels); err != nil {
+		sub.remove()
+		cancel()
+		sub.close(err)
+		return nil, err
+	}
+
+	go func() {
+		<-subCtx.Done()
+		if err := sub.unsubscribe(subCtx.Err()); err != nil {
+			ws.Logger.Printf("unsubscribe %s err:%s", channels, err.Error())
+		}
+	}()
+
+	return sub, nil
+}
+
+func (s *Subscription[T]) deliver(rawMsg []byte) {
+	if s.events != nil {
+		// frames of the topic for channels of other subscriptions
+		_, event, ok := ScanTopicEvent(rawMsg)
+		if ok && !s.events[string(event)] {
+			return
+		}
+	}
+
+	var msg T
+	if err := json.Unmarshal(rawMsg, &msg); err != nil {
+		s.ws.Logger.Printf("subscription [%s] decode err:%s", s.topic, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+
+	// never block the read loop, a slow consumer loses messages instead
+	select {
+	case s.c <- msg:
+	default:
+		s.ws.Logger.Printf("subscription [%s] buffer full, drop message", s.topic)
+	}
+}
+
+// Unsubscribe remove the callback and close C, channels no other subscription needs are unsubscribed from server
+func (s *Subscription[T]) Unsubscribe() error {
+	return s.unsubscribe(context.Canceled)
+}
+
+func (s *Subscription[T]) unsubscribe(reason error) error {
+	var err error
+	s.once.Do(func() {
+		s.cancel()
+		s.remove()
+
+		err = s.ws.ReleaseChannels(s.channels)
+		if err != nil {
+			reason = err
+		}
+		s.close(reason)
+	})
+	return err
+}
+
+func (s *Subscription[T]) close(reason error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.err = reason
+	close(s.c)
+}
+
+// Err returns the reason why C was closed, nil while the subscription is active
+func (s *Subscription[T]) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Channels returns the subscribed channels
+func (s *Subscription[T]) Channels() []string {
+	return s.channels
+}
+
+// channelRef holders sharing a channel, see AcquireChannels
+type channelRef struct {
+	count    int
+	external bool // subscribed before the first holder, left subscribed after the last
+}
+
+// AcquireChannels hold channels, subscribing the ones nobody holds yet. SubscribeChan, config topics,
+// relay and httpfeed share channels through it, every AcquireChannels needs one ReleaseChannels.
+func (ws *WsService) AcquireChannels(channels []string) error {
+	ws.chanMu.Lock()
+	var fresh []string
+	for _, channel := range channels {
+		ref := ws.chanRefs[channel]
+		if ref == nil {
+			ref = &channelRef{external: ws.subscribed(channel)}
+			ws.chanRefs[channel] = ref
+			if !ref.external {
+				fresh = append(fresh, channel)
+			}
+		}
+		ref.count++
+	}
+	ws.chanMu.Unlock()
+
+	if len(fresh) == 0 {
+		return nil
+	}
+	// written without chanMu, the write waits while reconnecting
+	if err := ws.Subscribe(fresh); err != nil {
+		ws.dropChannelRefs(channels)
+		return err
+	}
+	return nil
+}
+
+// ReleaseChannels drop a hold on channels, unsubscribing the ones nobody holds anymore
+func (ws *WsService) ReleaseChannels(channels []string) error {
+	stale := ws.dropChannelRefs(channels)
+	if len(stale) == 0 {
+		return nil
+	}
+	return ws.UnSubscribe(stale)
+}
+
+// dropChannelRefs forget one subscription of channels, returns the channels nothing needs anymore
+func (ws *WsService) dropChannelRefs(channels []string) []string {
+	ws.chanMu.Lock()
+	defer ws.chanMu.Unlock()
+
+	var stale []string
+	for _, channel := range channels {
+		ref := ws.chanRefs[channel]
+		if ref == nil {
+			continue
+		}
+		ref.count--
+		if ref.count > 0 {
+			continue
+		}
+		delete(ws.chanRefs, channel)
+		if !ref.external {
+			stale = append(stale, channel)
+		}
+	}
+	return stale
+}
+
+// subscribed the latest request of channel is a subscribe
+func (ws *WsService) subscribed(channel string) bool {
+	v, ok := ws.conf.subscribeMsg.Load(channel)
+	if !ok {
+		return false
+	}
+	reqs := v.([]requestHistory)
+	return len(reqs) > 0 && reqs[len(reqs)-1].Method == Subscribe
+}
@@ -0,0 +1,253 @@
+package xtws
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// StoredSubscription one channel of a SubscriptionState
+type StoredSubscription struct {
+	Channel   string `json:"channel"`             // without the listen key when ListenKey is set
+	ID        string `json:"id,omitempty"`        // SubscribeOptions.ID
+	Private   bool   `json:"private,omitempty"`   // SubscribeOptions.Private
+	ListenKey bool   `json:"listenKey,omitempty"` // subscribed as {channel}@{listenKey}, the current key is used on restore
+}
+
+// SubscriptionState desired subscriptions and the names of the callbacks bound with SetNamedCallBack
+type SubscriptionState struct {
+	Subscriptions []StoredSubscription `json:"subscriptions"`
+	CallBacks     map[string]string    `json:"callbacks,omitempty"` // channel -> name given to RegisterCallBack
+}
+
+// SubscriptionStore persists the subscriptions of a WsService, see ConnConf.SubscriptionStore
+type SubscriptionStore interface {
+	// LoadSubscriptions returns an empty state when nothing was saved yet
+	LoadSubscriptions() (*SubscriptionState, error)
+	SaveSubscriptions(state *SubscriptionState) error
+}
+
+// FileSubscriptionStore state as JSON in a file, replaced atomically
+type FileSubscriptionStore struct {
+	Path string
+}
+
+func (s *FileSubscriptionStore) LoadSubscriptions() (*SubscriptionState, error) {
+	state := &SubscriptionState{}
+	b, err := os.ReadFile(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, state); err != nil {
+		return nil, fmt.Errorf("load subscriptions %s: %w", s.Path, err)
+	}
+	return state, nil
+}
+
+func (s *FileSubscriptionStore) SaveSubscriptions(state *SubscriptionState) error {
+	b, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.Path), filepath.Base(s.Path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.Path)
+}
+
+var (
+	namedCallBacksMu = new(sync.RWMutex)
+	namedCallBacks   = make(map[string]CallBack)
+)
+
+// RegisterCallBack make call restorable by name, register before NewWsService, e.g. in init
+func RegisterCallBack(name string, call CallBack) {
+	if name == "" || call == nil {
+		return
+	}
+	namedCallBacksMu.Lock()
+	defer namedCallBacksMu.Unlock()
+	namedCallBacks[name] = call
+}
+
+func lookupCallBack(name string) (CallBack, bool) {
+	namedCallBacksMu.RLock()
+	defer namedCallBacksMu.RUnlock()
+	call, ok := namedCallBacks[name]
+	return call, ok
+}
+
+// SetNamedCallBack SetCallBack with the callback registered as name, the binding is persisted
+func (ws *WsService) SetNamedCallBack(channel, name string) error {
+	call, ok := lookupCallBack(name)
+	if !ok {
+		return fmt.Errorf("callback %q not registered", name)
+	}
+	ws.SetCallBack(channel, call)
+
+	ws.persistMu.Lock()
+	if ws.callNames == nil {
+		ws.callNames = make(map[string]string)
+	}
+	ws.callNames[channel] = name
+	ws.persistMu.Unlock()
+
+	ws.saveSubscriptions()
+	return nil
+}
+
+// SubscriptionReport result of restoring the stored subscriptions in NewWsService
+type SubscriptionReport struct {
+	Restored         []string // channels resubscribed from the store
+	Missing          []string // declared in ConnConf.Subscriptions, not in the store
+	Extra            []string // in the store, not declared
+	UnknownCallBacks []string // stored callback names not registered
+	Skipped          []string // listen key channels restored without a listen key
+}
+
+// Changed the store and the declared set differ
+func (r *SubscriptionReport) Changed() bool {
+	return len(r.Missing) > 0 || len(r.Extra) > 0 || len(r.UnknownCallBacks) > 0 || len(r.Skipped) > 0
+}
+
+// RestoreReport what NewWsService restored, nil without ConnConf.SubscriptionStore
+func (ws *WsService) RestoreReport() *SubscriptionReport {
+	return ws.restored
+}
+
+// subscriptionState the channels whose latest request is a subscribe
+func (ws *WsService) subscriptionState() *SubscriptionState {
+	state := &SubscriptionState{}
+	listenKey := ws.GetListenKey()
+
+	ws.conf.subscribeMsg.Range(func(key, value any) bool {
+		reqs := value.([]requestHistory)
+		if len(reqs) == 0 {
+			return true
+		}
+		last := reqs[len(reqs)-1]
+		if last.Method != Subscribe {
+			return true
+		}
+
+		sub := StoredSubscription{Channel: key.(string)}
+		if last.op != nil {
+			sub.ID, sub.Private = last.op.ID, last.op.Private
+		}
+		if listenKey != "" {
+			if topic, ok := strings.CutSuffix(sub.Channel, "@"+listenKey); ok {
+				sub.Channel, sub.ListenKey = topic, true
+			}
+		}
+		state.Subscriptions = append(state.Subscriptions, sub)
+		return true
+	})
+	slices.SortFunc(state.Subscriptions, func(a, b StoredSubscription) int { return strings.Compare(a.Channel, b.Channel) })
+
+	ws.persistMu.Lock()
+	if len(ws.callNames) > 0 {
+		state.CallBacks = make(map[string]string, len(ws.callNames))
+		for channel, name := range ws.callNames {
+			state.CallBacks[channel] = name
+		}
+	}
+	ws.persistMu.Unlock()
+	return state
+}
+
+// saveSubscriptions write the current subscriptions to the store, errors are logged
+func (ws *WsService) saveSubscriptions() {
+	store := ws.conf.SubscriptionStore
+	if store == nil || ws.restoring.Load() {
+		return
+	}
+
+	state := ws.subscriptionState()
+	ws.persistMu.Lock()
+	defer ws.persistMu.Unlock()
+	if err := store.SaveSubscriptions(state); err != nil {
+		ws.Logger.Printf("save subscriptions err:%s", err.Error())
+	}
+}
+
+// restoreSubscriptions resubscribe the stored channels and rebind the named callbacks
+func (ws *WsService) restoreSubscriptions() (*SubscriptionReport, error) {
+	state, err := ws.conf.SubscriptionStore.LoadSubscriptions()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &SubscriptionReport{}
+	ws.restoring.Store(true)
+	defer ws.restoring.Store(false)
+
+	for channel, name := range state.CallBacks {
+		call, ok := lookupCallBack(name)
+		if !ok {
+			report.UnknownCallBacks = append(report.UnknownCallBacks, name)
+			continue
+		}
+		ws.SetCallBack(channel, call)
+		if ws.callNames == nil {
+			ws.callNames = make(map[string]string)
+		}
+		ws.callNames[channel] = name
+	}
+
+	stored := make([]string, 0, len(state.Subscriptions))
+	for _, sub := range state.Subscriptions {
+		channel := sub.Channel
+		if sub.ListenKey {
+			listenKey := ws.GetListenKey()
+			if listenKey == "" {
+				report.Skipped = append(report.Skipped, channel)
+				continue
+			}
+			channel += "@" + listenKey
+		}
+		stored = append(stored, sub.Channel)
+
+		var op *SubscribeOptions
+		if sub.ID != "" || sub.Private {
+			op = &SubscribeOptions{ID: sub.ID, Private: sub.Private}
+		}
+		if err := ws.newBaseChannel([]string{channel}, op); err != nil {
+			return report, fmt.Errorf("restore subscription %s: %w", channel, err)
+		}
+		report.Restored = append(report.Restored, channel)
+	}
+
+	if declared := ws.conf.Subscriptions; declared != nil {
+		for _, channel := range declared {
+			if !slices.Contains(stored, channel) {
+				report.Missing = append(report.Missing, channel)
+			}
+		}
+		for _, channel := range stored {
+			if !slices.Contains(declared, channel) {
+				report.Extra = append(report.Extra, channel)
+			}
+		}
+	}
+	slices.Sort(report.UnknownCallBacks)
+	return report, nil
+}
@@ -0,0 +1,131 @@
+package xtws
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sync/atomic"
+	"testing"
+)
+
+func TestFileSubscriptionStore(t *testing.T) {
+	dir := t.TempDir()
+	store := &FileSubscriptionStore{Path: filepath.Join(dir, "subs.json")}
+
+	state, err := store.LoadSubscriptions()
+	if err != nil || len(state.Subscriptions) != 0 {
+		t.Fatalf("state %+v err %v before the first save", state, err)
+	}
+
+	want := &SubscriptionState{
+		Subscriptions: []StoredSubscription{
+			{Channel: ChannelSpotBalance, Private: true},
+			{Channel: "order", ListenKey: true},
+			{Channel: "trade@btc_usdt", ID: "t1"},
+		},
+		CallBacks: map[string]string{ChannelSpotTrade: "trades"},
+	}
+	if err := store.SaveSubscriptions(want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.LoadSubscriptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("loaded %+v, want %+v", got, want)
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 1 {
+		t.Fatalf("%d files left in the directory", len(files))
+	}
+
+	os.WriteFile(store.Path, []byte(`{"subscriptions":`), 0o644)
+	if _, err := store.LoadSubscriptions(); err == nil {
+		t.Fatal("malformed state loaded")
+	}
+}
+
+func TestRestoreSubscriptions(t *testing.T) {
+	var trades atomic.Int32
+	RegisterCallBack("test.restore.trades", func([]byte) { trades.Add(1) })
+	store := &FileSubscriptionStore{Path: filepath.Join(t.TempDir(), "subs.json")}
+
+	first := newTestServer(t, 0)
+	ws := first.dial(t, &ConfOptions{ListenKey: "lk1", SubscriptionStore: store})
+	if err := ws.Subscribe([]string{"trade@btc_usdt", "order@lk1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ws.SubscribeSpotPrivate([]string{ChannelSpotBalance}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ws.SetNamedCallBack(ChannelSpotTrade, "test.restore.trades"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ws.SetNamedCallBack(ChannelSpotTrade, "test.restore.unknown"); err == nil {
+		t.Fatal("unregistered callback bound")
+	}
+
+	// a new process with another listen key
+	second := newTestServer(t, 0)
+	restored := second.dial(t, &ConfOptions{ListenKey: "lk2", SubscriptionStore: store,
+		Subscriptions: []string{"trade@btc_usdt", "order", "depth@btc_usdt,5"}})
+	waitFor(t, "the stored channels", func() bool {
+		return slices.Equal(second.subscribed(), []string{ChannelSpotBalance, "order@lk2", "trade@btc_usdt"})
+	})
+	if !sentWith(second, Subscribe, ChannelSpotBalance, "lk2") {
+		t.Fatal("private channel restored without the current listen key")
+	}
+
+	report := restored.RestoreReport()
+	slices.Sort(report.Restored)
+	if !slices.Equal(report.Restored, []string{ChannelSpotBalance, "order@lk2", "trade@btc_usdt"}) {
+		t.Fatalf("restored %v", report.Restored)
+	}
+	if !slices.Equal(report.Missing, []string{"depth@btc_usdt,5"}) || !slices.Equal(report.Extra, []string{ChannelSpotBalance}) {
+		t.Fatalf("missing %v extra %v", report.Missing, report.Extra)
+	}
+	if len(report.UnknownCallBacks) != 0 || len(report.Skipped) != 0 || !report.Changed() {
+		t.Fatalf("report %+v", report)
+	}
+
+	restored.handleMsg([]byte(`{"topic":"trade","event":"trade@btc_usdt","data":{}}`))
+	if trades.Load() != 1 {
+		t.Fatal("named callback not restored")
+	}
+}
+
+func TestRestoreSubscriptionsReport(t *testing.T) {
+	store := &FileSubscriptionStore{Path: filepath.Join(t.TempDir(), "subs.json")}
+	err := store.SaveSubscriptions(&SubscriptionState{
+		Subscriptions: []StoredSubscription{{Channel: "order", ListenKey: true}, {Channel: "trade@btc_usdt"}},
+		CallBacks:     map[string]string{ChannelSpotTrade: "test.report.gone"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// no listen key yet, the listen key channel is skipped
+	srv := newTestServer(t, 0)
+	ws := srv.dial(t, &ConfOptions{SubscriptionStore: store, Subscriptions: []string{"trade@btc_usdt", "order"}})
+	report := ws.RestoreReport()
+	if !slices.Equal(report.Restored, []string{"trade@btc_usdt"}) || !slices.Equal(report.Skipped, []string{"order"}) ||
+		!slices.Equal(report.UnknownCallBacks, []string{"test.report.gone"}) {
+		t.Fatalf("report %+v", report)
+	}
+	if !slices.Equal(report.Missing, []string{"order"}) || len(report.Extra) != 0 {
+		t.Fatalf("missing %v extra %v", report.Missing, report.Extra)
+	}
+
+	// the store is rewritten on the next change, without the skipped channel
+	if err := ws.Subscribe([]string{"depth@btc_usdt,5"}); err != nil {
+		t.Fatal(err)
+	}
+	state, err := store.LoadSubscriptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Subscriptions) != 2 || state.Subscriptions[0].Channel != "depth@btc_usdt,5" {
+		t.Fatalf("saved %+v", state.Subscriptions)
+	}
+}
@@ -0,0 +1,166 @@
+package xtws
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"slices"
+	"testing"
+)
+
+func tradeFrame(symbol string) []byte {
+	return []byte(`{"topic":"trade","event":"trade@` + symbol + `","data":{"s":"` + symbol + `"}}`)
+}
+
+// drain the buffered messages of C
+func drain[T any](sub *Subscription[T]) []T {
+	var msgs []T
+	for {
+		select {
+		case msg := <-sub.C:
+			msgs = append(msgs, msg)
+		default:
+			return msgs
+		}
+	}
+}
+
+func TestSubscribeChanFilter(t *testing.T) {
+	ws := newTestServer(t, 0).dial(t, nil)
+	btc, err := SubscribeChan[UpdateTradeMsg](context.Background(), ws, ChannelSpotTrade, []string{"btc_usdt"}, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eth, err := SubscribeChan[UpdateTradeMsg](context.Background(), ws, ChannelSpotTrade, []string{"eth_usdt"}, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	all, err := SubscribeChan[UpdateTradeMsg](context.Background(), ws, ChannelSpotTrade, nil, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ws.handleMsg(tradeFrame("btc_usdt"))
+	ws.handleMsg(tradeFrame("eth_usdt"))
+	ws.handleMsg([]byte(`{"topic":"trade","event":"trade@btc_usdt","data":{"i":"not a number"}}`))
+
+	if msgs := drain(btc); len(msgs) != 1 || msgs[0].Data.Symbol != "btc_usdt" {
+		t.Fatalf("btc got %+v", msgs)
+	}
+	if msgs := drain(eth); len(msgs) != 1 || msgs[0].Data.Symbol != "eth_usdt" {
+		t.Fatalf("eth got %+v", msgs)
+	}
+	if msgs := drain(all); len(msgs) != 2 {
+		t.Fatalf("topic subscription got %d messages, want 2", len(msgs))
+	}
+}
+
+func TestSubscribeChanShared(t *testing.T) {
+	srv := newTestServer(t, 0)
+	ws := srv.dial(t, nil)
+
+	first, err := SubscribeChan[UpdateTradeMsg](context.Background(), ws, ChannelSpotTrade, []string{"btc_usdt"}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := SubscribeChan[UpdateTradeMsg](context.Background(), ws, ChannelSpotTrade, []string{"btc_usdt", "eth_usdt"}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "both channels", func() bool { return slices.Equal(srv.subscribed(), []string{"trade@btc_usdt", "trade@eth_usdt"}) })
+	n := 0
+	for _, req := range srv.received() {
+		if req.Method == Subscribe && slices.Contains(req.Params, "trade@btc_usdt") {
+			n++
+		}
+	}
+	if n != 1 {
+		t.Fatalf("trade@btc_usdt subscribed %d times", n)
+	}
+
+	// the last release unsubscribes
+	if err := first.Unsubscribe(); err != nil {
+		t.Fatal(err)
+	}
+	if sentWith(srv, UnSubscribe, "trade@btc_usdt", "") {
+		t.Fatal("trade@btc_usdt unsubscribed while still held")
+	}
+	if err := second.Unsubscribe(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the unsubscribe", func() bool { return len(srv.subscribed()) == 0 })
+
+	// channels subscribed before stay subscribed
+	if err := ws.Subscribe([]string{"trade@xrp_usdt"}); err != nil {
+		t.Fatal(err)
+	}
+	third, err := SubscribeChan[UpdateTradeMsg](context.Background(), ws, ChannelSpotTrade, []string{"xrp_usdt"}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	third.Unsubscribe()
+	if sentWith(srv, UnSubscribe, "trade@xrp_usdt", "") {
+		t.Fatal("channel subscribed outside SubscribeChan unsubscribed")
+	}
+}
+
+func TestSubscribeChanContext(t *testing.T) {
+	srv := newTestServer(t, 0)
+	ws := srv.dial(t, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sub, err := SubscribeChan[UpdateTradeMsg](ctx, ws, ChannelSpotTrade, []string{"btc_usdt"}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sub.Err() != nil {
+		t.Fatalf("active subscription err %v", sub.Err())
+	}
+	cancel()
+
+	if _, ok := <-sub.C; ok {
+		t.Fatal("message after the cancel")
+	}
+	if !errors.Is(sub.Err(), context.Canceled) {
+		t.Fatalf("err %v, want context.Canceled", sub.Err())
+	}
+	waitFor(t, "the unsubscribe", func() bool { return len(srv.subscribed()) == 0 })
+	if err := sub.Unsubscribe(); err != nil {
+		t.Fatalf("second unsubscribe %v", err)
+	}
+}
+
+func TestSubscribeChanRollback(t *testing.T) {
+	srv := newTestServer(t, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	ws, err := NewWsService(ctx, log.New(io.Discard, "", 0), NewConnConfFromOption(&ConfOptions{URL: wsURL(srv.Server)}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	held, err := SubscribeChan[UpdateTradeMsg](context.Background(), ws, ChannelSpotTrade, []string{"btc_usdt"}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the service stops, the subscribe write fails
+	cancel()
+	if _, err := SubscribeChan[UpdateTradeMsg](context.Background(), ws, ChannelSpotTrade, []string{"btc_usdt", "eth_usdt"}, 1); err == nil {
+		t.Fatal("subscribed on a closed service")
+	}
+
+	ws.chanMu.Lock()
+	refs := len(ws.chanRefs)
+	btc := ws.chanRefs["trade@btc_usdt"]
+	ws.chanMu.Unlock()
+	if refs != 1 || btc == nil || btc.count != 1 {
+		t.Fatalf("%d refs, trade@btc_usdt %+v after the failed subscribe", refs, btc)
+	}
+	v, _ := ws.listeners.Load(ChannelSpotTrade)
+	if list := v.([]listener); len(list) != 1 {
+		t.Fatalf("%d listeners after the failed subscribe", len(list))
+	}
+	if held.Err() != nil {
+		t.Fatalf("held subscription closed: %v", held.Err())
+	}
+}
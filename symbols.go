@@ -0,0 +1,375 @@
+package xtws
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// SymbolInfo trading rules of a spot symbol, https://doc.xt.com/#market2symbol
+type SymbolInfo struct {
+	Symbol            string  `json:"symbol"`            // 交易对
+	State             string  `json:"state"`             // ONLINE, OFFLINE, DELISTED
+	TradingEnabled    bool    `json:"tradingEnabled"`    // 是否可交易
+	BaseCurrency      string  `json:"baseCurrency"`      // 标的币种
+	QuoteCurrency     string  `json:"quoteCurrency"`     // 报价币种
+	PricePrecision    int32   `json:"pricePrecision"`    // 价格精度
+	QuantityPrecision int32   `json:"quantityPrecision"` // 数量精度
+	TickSize          Decimal `json:"-"`                 // 价格步长, PRICE filter
+	MinPrice          Decimal `json:"-"`                 // PRICE filter
+	MaxPrice          Decimal `json:"-"`                 // PRICE filter
+	StepSize          Decimal `json:"-"`                 // 数量步长, QUANTITY filter
+	MinQty            Decimal `json:"-"`                 // QUANTITY filter
+	MaxQty            Decimal `json:"-"`                 // QUANTITY filter
+	MinNotional       Decimal `json:"-"`                 // 最小成交额, QUOTE_QTY filter
+
+	Filters []SymbolFilter `json:"filters"`
+}
+
+// SymbolFilter one entry of the filters of a symbol
+type SymbolFilter struct {
+	Filter   string  `json:"filter"` // PRICE, QUANTITY, QUOTE_QTY, PROTECTION_LIMIT, PROTECTION_MARKET
+	Min      Decimal `json:"min"`
+	Max      Decimal `json:"max"`
+	TickSize Decimal `json:"tickSize"`
+}
+
+// Trading the symbol accepts orders
+func (s *SymbolInfo) Trading() bool {
+	return s.TradingEnabled && s.State == "ONLINE"
+}
+
+// applyFilters copy the PRICE, QUANTITY and QUOTE_QTY filters to the fields
+func (s *SymbolInfo) applyFilters() {
+	for _, f := range s.Filters {
+		switch f.Filter {
+		case "PRICE":
+			s.MinPrice, s.MaxPrice, s.TickSize = f.Min, f.Max, f.TickSize
+		case "QUANTITY":
+			s.MinQty, s.MaxQty, s.StepSize = f.Min, f.Max, f.TickSize
+		case "QUOTE_QTY":
+			s.MinNotional = f.Min
+		}
+	}
+}
+
+// RoundPrice nearest valid price, on the tick size or else the price precision
+func (s *SymbolInfo) RoundPrice(price Decimal) Decimal {
+	if !s.TickSize.IsZero() {
+		return price.Div(s.TickSize, 0).Mul(s.TickSize)
+	}
+	return price.Round(s.PricePrecision)
+}
+
+// RoundQuantity largest valid quantity not above qty, on the step size or else the quantity precision
+func (s *SymbolInfo) RoundQuantity(qty Decimal) Decimal {
+	if !s.StepSize.IsZero() {
+		return qty.Div(s.StepSize, 18).Truncate(0).Mul(s.StepSize)
+	}
+	return qty.Truncate(s.QuantityPrecision)
+}
+
+// Validate check price and quantity against the rules, price 0 is a market order
+func (s *SymbolInfo) Validate(price, qty Decimal) error {
+	if !s.Trading() {
+		return fmt.Errorf("symbol %s not trading, state %s", s.Symbol, s.State)
+	}
+	if !price.IsZero() {
+		if !s.RoundPrice(price).Equal(price) {
+			return fmt.Errorf("price %s of %s not on tick %s", price, s.Symbol, s.priceStep())
+		}
+		if !s.MinPrice.IsZero() && price.LessThan(s.MinPrice) {
+			return fmt.Errorf("price %s of %s below %s", price, s.Symbol, s.MinPrice)
+		}
+		if !s.MaxPrice.IsZero() && price.GreaterThan(s.MaxPrice) {
+			return fmt.Errorf("price %s of %s above %s", price, s.Symbol, s.MaxPrice)
+		}
+	}
+	if !s.RoundQuantity(qty).Equal(qty) {
+		return fmt.Errorf("quantity %s of %s not on step %s", qty, s.Symbol, s.qtyStep())
+	}
+	if !s.MinQty.IsZero() && qty.LessThan(s.MinQty) {
+		return fmt.Errorf("quantity %s of %s below %s", qty, s.Symbol, s.MinQty)
+	}
+	if !s.MaxQty.IsZero() && qty.GreaterThan(s.MaxQty) {
+		return fmt.Errorf("quantity %s of %s above %s", qty, s.Symbol, s.MaxQty)
+	}
+	if !price.IsZero() && !s.MinNotional.IsZero() {
+		if notional := price.Mul(qty); notional.LessThan(s.MinNotional) {
+			return fmt.Errorf("notional %s of %s below %s", notional, s.Symbol, s.MinNotional)
+		}
+	}
+	return nil
+}
+
+func (s *SymbolInfo) priceStep() Decimal {
+	if !s.TickSize.IsZero() {
+		return s.TickSize
+	}
+	return NewDecimal(1, -s.PricePrecision)
+}
+
+func (s *SymbolInfo) qtyStep() Decimal {
+	if !s.StepSize.IsZero() {
+		return s.StepSize
+	}
+	return NewDecimal(1, -s.QuantityPrecision)
+}
+
+// SymbolLoader loads the metadata of every symbol
+type SymbolLoader interface {
+	LoadSymbols(ctx context.Context) ([]SymbolInfo, error)
+}
+
+// SymbolLoaderFunc adapts a func to SymbolLoader
+type SymbolLoaderFunc func(ctx context.Context) ([]SymbolInfo, error)
+
+func (f SymbolLoaderFunc) LoadSymbols(ctx context.Context) ([]SymbolInfo, error) { return f(ctx) }
+
+type restSymbolResp struct {
+	Rc     int    `json:"rc"`
+	Mc     string `json:"mc"`
+	Result struct {
+		Symbols []SymbolInfo `json:"symbols"`
+	} `json:"result"`
+}
+
+// RestSymbolLoader GET /v4/public/symbol
+type RestSymbolLoader struct {
+	BaseURL string // default RestBaseUrl
+	Client  *http.Client
+}
+
+func (l *RestSymbolLoader) LoadSymbols(ctx context.Context) ([]SymbolInfo, error) {
+	base := l.BaseURL
+	if base == "" {
+		base = RestBaseUrl
+	}
+	client := l.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+"/v4/public/symbol", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch symbols: http status %d", resp.StatusCode)
+	}
+
+	var body restSymbolResp
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	if body.Rc != 0 {
+		return nil, fmt.Errorf("fetch symbols: %s", body.Mc)
+	}
+	return body.Result.Symbols, nil
+}
+
+// FileSymbolLoader JSON fixture, either a saved /v4/public/symbol response or an array of symbols
+type FileSymbolLoader struct {
+	Path string
+}
+
+func (l *FileSymbolLoader) LoadSymbols(ctx context.Context) ([]SymbolInfo, error) {
+	b, err := os.ReadFile(l.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var symbols []SymbolInfo
+	if b = bytes.TrimSpace(b); len(b) > 0 && b[0] == '[' {
+		err = json.Unmarshal(b, &symbols)
+	} else {
+		var body restSymbolResp
+		err = json.Unmarshal(b, &body)
+		symbols = body.Result.Symbols
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load symbols %s: %w", l.Path, err)
+	}
+	return symbols, nil
+}
+
+// SymbolRegistry symbol metadata by symbol. Before the first Load only the spelling of symbols is normalized.
+type SymbolRegistry struct {
+	loader SymbolLoader
+	// RoundOrders CheckOrder rounds price and quantity before validating them instead of rejecting them
+	RoundOrders bool
+
+	mu      *sync.RWMutex
+	symbols map[string]SymbolInfo
+	compact map[string]string // symbol without separator -> symbol, e.g. btcusdt -> btc_usdt
+}
+
+func NewSymbolRegistry(loader SymbolLoader) *SymbolRegistry {
+	return &SymbolRegistry{
+		loader:  loader,
+		mu:      new(sync.RWMutex),
+		symbols: make(map[string]SymbolInfo),
+		compact: make(map[string]string),
+	}
+}
+
+// Load replace the metadata with the symbols of the loader
+func (r *SymbolRegistry) Load(ctx context.Context) error {
+	list, err := r.loader.LoadSymbols(ctx)
+	if err != nil {
+		return err
+	}
+	if len(list) == 0 {
+		return fmt.Errorf("load symbols: no symbols")
+	}
+
+	symbols := make(map[string]SymbolInfo, len(list))
+	compact := make(map[string]string, len(list))
+	for _, s := range list {
+		s.Symbol = strings.ToLower(s.Symbol)
+		s.applyFilters()
+		symbols[s.Symbol] = s
+		compact[strings.ReplaceAll(s.Symbol, "_", "")] = s.Symbol
+	}
+
+	r.mu.Lock()
+	r.symbols, r.compact = symbols, compact
+	r.mu.Unlock()
+	return nil
+}
+
+// Loaded the registry holds metadata
+func (r *SymbolRegistry) Loaded() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.symbols) > 0
+}
+
+// Symbols known symbols, sorted
+func (r *SymbolRegistry) Symbols() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	res := make([]string, 0, len(r.symbols))
+	for s := range r.symbols {
+		res = append(res, s)
+	}
+	slices.Sort(res)
+	return res
+}
+
+// Normalize spell symbol like XT does: "BTC-USDT", "BTC/USDT" and, once loaded, "BTCUSDT" become "btc_usdt".
+// Unknown symbols are an error once the registry is loaded.
+func (r *SymbolRegistry) Normalize(symbol string) (string, error) {
+	s := strings.ToLower(strings.TrimSpace(symbol))
+	s = strings.NewReplacer("-", "_", "/", "_", " ", "_").Replace(s)
+	if s == "" {
+		return "", fmt.Errorf("symbol is empty")
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if len(r.symbols) == 0 {
+		return s, nil
+	}
+	if _, ok := r.symbols[s]; ok {
+		return s, nil
+	}
+	if known, ok := r.compact[strings.ReplaceAll(s, "_", "")]; ok {
+		return known, nil
+	}
+	return "", fmt.Errorf("unknown symbol %q", symbol)
+}
+
+// NormalizeAll Normalize every symbol
+func (r *SymbolRegistry) NormalizeAll(symbols []string) ([]string, error) {
+	res := make([]string, 0, len(symbols))
+	for _, symbol := range symbols {
+		s, err := r.Normalize(symbol)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, s)
+	}
+	return res, nil
+}
+
+// Lookup metadata of symbol, which is normalized first
+func (r *SymbolRegistry) Lookup(symbol string) (SymbolInfo, bool) {
+	s, err := r.Normalize(symbol)
+	if err != nil {
+		return SymbolInfo{}, false
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	info, ok := r.symbols[s]
+	return info, ok
+}
+
+// CheckOrder normalize the symbol of o and validate, or with RoundOrders round, its price and quantity.
+// Use it first in WsService.UseRisk so the other checks see the final order.
+func (r *SymbolRegistry) CheckOrder(o *OrderIntent) error {
+	reject := func(err error) error {
+		return &RiskError{Rule: RiskInvalid, Symbol: o.Symbol, Reason: err.Error()}
+	}
+
+	symbol, err := r.Normalize(o.Symbol)
+	if err != nil {
+		return reject(err)
+	}
+	o.Symbol = symbol
+
+	info, ok := r.Lookup(symbol)
+	if !ok {
+		// not loaded
+		return nil
+	}
+	if !o.QuoteQty.IsZero() {
+		// a market buy by quote amount, the base quantity is only known once filled
+		if !info.Trading() {
+			return reject(fmt.Errorf("symbol %s not trading, state %s", info.Symbol, info.State))
+		}
+		if !info.MinNotional.IsZero() && o.QuoteQty.LessThan(info.MinNotional) {
+			return reject(fmt.Errorf("notional %s of %s below %s", o.QuoteQty, info.Symbol, info.MinNotional))
+		}
+		return nil
+	}
+	if r.RoundOrders {
+		if !o.Price.IsZero() {
+			o.Price = info.RoundPrice(o.Price)
+		}
+		o.Quantity = info.RoundQuantity(o.Quantity)
+	}
+	if err := info.Validate(o.Price, o.Quantity); err != nil {
+		return reject(err)
+	}
+	return nil
+}
+
+// UseSymbols normalize and check the symbols given to the spot Subscribe* methods with r
+func (ws *WsService) UseSymbols(r *SymbolRegistry) {
+	ws.symbols.Store(r)
+}
+
+// normalizeSymbols returns symbols unchanged without a registry
+func (ws *WsService) normalizeSymbols(symbols []string) ([]string, error) {
+	r := ws.symbols.Load()
+	if r == nil {
+		return symbols, nil
+	}
+	return r.NormalizeAll(symbols)
+}
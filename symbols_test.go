@@ -0,0 +1,123 @@
+package xtws
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func loadTestSymbols(t *testing.T) *SymbolRegistry {
+	t.Helper()
+	r := NewSymbolRegistry(&FileSymbolLoader{Path: filepath.Join("testdata", "spot", "symbols.json")})
+	if err := r.Load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestSymbolRegistryNormalize(t *testing.T) {
+	unloaded := NewSymbolRegistry(nil)
+	if s, err := unloaded.Normalize(" BTC/USDT "); err != nil || s != "btc_usdt" {
+		t.Fatalf("unloaded: %q %v", s, err)
+	}
+
+	r := loadTestSymbols(t)
+	for _, in := range []string{"btc_usdt", "BTC-USDT", "BTC/USDT", "btc usdt", "BTCUSDT"} {
+		if s, err := r.Normalize(in); err != nil || s != "btc_usdt" {
+			t.Errorf("%s: %q %v", in, s, err)
+		}
+	}
+	for _, in := range []string{"doge_usdt", "DOGEUSDT", ""} {
+		if s, err := r.Normalize(in); err == nil {
+			t.Errorf("%q normalized to %q", in, s)
+		}
+	}
+	if _, err := r.NormalizeAll([]string{"ETHUSDT", "nope"}); err == nil {
+		t.Fatal("NormalizeAll with an unknown symbol")
+	}
+}
+
+func TestSymbolInfoRound(t *testing.T) {
+	r := loadTestSymbols(t)
+	btc, _ := r.Lookup("BTCUSDT")
+	eth, _ := r.Lookup("eth_usdt")
+
+	tests := []struct {
+		info     SymbolInfo
+		in, want string
+		quantity bool
+	}{
+		// on the PRICE and QUANTITY filters, prices to the nearest tick, quantities down
+		{btc, "30000.126", "30000.13", false},
+		{btc, "30000.124", "30000.12", false},
+		{btc, "0.12349", "0.1234", true},
+		{btc, "0.00009", "0", true},
+		// on the precisions without filters
+		{eth, "2000.005", "2000.01", false},
+		{eth, "1.23456", "1.2345", true},
+	}
+	for _, tt := range tests {
+		in, got := MustParseDecimal(tt.in), Decimal{}
+		if tt.quantity {
+			got = tt.info.RoundQuantity(in)
+		} else {
+			got = tt.info.RoundPrice(in)
+		}
+		if !got.Equal(MustParseDecimal(tt.want)) {
+			t.Errorf("%s round %s = %s, want %s", tt.info.Symbol, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSymbolInfoValidate(t *testing.T) {
+	r := loadTestSymbols(t)
+	btc, _ := r.Lookup("btc_usdt")
+	old, _ := r.Lookup("old_usdt")
+
+	if err := btc.Validate(MustParseDecimal("30000.01"), MustParseDecimal("0.001")); err != nil {
+		t.Fatal(err)
+	}
+	if err := btc.Validate(Decimal{}, MustParseDecimal("0.001")); err != nil {
+		t.Fatalf("market order: %s", err)
+	}
+
+	tests := []struct {
+		info       SymbolInfo
+		price, qty string
+		want       string
+	}{
+		{old, "1", "1", "not trading"},
+		{btc, "30000.001", "0.001", "not on tick"},
+		{btc, "2000000", "0.001", "price 2000000 of btc_usdt above"},
+		{btc, "30000", "0.00015", "not on step"},
+		{btc, "30000", "2000", "quantity 2000 of btc_usdt above"},
+		{btc, "1", "0.001", "notional"},
+	}
+	for _, tt := range tests {
+		err := tt.info.Validate(MustParseDecimal(tt.price), MustParseDecimal(tt.qty))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s %s x %s: got %v, want %q", tt.info.Symbol, tt.price, tt.qty, err, tt.want)
+		}
+	}
+}
+
+func TestSymbolRegistryCheckOrder(t *testing.T) {
+	r := loadTestSymbols(t)
+
+	o := limitOrder("buy", "30000.004", "0.00025")
+	o.Symbol = "BTC-USDT"
+	var riskErr *RiskError
+	if err := r.CheckOrder(o); !errors.As(err, &riskErr) || riskErr.Rule != RiskInvalid {
+		t.Fatalf("got %v, want an invalid RiskError", err)
+	}
+
+	r.RoundOrders = true
+	if err := r.CheckOrder(o); err != nil {
+		t.Fatal(err)
+	}
+	if o.Symbol != "btc_usdt" || !o.Price.Equal(MustParseDecimal("30000")) || !o.Quantity.Equal(MustParseDecimal("0.0002")) {
+		t.Fatalf("order %s %s x %s", o.Symbol, o.Price, o.Quantity)
+	}
+}
@@ -0,0 +1,204 @@
+package xtws
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DefaultTokenTTL lifetime assumed for tokens whose provider does not tell
+const DefaultTokenTTL = 24 * time.Hour
+
+// TokenProvider issues the listen key of private streams, expire is zero when unknown
+type TokenProvider interface {
+	Token(ctx context.Context) (token string, expire time.Time, err error)
+}
+
+// TokenProviderFunc adapts a func to TokenProvider
+type TokenProviderFunc func(ctx context.Context) (string, time.Time, error)
+
+func (f TokenProviderFunc) Token(ctx context.Context) (string, time.Time, error) { return f(ctx) }
+
+// RestTokenProvider spot websocket token, https://doc.xt.com/#websocket_private_cntoken
+type RestTokenProvider struct {
+	BaseURL    string // default RestBaseUrl
+	Key        string
+	Secret     string
+	RecvWindow time.Duration // default 5s
+	TTL        time.Duration // the endpoint does not return the expiry, default DefaultTokenTTL
+	Client     *http.Client
+}
+
+type restTokenResp struct {
+	Rc     int    `json:"rc"`
+	Mc     string `json:"mc"`
+	Result struct {
+		AccessToken string `json:"accessToken"`
+	} `json:"result"`
+}
+
+func (p *RestTokenProvider) Token(ctx context.Context) (string, time.Time, error) {
+	if p.Key == "" || p.Secret == "" {
+		return "", time.Time{}, newAuthEmptyErr()
+	}
+	base := p.BaseURL
+	if base == "" {
+		base = RestBaseUrl
+	}
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	recvWindow := p.RecvWindow
+	if recvWindow <= 0 {
+		recvWindow = 5 * time.Second
+	}
+	ttl := p.TTL
+	if ttl <= 0 {
+		ttl = DefaultTokenTTL
+	}
+
+	const path = "/v4/ws-token"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, base+path, nil)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	for k, v := range SignRestHeaders(p.Key, p.Secret, http.MethodPost, path, "", "", recvWindow, time.Now()) {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", time.Time{}, fmt.Errorf("fetch ws token: http status %d", resp.StatusCode)
+	}
+
+	var body restTokenResp
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", time.Time{}, err
+	}
+	if body.Rc != 0 || body.Result.AccessToken == "" {
+		return "", time.Time{}, fmt.Errorf("fetch ws token: %s", body.Mc)
+	}
+	return body.Result.AccessToken, time.Now().Add(ttl), nil
+}
+
+// RestFuturesTokenProvider futures user stream listen key, https://doc.xt.com/#futures_user_websocket_v2base
+type RestFuturesTokenProvider struct {
+	BaseURL string // default FuturesRestBaseUrl, CoinFuturesRestBaseUrl for COIN-M
+	Key     string
+	Secret  string
+	TTL     time.Duration // the endpoint does not return the expiry, default DefaultTokenTTL
+	Client  *http.Client
+}
+
+type restFuturesTokenResp struct {
+	ReturnCode int    `json:"returnCode"`
+	MsgInfo    string `json:"msgInfo"`
+	Result     string `json:"result"`
+}
+
+func (p *RestFuturesTokenProvider) Token(ctx context.Context) (string, time.Time, error) {
+	if p.Key == "" || p.Secret == "" {
+		return "", time.Time{}, newAuthEmptyErr()
+	}
+	base := p.BaseURL
+	if base == "" {
+		base = FuturesRestBaseUrl
+	}
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	ttl := p.TTL
+	if ttl <= 0 {
+		ttl = DefaultTokenTTL
+	}
+
+	const path = "/future/user/v1/user/listen-key"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+path, nil)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	for k, v := range SignFuturesHeaders(p.Key, p.Secret, path, "", "", time.Now()) {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", time.Time{}, fmt.Errorf("fetch listen key: http status %d", resp.StatusCode)
+	}
+
+	var body restFuturesTokenResp
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", time.Time{}, err
+	}
+	if body.ReturnCode != 0 || body.Result == "" {
+		return "", time.Time{}, fmt.Errorf("fetch listen key: %s", body.MsgInfo)
+	}
+	return body.Result, time.Now().Add(ttl), nil
+}
+
+// SignRestHeaders validate-* headers of a signed spot REST request, https://doc.xt.com/#documentationsignStatement.
+// query is the sorted url encoded query and body the raw json body, both may be empty.
+func SignRestHeaders(key, secret, method, path, query, body string, recvWindow time.Duration, now time.Time) map[string]string {
+	headers := map[string]string{
+		"validate-algorithms": "HmacSHA256",
+		"validate-appkey":     key,
+		"validate-recvwindow": strconv.FormatInt(recvWindow.Milliseconds(), 10),
+		"validate-timestamp":  strconv.FormatInt(now.UnixMilli(), 10),
+	}
+
+	x := fmt.Sprintf("validate-algorithms=%s&validate-appkey=%s&validate-recvwindow=%s&validate-timestamp=%s",
+		headers["validate-algorithms"], key, headers["validate-recvwindow"], headers["validate-timestamp"])
+	y := "#" + method + "#" + path
+	if query != "" {
+		y += "#" + query
+	}
+	if body != "" {
+		y += "#" + body
+	}
+
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(x + y))
+	headers["validate-signature"] = hex.EncodeToString(h.Sum(nil))
+	return headers
+}
+
+// SignFuturesHeaders validate-* headers of a signed futures REST request, https://doc.xt.com/#futures_documentationsignStatement.
+// query is the sorted url encoded query and body the raw json body, both may be empty.
+func SignFuturesHeaders(key, secret, path, query, body string, now time.Time) map[string]string {
+	headers := map[string]string{
+		"validate-appkey":    key,
+		"validate-timestamp": strconv.FormatInt(now.UnixMilli(), 10),
+	}
+
+	x := fmt.Sprintf("validate-appkey=%s&validate-timestamp=%s", key, headers["validate-timestamp"])
+	y := "#" + path
+	if query != "" {
+		y += "#" + query
+	}
+	if body != "" {
+		y += "#" + body
+	}
+
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(x + y))
+	headers["validate-signature"] = hex.EncodeToString(h.Sum(nil))
+	return headers
+}